@@ -0,0 +1,109 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OpenedxRestoreSpec defines the desired state of OpenedxRestore
+type OpenedxRestoreSpec struct {
+	// OpenedxName names the Openedx, in the namespace of the restore, whose
+	// databases are restored.
+	// +kubebuilder:validation:MinLength=1
+	OpenedxName string `json:"openedxName"`
+
+	// Backup is the time of the backup run to restore, as found in the names
+	// of its archives, e.g. 20201125T030000Z. The archives are read from where
+	// the Openedx backs up to.
+	// +kubebuilder:validation:Pattern=`^[0-9]{8}T[0-9]{6}Z$`
+	Backup string `json:"backup"`
+}
+
+// RestorePhase is the step an OpenedxRestore is at.
+type RestorePhase string
+
+const (
+	// RestorePending means the restore has not started yet.
+	RestorePending RestorePhase = "Pending"
+	// RestoreScalingDown means the components using the databases are being stopped.
+	RestoreScalingDown RestorePhase = "ScalingDown"
+	// RestoreRestoringDatabases means the MySQL and MongoDB archives are being loaded.
+	RestoreRestoringDatabases RestorePhase = "RestoringDatabases"
+	// RestoreRebuildingIndexes means the course and forum search indexes are being rebuilt.
+	RestoreRebuildingIndexes RestorePhase = "RebuildingIndexes"
+	// RestoreScalingUp means the components are being started again.
+	RestoreScalingUp RestorePhase = "ScalingUp"
+	// RestoreCompleted means the platform runs on the restored data.
+	RestoreCompleted RestorePhase = "Completed"
+	// RestoreFailed means a step failed, see the message and failedPhase.
+	RestoreFailed RestorePhase = "Failed"
+)
+
+// OpenedxRestoreStatus defines the observed state of OpenedxRestore
+type OpenedxRestoreStatus struct {
+	// Phase is the step the restore is at.
+	// +optional
+	Phase RestorePhase `json:"phase,omitempty"`
+
+	// FailedPhase is the step that failed. When the databases were being
+	// restored, the platform stays scaled down until the OpenedxRestore is
+	// deleted, as their data may be incomplete.
+	// +optional
+	FailedPhase RestorePhase `json:"failedPhase,omitempty"`
+
+	// Message is a human readable description of the current step, or of the failure.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartTime is when the restore started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the restore completed or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Openedx",type=string,JSONPath=`.spec.openedxName`
+// +kubebuilder:printcolumn:name="Backup",type=string,JSONPath=`.spec.backup`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// OpenedxRestore is the Schema for the openedxrestores API
+type OpenedxRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OpenedxRestoreSpec   `json:"spec,omitempty"`
+	Status OpenedxRestoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// OpenedxRestoreList contains a list of OpenedxRestore
+type OpenedxRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OpenedxRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OpenedxRestore{}, &OpenedxRestoreList{})
+}
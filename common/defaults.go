@@ -21,6 +21,9 @@ const (
 	//OpenedxDefaultStudioSiteName
 	OpenedxDefaultStudioSiteName = "studio"
 
+	//OpenedxDefaultBaseDomain
+	OpenedxDefaultBaseDomain = "apps.demo.coreostrain.me"
+
 	//OpenedxDefaultTitle
 	OpenedxDefaultTitle = "Red Hat Operator Enablement Team"
 )
@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/log"
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// mcImage is the MinIO client uploading backups to S3-compatible buckets.
+const mcImage = "docker.io/minio/mc:RELEASE.2020-11-25T23-04-07Z"
+
+// backupMountPath is where the archives are written, on the backup volume or
+// on a scratch volume before they are uploaded.
+const backupMountPath = "/backup"
+
+// Keys of the Secret holding the credentials of the S3 bucket.
+const (
+	s3AccessKeyIDKey     = "access-key-id"
+	s3SecretAccessKeyKey = "secret-access-key"
+)
+
+func backupCronJobName(instance *cachev1.Openedx) string {
+	return instance.Name + "-backup"
+}
+
+// getOpenedxBackup will return the backup settings, or nil when backups are disabled.
+func getOpenedxBackup(cr *cachev1.Openedx) *cachev1.BackupSpec {
+	return cr.Spec.Backup
+}
+
+// getOpenedxBackupS3 will return the bucket backups are uploaded to, or nil when they are kept on a volume.
+func getOpenedxBackupS3(cr *cachev1.Openedx) *cachev1.S3BackupSpec {
+	if backup := getOpenedxBackup(cr); backup != nil {
+		return backup.S3
+	}
+	return nil
+}
+
+// getOpenedxBackupKeep will return the number of archives kept for each database.
+func getOpenedxBackupKeep(cr *cachev1.Openedx) int32 {
+	if backup := getOpenedxBackup(cr); backup != nil && backup.Keep != nil {
+		return *backup.Keep
+	}
+	return 7
+}
+
+// isBackupVolume reports whether the archives are kept on the backup volume.
+func isBackupVolume(cr *cachev1.Openedx) bool {
+	return getOpenedxBackup(cr) != nil && getOpenedxBackupS3(cr) == nil
+}
+
+// backupScriptHeader stops at the first failure, including in a pipe, and
+// defines prune, which keeps the newest $BACKUP_KEEP archives of a database.
+// Archive names end with a UTC timestamp, so they sort by age. Every archive
+// of a run is named after the time the run was scheduled at, which the
+// CronJob controller puts in minutes at the end of the Job name, so an
+// OpenedxRestore names a run by it. A Job created by hand uses the time it
+// starts at.
+const backupScriptHeader = `set -eo pipefail
+minutes=${JOB_NAME##*-}
+case "$minutes" in
+  ''|*[!0-9]*) ts=$(date -u +%Y%m%dT%H%M%SZ) ;;
+  *) ts=$(date -u -d "@$((minutes * 60))" +%Y%m%dT%H%M%SZ) ;;
+esac
+prune() {
+  ls -1 "$1/$2"-* 2>/dev/null | sort -r | tail -n +$((BACKUP_KEEP + 1)) | xargs -r rm -f --
+}
+`
+
+// mysqlBackupScript dumps the database of the LMS and CMS.
+const mysqlBackupScript = backupScriptHeader + `mkdir -p /backup/mysql
+mysqldump --host="$MYSQL_HOST" --port="$MYSQL_PORT" --user="$MYSQL_USER" \
+  --single-transaction --routines --triggers --no-tablespaces "$MYSQL_DATABASE" \
+  | gzip > "/backup/mysql/.$MYSQL_DATABASE-$ts.sql.gz"
+mv "/backup/mysql/.$MYSQL_DATABASE-$ts.sql.gz" "/backup/mysql/$MYSQL_DATABASE-$ts.sql.gz"
+if [ "$BACKUP_PRUNE" = "true" ]; then prune /backup/mysql "$MYSQL_DATABASE"; fi
+`
+
+// mongodbBackupScript dumps the modulestore and the forum databases.
+const mongodbBackupScript = backupScriptHeader + `mkdir -p /backup/mongodb
+dump() {
+  mongodump --uri="$2" --gzip --archive="/backup/mongodb/.$1-$ts.archive.gz"
+  mv "/backup/mongodb/.$1-$ts.archive.gz" "/backup/mongodb/$1-$ts.archive.gz"
+  if [ "$BACKUP_PRUNE" = "true" ]; then prune /backup/mongodb "$1"; fi
+}
+dump "$MONGODB_DATABASE" "$MONGODB_URI"
+dump "$FORUM_DATABASE" "$FORUM_URI"
+`
+
+// s3UploadScript uploads the archives of the run, then prunes the bucket
+// the way prune does a volume.
+const s3UploadScript = `set -e
+mc --quiet alias set backup "$S3_ENDPOINT" "$S3_ACCESS_KEY_ID" "$S3_SECRET_ACCESS_KEY" > /dev/null
+mc --quiet cp --recursive /backup/ "backup/$S3_TARGET/"
+for entry in mysql:$MYSQL_DATABASE $(for db in $MONGODB_DATABASES; do echo mongodb:$db; done); do
+  dir=${entry%%:*}
+  db=${entry#*:}
+  mc --quiet ls "backup/$S3_TARGET/$dir/" | awk '{print $NF}' | grep "^$db-" | sort -r \
+    | tail -n +$((BACKUP_KEEP + 1)) | while read -r name; do
+    mc --quiet rm "backup/$S3_TARGET/$dir/$name"
+  done
+done
+`
+
+// backupEnv returns the settings shared by the containers of a backup.
+func backupEnv(instance *cachev1.Openedx) []corev1.EnvVar {
+	databases := []string{getOpenedxMongoDBDatabase(instance), getOpenedxForumDatabase(instance)}
+
+	return []corev1.EnvVar{
+		{Name: "JOB_NAME", ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels['job-name']"},
+		}},
+		{Name: "BACKUP_KEEP", Value: strconv.Itoa(int(getOpenedxBackupKeep(instance)))},
+		{Name: "BACKUP_PRUNE", Value: strconv.FormatBool(isBackupVolume(instance))},
+		{Name: "MYSQL_DATABASE", Value: getOpenedxMySQLDatabase(instance)},
+		{Name: "MONGODB_DATABASES", Value: strings.Join(databases, " ")},
+	}
+}
+
+// mysqlBackupContainer dumps MySQL with the credentials of the LMS and CMS.
+func mysqlBackupContainer(instance *cachev1.Openedx) corev1.Container {
+	env := append(backupEnv(instance),
+		corev1.EnvVar{Name: "MYSQL_HOST", Value: getOpenedxMySQLHost(instance)},
+		corev1.EnvVar{Name: "MYSQL_PORT", Value: strconv.Itoa(int(getOpenedxMySQLPort(instance)))},
+		secretEnvVar("MYSQL_USER", mysqlAuthName(instance), mysqlUsernameKey),
+		secretEnvVar("MYSQL_PWD", mysqlAuthName(instance), mysqlPasswordKey),
+	)
+
+	return corev1.Container{
+		Name:    "mysqldump",
+		Image:   getOpenedxMySQLImage(instance),
+		Command: []string{"bash", "-c", mysqlBackupScript},
+		Env:     env,
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      "backup",
+			MountPath: backupMountPath,
+		}},
+	}
+}
+
+// mongodbBackupContainer dumps the MongoDB databases of the modulestore and the forum.
+func mongodbBackupContainer(instance *cachev1.Openedx) corev1.Container {
+	env := backupEnv(instance)
+	if name := getOpenedxMongoDBAuthName(instance); len(name) > 0 {
+		env = append(env,
+			secretEnvVar("MONGODB_USERNAME", name, mongodbUsernameKey),
+			secretEnvVar("MONGODB_PASSWORD", name, mongodbPasswordKey),
+		)
+	}
+	env = append(env,
+		corev1.EnvVar{Name: "MONGODB_DATABASE", Value: getOpenedxMongoDBDatabase(instance)},
+		corev1.EnvVar{Name: "MONGODB_URI", Value: getMongoDBURI(instance, getOpenedxMongoDBDatabase(instance))},
+		corev1.EnvVar{Name: "FORUM_DATABASE", Value: getOpenedxForumDatabase(instance)},
+		corev1.EnvVar{Name: "FORUM_URI", Value: getForumMongoDBURI(instance)},
+	)
+
+	return corev1.Container{
+		Name:    "mongodump",
+		Image:   getOpenedxMongoDBImage(instance),
+		Command: []string{"bash", "-c", mongodbBackupScript},
+		Env:     env,
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      "backup",
+			MountPath: backupMountPath,
+		}},
+	}
+}
+
+// s3UploadContainer uploads the archives dumped by the init containers.
+func s3UploadContainer(instance *cachev1.Openedx, s3 *cachev1.S3BackupSpec) corev1.Container {
+	env := append(backupEnv(instance),
+		corev1.EnvVar{Name: "S3_ENDPOINT", Value: s3.Endpoint},
+		corev1.EnvVar{Name: "S3_TARGET", Value: path.Join(s3.Bucket, strings.Trim(s3.Prefix, "/"))},
+		secretEnvVar("S3_ACCESS_KEY_ID", s3.CredentialsSecret, s3AccessKeyIDKey),
+		secretEnvVar("S3_SECRET_ACCESS_KEY", s3.CredentialsSecret, s3SecretAccessKeyKey),
+	)
+
+	return corev1.Container{
+		Name:    "upload",
+		Image:   mcImage,
+		Command: []string{"sh", "-c", s3UploadScript},
+		Env:     env,
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      "backup",
+			MountPath: backupMountPath,
+		}},
+	}
+}
+
+// backupCronJob dumps MySQL and MongoDB on the backup schedule. The dumps are
+// written to the backup volume and pruned there, or, with S3, written to a
+// scratch volume by init containers before they are uploaded and the bucket
+// is pruned.
+func (r *OpenedxReconciler) backupCronJob(instance *cachev1.Openedx) *batchv1beta1.CronJob {
+	backup := getOpenedxBackup(instance)
+	labels := labels(instance, "backup")
+	suspend := backup.Suspend
+	backoffLimit := int32(2)
+	startingDeadline := int64(3600)
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyOnFailure,
+	}
+	dumps := []corev1.Container{mysqlBackupContainer(instance), mongodbBackupContainer(instance)}
+	if s3 := getOpenedxBackupS3(instance); s3 != nil {
+		podSpec.InitContainers = dumps
+		podSpec.Containers = []corev1.Container{s3UploadContainer(instance, s3)}
+		podSpec.Volumes = []corev1.Volume{{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		}}
+	} else {
+		podSpec.Containers = dumps
+		podSpec.Volumes = []corev1.Volume{{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: getOpenedxVolumeClaimName(instance, "backup"),
+				},
+			},
+		}}
+	}
+
+	cronJob := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupCronJobName(instance),
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:                backup.Schedule,
+			Suspend:                 &suspend,
+			ConcurrencyPolicy:       batchv1beta1.ForbidConcurrent,
+			StartingDeadlineSeconds: &startingDeadline,
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: labels,
+						},
+						Spec: podSpec,
+					},
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(instance, cronJob, r.Scheme)
+	return cronJob
+}
+
+// deleteBackupCronJob removes the backup CronJob once backups are disabled.
+// The archives are left alone.
+func (r *OpenedxReconciler) deleteBackupCronJob(instance *cachev1.Openedx) error {
+	found := &batchv1beta1.CronJob{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      backupCronJobName(instance),
+		Namespace: getOpenedxNamespace(instance),
+	}, found)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !isOwnedBy(instance, found) {
+		return nil
+	}
+
+	log.Info("Deleting CronJob")
+	log.Info("CronJob Namespace : ", found.Namespace)
+	log.Info("CronJob Name : ", found.Name)
+
+	err = r.Client.Delete(context.TODO(), found, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// isBackupJob reports whether the Job is run by the backup CronJob of the
+// platform. Those Jobs are controlled by the CronJob rather than the Openedx,
+// so they are matched through the instance label of its job template.
+func isBackupJob(instance *cachev1.Openedx, job metav1.Object) bool {
+	owner := metav1.GetControllerOf(job)
+	if owner == nil || owner.Kind != "CronJob" || owner.Name != backupCronJobName(instance) {
+		return false
+	}
+	return job.GetLabels()["instance"] == instance.Name
+}
+
+// backupStatus reports when the backup CronJob last ran and last succeeded.
+// The Jobs of a CronJob are pruned, so a success no longer visible keeps the
+// time previously reported.
+func (r *OpenedxReconciler) backupStatus(instance *cachev1.Openedx) *cachev1.BackupStatus {
+	if getOpenedxBackup(instance) == nil {
+		return nil
+	}
+
+	status := &cachev1.BackupStatus{}
+	if instance.Status.Backup != nil {
+		status = instance.Status.Backup.DeepCopy()
+	}
+
+	cronJob := &batchv1beta1.CronJob{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      backupCronJobName(instance),
+		Namespace: getOpenedxNamespace(instance),
+	}, cronJob)
+	if err != nil {
+		return status
+	}
+	status.LastScheduleTime = cronJob.Status.LastScheduleTime
+
+	jobs := &batchv1.JobList{}
+	err = r.Client.List(context.TODO(), jobs,
+		client.InNamespace(cronJob.Namespace),
+		client.MatchingLabels(cronJob.Spec.JobTemplate.Labels))
+	if err != nil {
+		return status
+	}
+	for _, job := range jobs.Items {
+		if owner := metav1.GetControllerOf(&job); owner == nil || owner.UID != cronJob.UID {
+			continue
+		}
+		completed := job.Status.CompletionTime
+		if job.Status.Succeeded > 0 && completed != nil &&
+			(status.LastSuccessfulTime == nil || status.LastSuccessfulTime.Before(completed)) {
+			status.LastSuccessfulTime = completed
+		}
+	}
+	return status
+}
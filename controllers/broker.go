@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"fmt"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	"github.com/rocrisp/openedx-operator/render"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// brokerURLKey is the key of the Secret of an external broker holding its URL.
+const brokerURLKey = "url"
+
+// getOpenedxBrokerType will return the kind of Celery broker, defaulting to Redis.
+func getOpenedxBrokerType(cr *cachev1.Openedx) cachev1.BrokerType {
+	if cr.Spec.Broker != nil && len(cr.Spec.Broker.Type) > 0 {
+		return cr.Spec.Broker.Type
+	}
+	return cachev1.BrokerRedis
+}
+
+// getOpenedxExternalBroker returns the external broker, or nil when the broker
+// runs in the cluster.
+func getOpenedxExternalBroker(cr *cachev1.Openedx) *cachev1.ExternalBrokerSpec {
+	if getOpenedxBrokerType(cr) != cachev1.BrokerExternal {
+		return nil
+	}
+	return cr.Spec.Broker.External
+}
+
+// getOpenedxRenderBroker returns the Celery broker of the settings of the LMS and CMS.
+func getOpenedxRenderBroker(cr *cachev1.Openedx) render.Broker {
+	switch getOpenedxBrokerType(cr) {
+	case cachev1.BrokerRabbitMQ:
+		return render.Broker{
+			Transport:     "amqp",
+			Hostname:      fmt.Sprintf("%s:%d", rabbitmqServiceName(cr), rabbitmqPort),
+			Authenticated: true,
+		}
+	case cachev1.BrokerExternal:
+		return render.Broker{External: true}
+	default:
+		return render.Broker{
+			Transport: "redis",
+			Hostname:  fmt.Sprintf("%s:%d", redisServiceName(cr), redisPort),
+		}
+	}
+}
+
+// getOpenedxBrokerEnv returns the credentials of the broker read by the Django settings.
+func getOpenedxBrokerEnv(cr *cachev1.Openedx) []corev1.EnvVar {
+	switch getOpenedxBrokerType(cr) {
+	case cachev1.BrokerRabbitMQ:
+		return []corev1.EnvVar{
+			secretEnvVar("OPENEDX_CELERY_BROKER_USER", rabbitmqAuthName(cr), rabbitmqUsernameKey),
+			secretEnvVar("OPENEDX_CELERY_BROKER_PASSWORD", rabbitmqAuthName(cr), rabbitmqPasswordKey),
+		}
+	case cachev1.BrokerExternal:
+		if broker := getOpenedxExternalBroker(cr); broker != nil {
+			return []corev1.EnvVar{secretEnvVar("OPENEDX_CELERY_BROKER_URL", broker.URLSecret, brokerURLKey)}
+		}
+	}
+	return nil
+}
@@ -25,12 +25,12 @@ func caddyServiceName(instance *cachev1.Openedx) string {
 
 func (r *OpenedxReconciler) caddyDeployment(instance *cachev1.Openedx) *appsv1.Deployment {
 	labels := labels(instance, "caddy")
-	size := instance.Spec.Size
+	size := getOpenedxReplicas(instance, getOpenedxComponents(instance).Caddy)
 
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      caddyDeploymentName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &size,
@@ -47,7 +47,7 @@ func (r *OpenedxReconciler) caddyDeployment(instance *cachev1.Openedx) *appsv1.D
 							Name: "data",
 							VolumeSource: corev1.VolumeSource{
 								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-									ClaimName: "caddy",
+									ClaimName: getOpenedxVolumeClaimName(instance, "caddy"),
 								},
 							},
 						}, {
@@ -62,8 +62,9 @@ func (r *OpenedxReconciler) caddyDeployment(instance *cachev1.Openedx) *appsv1.D
 						},
 					},
 					Containers: []corev1.Container{{
-						Image: caddyImage,
-						Name:  "caddy",
+						Image:     caddyImage,
+						Name:      "caddy",
+						Resources: getOpenedxResources(getOpenedxComponents(instance).Caddy),
 						Ports: []corev1.ContainerPort{
 							{
 								ContainerPort: caddyPort1,
@@ -100,7 +101,7 @@ func (r *OpenedxReconciler) caddyService(instance *cachev1.Openedx) *corev1.Serv
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      caddyServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -131,7 +132,7 @@ func (r *OpenedxReconciler) isCaddyUp(instance *cachev1.Openedx) bool {
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      caddyDeploymentName(instance),
-		Namespace: instance.Namespace,
+		Namespace: getOpenedxNamespace(instance),
 	}, deployment)
 
 	if err != nil {
@@ -139,7 +140,7 @@ func (r *OpenedxReconciler) isCaddyUp(instance *cachev1.Openedx) bool {
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if deployment.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// configChecksumAnnotation is stamped on pod templates with the checksum of the
+// ConfigMaps and Secrets their pods consume, so that a change to any of them
+// rolls the pods of that workload, and only of that workload.
+const configChecksumAnnotation = "cache.operatortrain.me/config-checksum"
+
+// podConfigRefs returns the sorted names of the ConfigMaps and Secrets a pod
+// mounts or reads environment variables from.
+func podConfigRefs(spec *corev1.PodSpec) (configMaps, secrets []string) {
+	cms := map[string]bool{}
+	ss := map[string]bool{}
+
+	for _, v := range spec.Volumes {
+		if v.ConfigMap != nil {
+			cms[v.ConfigMap.Name] = true
+		}
+		if v.Secret != nil {
+			ss[v.Secret.SecretName] = true
+		}
+		if v.Projected != nil {
+			for _, p := range v.Projected.Sources {
+				if p.ConfigMap != nil {
+					cms[p.ConfigMap.Name] = true
+				}
+				if p.Secret != nil {
+					ss[p.Secret.Name] = true
+				}
+			}
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, e := range c.EnvFrom {
+			if e.ConfigMapRef != nil {
+				cms[e.ConfigMapRef.Name] = true
+			}
+			if e.SecretRef != nil {
+				ss[e.SecretRef.Name] = true
+			}
+		}
+		for _, e := range c.Env {
+			if e.ValueFrom == nil {
+				continue
+			}
+			if e.ValueFrom.ConfigMapKeyRef != nil {
+				cms[e.ValueFrom.ConfigMapKeyRef.Name] = true
+			}
+			if e.ValueFrom.SecretKeyRef != nil {
+				ss[e.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+	}
+
+	return sortedKeys(cms), sortedKeys(ss)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hashData writes the entries of a ConfigMap or Secret to h in key order.
+func hashData(h hash.Hash, kind, name string, data map[string][]byte) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(h, "%s/%s\x00", kind, name)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s\x00%d\x00", k, len(data[k]))
+		h.Write(data[k])
+	}
+}
+
+// configMapData returns every entry of a ConfigMap as bytes.
+func configMapData(cm *corev1.ConfigMap) map[string][]byte {
+	data := make(map[string][]byte, len(cm.Data)+len(cm.BinaryData))
+	for k, v := range cm.Data {
+		data[k] = []byte(v)
+	}
+	for k, v := range cm.BinaryData {
+		data[k] = v
+	}
+	return data
+}
+
+// configChecksum returns the checksum of the ConfigMaps and Secrets consumed by
+// a pod template, or "" when it consumes none. ConfigMaps rendered by the
+// operator are hashed from their desired data, so that a change rolls the pods
+// in the same reconcile it is written; anything else is read from the cluster.
+func (r *OpenedxReconciler) configChecksum(namespace string,
+	template *corev1.PodTemplateSpec,
+	rendered map[string]*corev1.ConfigMap,
+) (string, error) {
+	configMaps, secrets := podConfigRefs(&template.Spec)
+	if len(configMaps) == 0 && len(secrets) == 0 {
+		return "", nil
+	}
+
+	h := sha256.New()
+	for _, name := range configMaps {
+		cm, ok := rendered[name]
+		if !ok {
+			cm = &corev1.ConfigMap{}
+			err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, cm)
+			if err != nil {
+				return "", fmt.Errorf("reading ConfigMap %s: %v", name, err)
+			}
+		}
+		hashData(h, "configmap", name, configMapData(cm))
+	}
+	for _, name := range secrets {
+		s := &corev1.Secret{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, s)
+		if err != nil {
+			return "", fmt.Errorf("reading Secret %s: %v", name, err)
+		}
+		hashData(h, "secret", name, s.Data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stampConfigChecksum sets the config checksum annotation on a pod template.
+func (r *OpenedxReconciler) stampConfigChecksum(namespace string,
+	template *corev1.PodTemplateSpec,
+	rendered map[string]*corev1.ConfigMap,
+) error {
+	sum, err := r.configChecksum(namespace, template, rendered)
+	if err != nil || sum == "" {
+		return err
+	}
+
+	if template.ObjectMeta.Annotations == nil {
+		template.ObjectMeta.Annotations = make(map[string]string)
+	}
+	template.ObjectMeta.Annotations[configChecksumAnnotation] = sum
+	return nil
+}
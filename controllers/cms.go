@@ -12,7 +12,6 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-const cmsImage = "docker.io/overhangio/openedx:11.2.3"
 const cmsPort = 8000
 
 func cmsDeploymentName(cr *cachev1.Openedx) string {
@@ -25,12 +24,12 @@ func cmsServiceName(cr *cachev1.Openedx) string {
 func (r *OpenedxReconciler) cmsDeployment(cr *cachev1.Openedx) *appsv1.Deployment {
 	labels := labels(cr, "cms")
 	//annotations := annotations(cr, "cms")
-	size := cr.Spec.Size
+	size := getOpenedxReplicas(cr, getOpenedxComponents(cr).Cms)
 
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cmsDeploymentName(cr),
-			Namespace: cr.Namespace,
+			Namespace: getOpenedxNamespace(cr),
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
@@ -44,19 +43,20 @@ func (r *OpenedxReconciler) cmsDeployment(cr *cachev1.Openedx) *appsv1.Deploymen
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{{
-						Image: cmsImage,
-						Name:  "cms",
+						Image:     getOpenedxImage(cr),
+						Name:      "cms",
+						Resources: getOpenedxResources(getOpenedxComponents(cr).Cms),
 						Ports: []corev1.ContainerPort{{
 							ContainerPort: cmsPort,
 							Name:          "cms",
 						}},
 
-						Env: []corev1.EnvVar{
+						Env: append([]corev1.EnvVar{
 							{
 								Name:  "SERVICE_VARIANT",
 								Value: "cms",
 							},
-						},
+						}, getOpenedxSecretEnv(cr)...),
 
 						VolumeMounts: []corev1.VolumeMount{
 							{
@@ -109,6 +109,7 @@ func (r *OpenedxReconciler) cmsDeployment(cr *cachev1.Openedx) *appsv1.Deploymen
 		},
 	}
 
+	mountSearchCA(cr, &dep.Spec.Template.Spec)
 	controllerutil.SetControllerReference(cr, dep, r.Scheme)
 	return dep
 }
@@ -119,7 +120,7 @@ func (r *OpenedxReconciler) cmsService(instance *cachev1.Openedx) *corev1.Servic
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cmsServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -144,7 +145,7 @@ func (r *OpenedxReconciler) isCmsUp(cr *cachev1.Openedx) bool {
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      cmsDeploymentName(cr),
-		Namespace: cr.Namespace,
+		Namespace: getOpenedxNamespace(cr),
 	}, deployment)
 
 	if err != nil {
@@ -152,7 +153,7 @@ func (r *OpenedxReconciler) isCmsUp(cr *cachev1.Openedx) bool {
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if deployment.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
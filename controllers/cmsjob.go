@@ -1,18 +1,16 @@
 package controllers
 
 import (
-	"context"
-	"github.com/prometheus/common/log"
 	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 const cmsJobPort = 8000
 
+// cmsJobName is the prefix of the names of the CMS migration Jobs, see migrationJob.
 func cmsJobName(instance *cachev1.Openedx) string {
 	return instance.Name + "-cmsjob"
 }
@@ -24,6 +22,8 @@ func getCmsContainerEnv(cr *cachev1.Openedx) []corev1.EnvVar {
 		Name:  "SERVICE_VARIANT",
 		Value: "cms",
 	})
+	env = append(env, getOpenedxSecretEnv(cr)...)
+
 	return env
 }
 
@@ -33,7 +33,7 @@ func newCmsJob(instance *cachev1.Openedx) *batchv1.Job {
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cmsJobName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 	}
@@ -49,7 +49,7 @@ func newCmsPodSpec(cr *cachev1.Openedx) corev1.PodSpec {
 			"migrate",
 		},
 		Env:             getCmsContainerEnv(cr),
-		Image:           "docker.io/overhangio/openedx:11.2.3",
+		Image:           getOpenedxImage(cr),
 		ImagePullPolicy: corev1.PullAlways,
 		Name:            "cms",
 		VolumeMounts: []corev1.VolumeMount{
@@ -100,6 +100,7 @@ func newCmsPodSpec(cr *cachev1.Openedx) corev1.PodSpec {
 		},
 	}
 
+	mountSearchCA(cr, &pod)
 	return pod
 }
 
@@ -109,7 +110,7 @@ func newCmsPodTemplateSpec(cr *cachev1.Openedx) corev1.PodTemplateSpec {
 	return corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cmsJobName(cr),
-			Namespace: cr.Namespace,
+			Namespace: getOpenedxNamespace(cr),
 			Labels:    labels,
 		},
 		Spec: newCmsPodSpec(cr),
@@ -123,25 +124,3 @@ func (r *OpenedxReconciler) cmsJob(instance *cachev1.Openedx) *batchv1.Job {
 	controllerutil.SetControllerReference(instance, job, r.Scheme)
 	return job
 }
-
-func (r *OpenedxReconciler) isCmsJobDone(instance *cachev1.Openedx) bool {
-
-	job := &batchv1.Job{}
-
-	err := r.Client.Get(context.TODO(), types.NamespacedName{
-		Name:      cmsJobName(instance),
-		Namespace: instance.Namespace,
-	}, job)
-
-	if err != nil {
-		log.Error(err, "cmsjob not found")
-		return false
-	}
-
-	if job.Status.Succeeded > 0 {
-		return true
-	}
-
-	return false // Job not complete.
-
-}
@@ -11,7 +11,6 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-const cmsworkerImage = "docker.io/overhangio/openedx:11.2.3"
 const cmsworkerPort = 8000
 
 func cmsworkerDeploymentName(cr *cachev1.Openedx) string {
@@ -20,12 +19,12 @@ func cmsworkerDeploymentName(cr *cachev1.Openedx) string {
 
 func (r *OpenedxReconciler) cmsworkerDeployment(cr *cachev1.Openedx) *appsv1.Deployment {
 	labels := labels(cr, "cmsworker")
-	size := cr.Spec.Size
+	size := getOpenedxReplicas(cr, getOpenedxComponents(cr).CmsWorker)
 
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cmsworkerDeploymentName(cr),
-			Namespace: cr.Namespace,
+			Namespace: getOpenedxNamespace(cr),
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
@@ -49,13 +48,14 @@ func (r *OpenedxReconciler) cmsworkerDeployment(cr *cachev1.Openedx) *appsv1.Dep
 							"100",
 							"--exclude-queues=edx.lms.core.default",
 						},
-						Image: cmsworkerImage,
-						Name:  "cms-worker",
+						Image:     getOpenedxImage(cr),
+						Name:      "cms-worker",
+						Resources: getOpenedxResources(getOpenedxComponents(cr).CmsWorker),
 						Ports: []corev1.ContainerPort{{
 							ContainerPort: cmsPort,
 							Name:          "cmsworker",
 						}},
-						Env: []corev1.EnvVar{
+						Env: append([]corev1.EnvVar{
 							{
 								Name:  "SERVICE_VARIANT",
 								Value: "cms",
@@ -64,7 +64,7 @@ func (r *OpenedxReconciler) cmsworkerDeployment(cr *cachev1.Openedx) *appsv1.Dep
 								Name:  "C_FORCE_ROOT",
 								Value: "1",
 							},
-						},
+						}, getOpenedxSecretEnv(cr)...),
 
 						VolumeMounts: []corev1.VolumeMount{
 							{
@@ -117,6 +117,7 @@ func (r *OpenedxReconciler) cmsworkerDeployment(cr *cachev1.Openedx) *appsv1.Dep
 		},
 	}
 
+	mountSearchCA(cr, &dep.Spec.Template.Spec)
 	controllerutil.SetControllerReference(cr, dep, r.Scheme)
 	return dep
 }
@@ -128,7 +129,7 @@ func (r *OpenedxReconciler) isCmsworkerUp(cr *cachev1.Openedx) bool {
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      cmsworkerDeploymentName(cr),
-		Namespace: cr.Namespace,
+		Namespace: getOpenedxNamespace(cr),
 	}, deployment)
 
 	if err != nil {
@@ -136,7 +137,7 @@ func (r *OpenedxReconciler) isCmsworkerUp(cr *cachev1.Openedx) bool {
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if deployment.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
@@ -2,20 +2,27 @@ package controllers
 
 import (
 	"context"
+	"strings"
 
 	"github.com/prometheus/common/log"
 	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
 	"github.com/rocrisp/openedx-operator/common"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	extv1beta1 "k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-const openedxNamespace = "openedx"
+// ownerAnnotation records the owning Openedx on objects that cannot carry an
+// owner reference because they live outside its namespace.
+const ownerAnnotation = "cache.operatortrain.me/owner"
 
 func (r *OpenedxReconciler) ensureDeployment(request reconcile.Request,
 	instance *cachev1.Openedx,
@@ -26,18 +33,19 @@ func (r *OpenedxReconciler) ensureDeployment(request reconcile.Request,
 	found := &appsv1.Deployment{}
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      dep.Name,
-		Namespace: openedxNamespace,
+		Namespace: dep.Namespace,
 	}, found)
 	if err != nil && errors.IsNotFound(err) {
 
 		// Create the deployment
 		log.Info("Creating a new Deployment")
-		log.Info("Deployment Namespace : ", openedxNamespace)
+		log.Info("Deployment Namespace : ", dep.Namespace)
 		log.Info("Deployment Name : ", dep.Name)
 
-		dep.Namespace = openedxNamespace
+		trackOwner(instance, dep)
 
 		err = r.Client.Create(context.TODO(), dep)
+		r.recordCreate(instance, "Deployment", dep.Name, err)
 
 		if err != nil {
 			// Deployment failed
@@ -55,6 +63,76 @@ func (r *OpenedxReconciler) ensureDeployment(request reconcile.Request,
 		return &reconcile.Result{}, err
 	}
 
+	// Bring the existing Deployment back to the desired state
+	if !syncDeployment(found, dep) {
+		return nil, nil
+	}
+
+	log.Info("Updating Deployment")
+	log.Info("Deployment Namespace : ", found.Namespace)
+	log.Info("Deployment Name : ", found.Name)
+
+	err = r.Client.Update(context.TODO(), found)
+	r.recordUpdate(instance, "Deployment", found.Name, err)
+	if err != nil {
+		log.Error(err, "Failed to update Deployment. ", "Deployment.Namespace : ", found.Namespace, " Deployment.Name : ", found.Name)
+		return &reconcile.Result{}, err
+	}
+
+	return nil, nil
+}
+
+func (r *OpenedxReconciler) ensureStatefulSet(request reconcile.Request,
+	instance *cachev1.Openedx,
+	sts *appsv1.StatefulSet,
+) (*reconcile.Result, error) {
+	found := &appsv1.StatefulSet{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      sts.Name,
+		Namespace: sts.Namespace,
+	}, found)
+	if err != nil && errors.IsNotFound(err) {
+
+		// Create the StatefulSet
+		log.Info("Creating a new StatefulSet")
+		log.Info("StatefulSet Namespace : ", sts.Namespace)
+		log.Info("StatefulSet Name : ", sts.Name)
+
+		trackOwner(instance, sts)
+
+		err = r.Client.Create(context.TODO(), sts)
+		r.recordCreate(instance, "StatefulSet", sts.Name, err)
+
+		if err != nil {
+			// Creation failed
+			log.Error(err, "Failed to create new StatefulSet. ", "StatefulSet.Namespace : ", sts.Namespace, " StatefulSet.Name : ", sts.Name)
+			return &reconcile.Result{}, err
+		} else {
+			// Creation was successful
+			return nil, nil
+		}
+	} else if err != nil {
+		// Error that isn't due to the StatefulSet not existing
+		log.Error(err, "Failed to get StatefulSet")
+		return &reconcile.Result{}, err
+	}
+
+	// Bring the existing StatefulSet back to the desired state
+	if !syncStatefulSet(found, sts) {
+		return nil, nil
+	}
+
+	log.Info("Updating StatefulSet")
+	log.Info("StatefulSet Namespace : ", found.Namespace)
+	log.Info("StatefulSet Name : ", found.Name)
+
+	err = r.Client.Update(context.TODO(), found)
+	r.recordUpdate(instance, "StatefulSet", found.Name, err)
+	if err != nil {
+		log.Error(err, "Failed to update StatefulSet. ", "StatefulSet.Namespace : ", found.Namespace, " StatefulSet.Name : ", found.Name)
+		return &reconcile.Result{}, err
+	}
+
 	return nil, nil
 }
 
@@ -65,16 +143,18 @@ func (r *OpenedxReconciler) ensureService(request reconcile.Request,
 	found := &corev1.Service{}
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      s.Name,
-		Namespace: openedxNamespace,
+		Namespace: s.Namespace,
 	}, found)
 	if err != nil && errors.IsNotFound(err) {
 
 		// Create the service
 		log.Info("Creating a new Service")
-		log.Info("Service Namespace : ", openedxNamespace)
+		log.Info("Service Namespace : ", s.Namespace)
 		log.Info("Service Name : ", s.Name)
-		s.Namespace = openedxNamespace
+		trackOwner(instance, s)
+
 		err = r.Client.Create(context.TODO(), s)
+		r.recordCreate(instance, "Service", s.Name, err)
 
 		if err != nil {
 			// Creation failed
@@ -90,6 +170,22 @@ func (r *OpenedxReconciler) ensureService(request reconcile.Request,
 		return &reconcile.Result{}, err
 	}
 
+	// Bring the existing Service back to the desired state
+	if !syncService(found, s) {
+		return nil, nil
+	}
+
+	log.Info("Updating Service")
+	log.Info("Service Namespace : ", found.Namespace)
+	log.Info("Service Name : ", found.Name)
+
+	err = r.Client.Update(context.TODO(), found)
+	r.recordUpdate(instance, "Service", found.Name, err)
+	if err != nil {
+		log.Error(err, "Failed to update Service. ", "Service.Namespace : ", found.Namespace, " Service.Name : ", found.Name)
+		return &reconcile.Result{}, err
+	}
+
 	return nil, nil
 }
 
@@ -99,20 +195,22 @@ func (r *OpenedxReconciler) ensureNamespace(request reconcile.Request,
 ) (*reconcile.Result, error) {
 	found := &corev1.Namespace{}
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
-		Name: openedxNamespace,
+		Name: ns.Name,
 	}, found)
 
 	if err != nil && errors.IsNotFound(err) {
 
 		// Create the namespace
 		log.Info("Creating a new namespace")
-		log.Info("Namespace :", openedxNamespace)
-		ns.Namespace = openedxNamespace
+		log.Info("Namespace :", ns.Name)
+		trackOwner(instance, ns)
+
 		err = r.Client.Create(context.TODO(), ns)
+		r.recordCreate(instance, "Namespace", ns.Name, err)
 
 		if err != nil {
 			// Creation failed
-			log.Error(err, "Failed to create new namespace. ", "Namespace : ", ns.Namespace)
+			log.Error(err, "Failed to create new namespace. ", "Namespace : ", ns.Name)
 			return &reconcile.Result{}, err
 		} else {
 			// Creation was successful
@@ -134,16 +232,18 @@ func (r *OpenedxReconciler) ensureConfigMap(request reconcile.Request,
 	found := &corev1.ConfigMap{}
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      cm.Name,
-		Namespace: openedxNamespace,
+		Namespace: cm.Namespace,
 	}, found)
 	if err != nil && errors.IsNotFound(err) {
 
 		// Create the configMap
 		log.Info("Creating a new ConfigMap")
-		log.Info("ConfigMap Namespace : ", openedxNamespace)
+		log.Info("ConfigMap Namespace : ", cm.Namespace)
 		log.Info("COnfigMap Name : ", cm.Name)
-		cm.Namespace = openedxNamespace
+		trackOwner(instance, cm)
+
 		err = r.Client.Create(context.TODO(), cm)
+		r.recordCreate(instance, "ConfigMap", cm.Name, err)
 
 		if err != nil {
 			// Creation failed
@@ -159,6 +259,76 @@ func (r *OpenedxReconciler) ensureConfigMap(request reconcile.Request,
 		return &reconcile.Result{}, err
 	}
 
+	// Bring the existing ConfigMap back to the desired state
+	if !syncConfigMap(found, cm) {
+		return nil, nil
+	}
+
+	log.Info("Updating ConfigMap")
+	log.Info("ConfigMap Namespace : ", found.Namespace)
+	log.Info("ConfigMap Name : ", found.Name)
+
+	err = r.Client.Update(context.TODO(), found)
+	r.recordUpdate(instance, "ConfigMap", found.Name, err)
+	if err != nil {
+		log.Error(err, "Failed to update ConfigMap. ", "ConfigMap.Namespace : ", found.Namespace, " ConfigMap.Name : ", found.Name)
+		return &reconcile.Result{}, err
+	}
+
+	return nil, nil
+}
+
+// ensureSecret creates a generated Secret when it does not exist yet. The data of
+// an existing Secret is never regenerated, so credentials stay stable for the
+// lifetime of the platform. Secrets named in the spec are provided by the user
+// and only checked for existence.
+// generate may be nil for Secrets that are always provided by the user.
+func (r *OpenedxReconciler) ensureSecret(request reconcile.Request,
+	instance *cachev1.Openedx,
+	name string,
+	generate func(*cachev1.Openedx) (*corev1.Secret, error),
+) (*reconcile.Result, error) {
+	found := &corev1.Secret{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: getOpenedxNamespace(instance),
+	}, found)
+	if err != nil && errors.IsNotFound(err) {
+
+		if isUserSecret(instance, name) {
+			log.Error(err, "User provided Secret not found. ", "Secret.Namespace : ", getOpenedxNamespace(instance), " Secret.Name : ", name)
+			return &reconcile.Result{}, err
+		}
+
+		s, err := generate(instance)
+		if err != nil {
+			log.Error(err, "Failed to generate Secret. ", "Secret.Name : ", name)
+			return &reconcile.Result{}, err
+		}
+
+		// Create the secret
+		log.Info("Creating a new Secret")
+		log.Info("Secret Namespace : ", s.Namespace)
+		log.Info("Secret Name : ", s.Name)
+		trackOwner(instance, s)
+
+		err = r.Client.Create(context.TODO(), s)
+		r.recordCreate(instance, "Secret", s.Name, err)
+
+		if err != nil {
+			// Creation failed
+			log.Error(err, "Failed to create new Secret. ", "Secret.Namespace : ", s.Namespace, " Secret.Name : ", s.Name)
+			return &reconcile.Result{}, err
+		} else {
+			// Creation was successful
+			return nil, nil
+		}
+	} else if err != nil {
+		// Error that isn't due to the Secret not existing
+		log.Error(err, "Failed to get Secret")
+		return &reconcile.Result{}, err
+	}
+
 	return nil, nil
 }
 
@@ -169,18 +339,19 @@ func (r *OpenedxReconciler) ensurePVC(request reconcile.Request,
 	found := &corev1.PersistentVolumeClaim{}
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      pvc.Name,
-		Namespace: openedxNamespace,
+		Namespace: pvc.Namespace,
 	}, found)
 	if err != nil && errors.IsNotFound(err) {
 
 		// Create the pvc
 		log.Info("Creating a new pvc")
-		log.Info("pvc Namespace : ", openedxNamespace)
+		log.Info("pvc Namespace : ", pvc.Namespace)
 		log.Info("pvc Name : ", pvc.Name)
 
-		pvc.Namespace = openedxNamespace
+		trackOwner(instance, pvc)
 
 		err = r.Client.Create(context.TODO(), pvc)
+		r.recordCreate(instance, "PersistentVolumeClaim", pvc.Name, err)
 
 		if err != nil {
 			// Creation failed
@@ -196,6 +367,22 @@ func (r *OpenedxReconciler) ensurePVC(request reconcile.Request,
 		return &reconcile.Result{}, err
 	}
 
+	// Bring the existing pvc back to the desired state
+	if !syncPVC(found, pvc) {
+		return nil, nil
+	}
+
+	log.Info("Updating pvc")
+	log.Info("pvc Namespace : ", found.Namespace)
+	log.Info("pvc Name : ", found.Name)
+
+	err = r.Client.Update(context.TODO(), found)
+	r.recordUpdate(instance, "PersistentVolumeClaim", found.Name, err)
+	if err != nil {
+		log.Error(err, "Failed to update pvc. ", "pvc.Namespace : ", found.Namespace, " pvc.Name : ", found.Name)
+		return &reconcile.Result{}, err
+	}
+
 	return nil, nil
 }
 
@@ -206,18 +393,19 @@ func (r *OpenedxReconciler) ensureJob(request reconcile.Request,
 	found := &batchv1.Job{}
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      j.Name,
-		Namespace: openedxNamespace,
+		Namespace: j.Namespace,
 	}, found)
 	if err != nil && errors.IsNotFound(err) {
 
 		// Create the configMap
 		log.Info("Creating a new Job")
-		log.Info("Job Namespace : ", openedxNamespace)
+		log.Info("Job Namespace : ", j.Namespace)
 		log.Info("Job Name : ", j.Name)
 
-		j.Namespace = openedxNamespace
+		trackOwner(instance, j)
 
 		err = r.Client.Create(context.TODO(), j)
+		r.recordJobStart(instance, j.Name, err)
 
 		if err != nil {
 			// Creation failed
@@ -233,6 +421,22 @@ func (r *OpenedxReconciler) ensureJob(request reconcile.Request,
 		return &reconcile.Result{}, err
 	}
 
+	// Bring the existing Job back to the desired state
+	if !syncJob(found, j) {
+		return nil, nil
+	}
+
+	log.Info("Updating Job")
+	log.Info("Job Namespace : ", found.Namespace)
+	log.Info("Job Name : ", found.Name)
+
+	err = r.Client.Update(context.TODO(), found)
+	r.recordUpdate(instance, "Job", found.Name, err)
+	if err != nil {
+		log.Error(err, "Failed to update Job. ", "Job.Namespace : ", found.Namespace, " Job.Name : ", found.Name)
+		return &reconcile.Result{}, err
+	}
+
 	return nil, nil
 }
 
@@ -243,18 +447,19 @@ func (r *OpenedxReconciler) ensureIngress(request reconcile.Request,
 	found := &extv1beta1.Ingress{}
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      ing.Name,
-		Namespace: openedxNamespace,
+		Namespace: ing.Namespace,
 	}, found)
 	if err != nil && errors.IsNotFound(err) {
 
 		// Create the configMap
 		log.Info("Creating a new Ingress")
-		log.Info("Ingress Namespace : ", openedxNamespace)
+		log.Info("Ingress Namespace : ", ing.Namespace)
 		log.Info("Ingress Name : ", ing.Name)
 
-		ing.Namespace = openedxNamespace
+		trackOwner(instance, ing)
 
 		err = r.Client.Create(context.TODO(), ing)
+		r.recordCreate(instance, "Ingress", ing.Name, err)
 
 		if err != nil {
 			// Creation failed
@@ -270,9 +475,219 @@ func (r *OpenedxReconciler) ensureIngress(request reconcile.Request,
 		return &reconcile.Result{}, err
 	}
 
+	// Bring the existing Ingress back to the desired state
+	if !syncIngress(found, ing) {
+		return nil, nil
+	}
+
+	log.Info("Updating Ingress")
+	log.Info("Ingress Namespace : ", found.Namespace)
+	log.Info("Ingress Name : ", found.Name)
+
+	err = r.Client.Update(context.TODO(), found)
+	r.recordUpdate(instance, "Ingress", found.Name, err)
+	if err != nil {
+		log.Error(err, "Failed to update Ingress. ", "Ingress.Namespace : ", found.Namespace, " Ingress.Name : ", found.Name)
+		return &reconcile.Result{}, err
+	}
+
+	return nil, nil
+}
+
+func (r *OpenedxReconciler) ensureHPA(request reconcile.Request,
+	instance *cachev1.Openedx,
+	hpa *autoscalingv2beta2.HorizontalPodAutoscaler,
+) (*reconcile.Result, error) {
+	found := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      hpa.Name,
+		Namespace: hpa.Namespace,
+	}, found)
+	if err != nil && errors.IsNotFound(err) {
+
+		// Create the HorizontalPodAutoscaler
+		log.Info("Creating a new HorizontalPodAutoscaler")
+		log.Info("HorizontalPodAutoscaler Namespace : ", hpa.Namespace)
+		log.Info("HorizontalPodAutoscaler Name : ", hpa.Name)
+
+		trackOwner(instance, hpa)
+
+		err = r.Client.Create(context.TODO(), hpa)
+		r.recordCreate(instance, "HorizontalPodAutoscaler", hpa.Name, err)
+
+		if err != nil {
+			// Creation failed
+			log.Error(err, "Failed to create new HorizontalPodAutoscaler. ", "HorizontalPodAutoscaler.Namespace : ", hpa.Namespace, " HorizontalPodAutoscaler.Name : ", hpa.Name)
+			return &reconcile.Result{}, err
+		} else {
+			// Creation was successful
+			return nil, nil
+		}
+	} else if err != nil {
+		// Error that isn't due to the HorizontalPodAutoscaler not existing
+		log.Error(err, "Failed to get HorizontalPodAutoscaler")
+		return &reconcile.Result{}, err
+	}
+
+	// Bring the existing HorizontalPodAutoscaler back to the desired state
+	if !syncHPA(found, hpa) {
+		return nil, nil
+	}
+
+	log.Info("Updating HorizontalPodAutoscaler")
+	log.Info("HorizontalPodAutoscaler Namespace : ", found.Namespace)
+	log.Info("HorizontalPodAutoscaler Name : ", found.Name)
+
+	err = r.Client.Update(context.TODO(), found)
+	r.recordUpdate(instance, "HorizontalPodAutoscaler", found.Name, err)
+	if err != nil {
+		log.Error(err, "Failed to update HorizontalPodAutoscaler. ", "HorizontalPodAutoscaler.Namespace : ", found.Namespace, " HorizontalPodAutoscaler.Name : ", found.Name)
+		return &reconcile.Result{}, err
+	}
+
+	return nil, nil
+}
+
+func (r *OpenedxReconciler) ensureCronJob(request reconcile.Request,
+	instance *cachev1.Openedx,
+	cj *batchv1beta1.CronJob,
+) (*reconcile.Result, error) {
+	found := &batchv1beta1.CronJob{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      cj.Name,
+		Namespace: cj.Namespace,
+	}, found)
+	if err != nil && errors.IsNotFound(err) {
+
+		// Create the CronJob
+		log.Info("Creating a new CronJob")
+		log.Info("CronJob Namespace : ", cj.Namespace)
+		log.Info("CronJob Name : ", cj.Name)
+
+		trackOwner(instance, cj)
+
+		err = r.Client.Create(context.TODO(), cj)
+		r.recordCreate(instance, "CronJob", cj.Name, err)
+
+		if err != nil {
+			// Creation failed
+			log.Error(err, "Failed to create new CronJob. ", "CronJob.Namespace : ", cj.Namespace, " CronJob.Name : ", cj.Name)
+			return &reconcile.Result{}, err
+		} else {
+			// Creation was successful
+			return nil, nil
+		}
+	} else if err != nil {
+		// Error that isn't due to the CronJob not existing
+		log.Error(err, "Failed to get CronJob")
+		return &reconcile.Result{}, err
+	}
+
+	// Bring the existing CronJob back to the desired state
+	if !syncCronJob(found, cj) {
+		return nil, nil
+	}
+
+	log.Info("Updating CronJob")
+	log.Info("CronJob Namespace : ", found.Namespace)
+	log.Info("CronJob Name : ", found.Name)
+
+	err = r.Client.Update(context.TODO(), found)
+	r.recordUpdate(instance, "CronJob", found.Name, err)
+	if err != nil {
+		log.Error(err, "Failed to update CronJob. ", "CronJob.Namespace : ", found.Namespace, " CronJob.Name : ", found.Name)
+		return &reconcile.Result{}, err
+	}
+
 	return nil, nil
 }
 
+// trackOwner records the owning Openedx on objects outside of its namespace,
+// which owner references cannot cover and which are therefore neither garbage
+// collected nor watched through their owner.
+func trackOwner(instance *cachev1.Openedx, obj metav1.Object) {
+	if obj.GetNamespace() == instance.Namespace {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[ownerAnnotation] = instance.Namespace + "/" + instance.Name
+	obj.SetAnnotations(annotations)
+}
+
+// isOwnedBy reports whether obj was created for instance, either through its
+// controller reference or through the owner annotation set by trackOwner.
+func isOwnedBy(instance *cachev1.Openedx, obj metav1.Object) bool {
+	if owner := metav1.GetControllerOf(obj); owner != nil && owner.UID == instance.UID {
+		return true
+	}
+	return obj.GetAnnotations()[ownerAnnotation] == instance.Namespace+"/"+instance.Name
+}
+
+// enqueueOwner enqueues the Openedx owning a changed object, found through
+// its controller reference or, outside the namespace of the Openedx, through
+// the owner annotation set by trackOwner.
+var enqueueOwner = &handler.EnqueueRequestsFromMapFunc{
+	ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+		if owner := metav1.GetControllerOf(obj.Meta); owner != nil {
+			if owner.APIVersion != cachev1.GroupVersion.String() || owner.Kind != "Openedx" {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{
+				Name:      owner.Name,
+				Namespace: obj.Meta.GetNamespace(),
+			}}}
+		}
+
+		parts := strings.SplitN(obj.Meta.GetAnnotations()[ownerAnnotation], "/", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{
+			Name:      parts[1],
+			Namespace: parts[0],
+		}}}
+	}),
+}
+
+// enqueueReferencing enqueues the Openedx objects whose spec references a
+// changed object, by name in their platform namespace. The user provides
+// those objects, so they carry neither an owner reference nor annotation.
+func (r *OpenedxReconciler) enqueueReferencing(references func(*cachev1.Openedx, string) bool) handler.EventHandler {
+	return r.enqueueMatching(func(instance *cachev1.Openedx, obj metav1.Object) bool {
+		return references(instance, obj.GetName())
+	})
+}
+
+// enqueueMatching enqueues the Openedx objects a changed object in their
+// platform namespace matches.
+func (r *OpenedxReconciler) enqueueMatching(matches func(*cachev1.Openedx, metav1.Object) bool) handler.EventHandler {
+	return &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			list := &cachev1.OpenedxList{}
+			if err := r.Client.List(context.TODO(), list); err != nil {
+				log.Error(err, "Failed to list Openedx")
+				return nil
+			}
+
+			requests := make([]reconcile.Request, 0)
+			for i := range list.Items {
+				instance := &list.Items[i]
+				if getOpenedxNamespace(instance) != obj.Meta.GetNamespace() || !matches(instance, obj.Meta) {
+					continue
+				}
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Name:      instance.Name,
+					Namespace: instance.Namespace,
+				}})
+			}
+			return requests
+		}),
+	}
+}
+
 func annotations(instance *cachev1.Openedx, app string) map[string]string {
 	return map[string]string{
 		"app":        "OpenedX",
@@ -299,6 +714,14 @@ func labels(instance *cachev1.Openedx, app string) map[string]string {
 	}
 }
 
+// getOpenedxNamespace will return the namespace the platform is deployed into.
+func getOpenedxNamespace(cr *cachev1.Openedx) string {
+	if cr.Spec.Namespace != nil && len(cr.Spec.Namespace.Name) > 0 {
+		return cr.Spec.Namespace.Name
+	}
+	return cr.Namespace
+}
+
 // getOpenedxLmsUrlName will return cr for lmssitename.
 func getOpenedxLmsUrlName(cr *cachev1.Openedx) string {
 	lmsSiteName := common.OpenedxDefaultLmsSiteName
@@ -317,6 +740,71 @@ func getOpenedxCmsUrlName(cr *cachev1.Openedx) string {
 	return cmsSiteName
 }
 
+// getOpenedxBaseDomain will return the domain the default host names are built under.
+func getOpenedxBaseDomain(cr *cachev1.Openedx) string {
+	baseDomain := common.OpenedxDefaultBaseDomain
+	if len(cr.Spec.BaseDomain) > 0 {
+		baseDomain = cr.Spec.BaseDomain
+	}
+	return baseDomain
+}
+
+// getOpenedxLmsHost will return the public host name of the LMS.
+func getOpenedxLmsHost(cr *cachev1.Openedx) string {
+	if len(cr.Spec.LmsHost) > 0 {
+		return cr.Spec.LmsHost
+	}
+	return "www." + getOpenedxLmsUrlName(cr) + "-openedx." + getOpenedxBaseDomain(cr)
+}
+
+// getOpenedxCmsHost will return the public host name of Studio.
+func getOpenedxCmsHost(cr *cachev1.Openedx) string {
+	if len(cr.Spec.StudioHost) > 0 {
+		return cr.Spec.StudioHost
+	}
+	return getOpenedxCmsUrlName(cr) + "." + getOpenedxLmsHost(cr)
+}
+
+// getOpenedxPreviewHost will return the public host name of the LMS preview.
+func getOpenedxPreviewHost(cr *cachev1.Openedx) string {
+	if len(cr.Spec.PreviewHost) > 0 {
+		return cr.Spec.PreviewHost
+	}
+	return "preview." + getOpenedxLmsHost(cr)
+}
+
+// getOpenedxComponents will return the topology of the components, never nil.
+func getOpenedxComponents(cr *cachev1.Openedx) *cachev1.ComponentsSpec {
+	if cr.Spec.Components != nil {
+		return cr.Spec.Components
+	}
+	return &cachev1.ComponentsSpec{}
+}
+
+// getOpenedxReplicas will return the replica count of a stateless component, defaulting to spec.size.
+func getOpenedxReplicas(cr *cachev1.Openedx, component *cachev1.ComponentSpec) int32 {
+	if component != nil && component.Replicas != nil {
+		return *component.Replicas
+	}
+	return cr.Spec.Size
+}
+
+// getOpenedxDatastoreReplicas will return the replica count of a datastore, which is pinned to 0 or 1.
+func getOpenedxDatastoreReplicas(datastore *cachev1.DatastoreSpec) int32 {
+	if datastore != nil && datastore.Replicas != nil && *datastore.Replicas == 0 {
+		return 0
+	}
+	return 1
+}
+
+// getOpenedxResources will return the resources of the main container of a component.
+func getOpenedxResources(component *cachev1.ComponentSpec) corev1.ResourceRequirements {
+	if component != nil {
+		return *component.Resources.DeepCopy()
+	}
+	return corev1.ResourceRequirements{}
+}
+
 // getOpenedxDefaultTitle will return cr for the title.
 func getOpenedxTitle(cr *cachev1.Openedx) string {
 	title := common.OpenedxDefaultTitle
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// The sync* helpers below copy the mutable fields of a desired object onto the
+// object found in the cluster and report whether anything changed. Fields the
+// API server refuses to update (selectors, PVC specs, Job templates, volume
+// claim templates) are left untouched so reconciling never thrashes against
+// immutable state.
+//
+// Comparisons use equality.Semantic.DeepDerivative so that values defaulted by
+// the API server (protocols, pull policies, default modes, ...) do not count as
+// drift. DeepDerivative ignores extra trailing list entries, so list lengths are
+// compared explicitly to catch hand-added containers, env vars or volumes.
+
+// mergeMap merges the desired entries into found and reports whether found changed.
+func mergeMap(found *map[string]string, desired map[string]string) bool {
+	changed := false
+	for k, v := range desired {
+		if cur, ok := (*found)[k]; ok && cur == v {
+			continue
+		}
+		if *found == nil {
+			*found = make(map[string]string, len(desired))
+		}
+		(*found)[k] = v
+		changed = true
+	}
+	return changed
+}
+
+func containersDiffer(desired, found []corev1.Container) bool {
+	if len(desired) != len(found) {
+		return true
+	}
+	for i := range desired {
+		d, f := desired[i], found[i]
+		if len(d.Args) != len(f.Args) ||
+			len(d.Command) != len(f.Command) ||
+			len(d.Env) != len(f.Env) ||
+			len(d.EnvFrom) != len(f.EnvFrom) ||
+			len(d.Ports) != len(f.Ports) ||
+			len(d.VolumeMounts) != len(f.VolumeMounts) {
+			return true
+		}
+		if !equality.Semantic.DeepDerivative(d, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// podTemplateDiffers reports whether the found pod template has drifted from the desired one.
+func podTemplateDiffers(desired, found *corev1.PodTemplateSpec) bool {
+	if containersDiffer(desired.Spec.Containers, found.Spec.Containers) ||
+		containersDiffer(desired.Spec.InitContainers, found.Spec.InitContainers) {
+		return true
+	}
+	if len(desired.Spec.Volumes) != len(found.Spec.Volumes) {
+		return true
+	}
+	if !equality.Semantic.DeepDerivative(desired.Spec, found.Spec) {
+		return true
+	}
+	return !equality.Semantic.DeepDerivative(desired.ObjectMeta.Labels, found.ObjectMeta.Labels) ||
+		!equality.Semantic.DeepDerivative(desired.ObjectMeta.Annotations, found.ObjectMeta.Annotations)
+}
+
+// syncDeployment brings found in line with desired, leaving the immutable selector alone.
+func syncDeployment(found, desired *appsv1.Deployment) bool {
+	changed := mergeMap(&found.ObjectMeta.Labels, desired.ObjectMeta.Labels)
+
+	if desired.Spec.Replicas != nil &&
+		(found.Spec.Replicas == nil || *found.Spec.Replicas != *desired.Spec.Replicas) {
+		replicas := *desired.Spec.Replicas
+		found.Spec.Replicas = &replicas
+		changed = true
+	}
+
+	if desired.Spec.Strategy.Type != "" && found.Spec.Strategy.Type != desired.Spec.Strategy.Type {
+		found.Spec.Strategy = *desired.Spec.Strategy.DeepCopy()
+		changed = true
+	}
+
+	if podTemplateDiffers(&desired.Spec.Template, &found.Spec.Template) {
+		// Keep annotations added by other tools, such as `kubectl rollout restart`.
+		annotations := found.Spec.Template.ObjectMeta.Annotations
+		found.Spec.Template = *desired.Spec.Template.DeepCopy()
+		mergeMap(&annotations, desired.Spec.Template.ObjectMeta.Annotations)
+		found.Spec.Template.ObjectMeta.Annotations = annotations
+		changed = true
+	}
+
+	return changed
+}
+
+// syncStatefulSet brings found in line with desired, leaving the immutable
+// selector, service name and volume claim templates alone.
+func syncStatefulSet(found, desired *appsv1.StatefulSet) bool {
+	changed := mergeMap(&found.ObjectMeta.Labels, desired.ObjectMeta.Labels)
+
+	if desired.Spec.Replicas != nil &&
+		(found.Spec.Replicas == nil || *found.Spec.Replicas != *desired.Spec.Replicas) {
+		replicas := *desired.Spec.Replicas
+		found.Spec.Replicas = &replicas
+		changed = true
+	}
+
+	if desired.Spec.UpdateStrategy.Type != "" && found.Spec.UpdateStrategy.Type != desired.Spec.UpdateStrategy.Type {
+		found.Spec.UpdateStrategy = *desired.Spec.UpdateStrategy.DeepCopy()
+		changed = true
+	}
+
+	if podTemplateDiffers(&desired.Spec.Template, &found.Spec.Template) {
+		// Keep annotations added by other tools, such as `kubectl rollout restart`.
+		annotations := found.Spec.Template.ObjectMeta.Annotations
+		found.Spec.Template = *desired.Spec.Template.DeepCopy()
+		mergeMap(&annotations, desired.Spec.Template.ObjectMeta.Annotations)
+		found.Spec.Template.ObjectMeta.Annotations = annotations
+		changed = true
+	}
+
+	return changed
+}
+
+// syncService brings found in line with desired, keeping the allocated cluster IP and node ports.
+func syncService(found, desired *corev1.Service) bool {
+	changed := mergeMap(&found.ObjectMeta.Labels, desired.ObjectMeta.Labels)
+
+	if !reflect.DeepEqual(found.Spec.Selector, desired.Spec.Selector) {
+		found.Spec.Selector = desired.Spec.Selector
+		changed = true
+	}
+
+	if desired.Spec.Type != "" && found.Spec.Type != desired.Spec.Type {
+		found.Spec.Type = desired.Spec.Type
+		changed = true
+	}
+
+	// Node ports left to the API server are kept, so they are not reallocated
+	// and do not count as drift.
+	ports := make([]corev1.ServicePort, len(desired.Spec.Ports))
+	copy(ports, desired.Spec.Ports)
+	for i := range ports {
+		if ports[i].NodePort != 0 {
+			continue
+		}
+		for _, p := range found.Spec.Ports {
+			if p.Port == ports[i].Port && p.Protocol == ports[i].Protocol {
+				ports[i].NodePort = p.NodePort
+			}
+		}
+	}
+	if len(found.Spec.Ports) != len(ports) ||
+		!equality.Semantic.DeepDerivative(ports, found.Spec.Ports) {
+		found.Spec.Ports = ports
+		changed = true
+	}
+
+	return changed
+}
+
+// syncConfigMap brings the data of found in line with desired.
+func syncConfigMap(found, desired *corev1.ConfigMap) bool {
+	changed := mergeMap(&found.ObjectMeta.Labels, desired.ObjectMeta.Labels)
+
+	if len(found.Data) != len(desired.Data) || !reflect.DeepEqual(found.Data, desired.Data) {
+		found.Data = desired.Data
+		changed = true
+	}
+
+	return changed
+}
+
+// syncIngress brings the rules of found in line with desired.
+func syncIngress(found, desired *extv1beta1.Ingress) bool {
+	changed := mergeMap(&found.ObjectMeta.Labels, desired.ObjectMeta.Labels)
+
+	if len(found.Spec.Rules) != len(desired.Spec.Rules) ||
+		len(found.Spec.TLS) != len(desired.Spec.TLS) ||
+		!equality.Semantic.DeepDerivative(desired.Spec, found.Spec) {
+		found.Spec = desired.Spec
+		changed = true
+	}
+
+	return changed
+}
+
+// syncHPA brings the scale target, limits and metrics of found in line with desired.
+func syncHPA(found, desired *autoscalingv2beta2.HorizontalPodAutoscaler) bool {
+	changed := mergeMap(&found.ObjectMeta.Labels, desired.ObjectMeta.Labels)
+
+	if len(found.Spec.Metrics) != len(desired.Spec.Metrics) ||
+		!equality.Semantic.DeepDerivative(desired.Spec, found.Spec) {
+		found.Spec = desired.Spec
+		changed = true
+	}
+
+	return changed
+}
+
+// syncPVC only reconciles metadata; the claim spec is immutable once bound.
+func syncPVC(found, desired *corev1.PersistentVolumeClaim) bool {
+	return mergeMap(&found.ObjectMeta.Labels, desired.ObjectMeta.Labels)
+}
+
+// syncJob only reconciles metadata; the pod template of a Job is immutable.
+func syncJob(found, desired *batchv1.Job) bool {
+	return mergeMap(&found.ObjectMeta.Labels, desired.ObjectMeta.Labels)
+}
+
+// syncCronJob brings the schedule and Job template of found in line with
+// desired. Unlike a Job, the template of a CronJob only applies to the Jobs
+// it creates next, so it can be updated.
+func syncCronJob(found, desired *batchv1beta1.CronJob) bool {
+	changed := mergeMap(&found.ObjectMeta.Labels, desired.ObjectMeta.Labels)
+
+	if found.Spec.Schedule != desired.Spec.Schedule ||
+		found.Spec.ConcurrencyPolicy != desired.Spec.ConcurrencyPolicy ||
+		!equality.Semantic.DeepEqual(found.Spec.Suspend, desired.Spec.Suspend) ||
+		!equality.Semantic.DeepEqual(found.Spec.StartingDeadlineSeconds, desired.Spec.StartingDeadlineSeconds) {
+		found.Spec.Schedule = desired.Spec.Schedule
+		found.Spec.ConcurrencyPolicy = desired.Spec.ConcurrencyPolicy
+		found.Spec.Suspend = desired.Spec.Suspend
+		found.Spec.StartingDeadlineSeconds = desired.Spec.StartingDeadlineSeconds
+		changed = true
+	}
+
+	if podTemplateDiffers(&desired.Spec.JobTemplate.Spec.Template, &found.Spec.JobTemplate.Spec.Template) ||
+		!equality.Semantic.DeepDerivative(desired.Spec.JobTemplate, found.Spec.JobTemplate) {
+		found.Spec.JobTemplate = *desired.Spec.JobTemplate.DeepCopy()
+		changed = true
+	}
+
+	return changed
+}
@@ -0,0 +1,427 @@
+package controllers
+
+import (
+	"testing"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// compareReconciler returns a reconciler building the objects of an Openedx.
+func compareReconciler(t *testing.T) (*OpenedxReconciler, *cachev1.Openedx) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := cachev1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	instance := &cachev1.Openedx{
+		ObjectMeta: metav1.ObjectMeta{Name: "openedx", Namespace: "openedx", UID: "uid"},
+		Spec: cachev1.OpenedxSpec{
+			Backup: &cachev1.BackupSpec{Schedule: "0 3 * * *"},
+		},
+	}
+	return &OpenedxReconciler{Log: ctrl.Log, Scheme: s}, instance
+}
+
+// applyServerDefaults sets the fields of a pod template the API server
+// defaults when the object is created.
+func applyServerDefaults(template *corev1.PodTemplateSpec) {
+	gracePeriod := int64(30)
+	mode := int32(0644)
+
+	spec := &template.Spec
+	if spec.RestartPolicy == "" {
+		spec.RestartPolicy = corev1.RestartPolicyAlways
+	}
+	spec.DNSPolicy = corev1.DNSClusterFirst
+	spec.SchedulerName = corev1.DefaultSchedulerName
+	spec.SecurityContext = &corev1.PodSecurityContext{}
+	spec.TerminationGracePeriodSeconds = &gracePeriod
+
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			c := &containers[i]
+			c.ImagePullPolicy = corev1.PullIfNotPresent
+			c.TerminationMessagePath = corev1.TerminationMessagePathDefault
+			c.TerminationMessagePolicy = corev1.TerminationMessageReadFile
+			for j := range c.Ports {
+				c.Ports[j].Protocol = corev1.ProtocolTCP
+			}
+		}
+	}
+	for i := range spec.Volumes {
+		if cm := spec.Volumes[i].ConfigMap; cm != nil {
+			cm.DefaultMode = &mode
+		}
+		if secret := spec.Volumes[i].Secret; secret != nil {
+			secret.DefaultMode = &mode
+		}
+	}
+}
+
+func TestSyncDeployment(t *testing.T) {
+	r, instance := compareReconciler(t)
+	replicas := int32(3)
+
+	tests := []struct {
+		name   string
+		update func(*appsv1.Deployment)
+		want   bool
+		check  func(*testing.T, *appsv1.Deployment)
+	}{
+		{"defaulted by the API server", func(d *appsv1.Deployment) {
+			revisions := int32(10)
+			deadline := int32(600)
+			d.Spec.RevisionHistoryLimit = &revisions
+			d.Spec.ProgressDeadlineSeconds = &deadline
+			d.Spec.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType}
+			applyServerDefaults(&d.Spec.Template)
+		}, false, nil},
+		{"foreign labels and annotations", func(d *appsv1.Deployment) {
+			d.Labels["team"] = "learning"
+			d.Annotations = map[string]string{"deployment.kubernetes.io/revision": "2"}
+			d.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "now"}
+		}, false, nil},
+		{"replicas", func(d *appsv1.Deployment) {
+			d.Spec.Replicas = &replicas
+		}, true, nil},
+		{"image", func(d *appsv1.Deployment) {
+			d.Spec.Template.Spec.Containers[0].Image = "openedx:edited"
+		}, true, nil},
+		{"extra container", func(d *appsv1.Deployment) {
+			d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, corev1.Container{Name: "debug", Image: "busybox"})
+		}, true, func(t *testing.T, d *appsv1.Deployment) {
+			if len(d.Spec.Template.Spec.Containers) != 1 {
+				t.Errorf("kept %d containers", len(d.Spec.Template.Spec.Containers))
+			}
+		}},
+		{"removed container", func(d *appsv1.Deployment) {
+			d.Spec.Template.Spec.Containers = nil
+		}, true, nil},
+		{"extra env var", func(d *appsv1.Deployment) {
+			c := &d.Spec.Template.Spec.Containers[0]
+			c.Env = append(c.Env, corev1.EnvVar{Name: "DEBUG", Value: "1"})
+		}, true, nil},
+		{"removed env var", func(d *appsv1.Deployment) {
+			c := &d.Spec.Template.Spec.Containers[0]
+			c.Env = c.Env[1:]
+		}, true, nil},
+		{"extra volume", func(d *appsv1.Deployment) {
+			d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, corev1.Volume{Name: "scratch"})
+		}, true, nil},
+		{"removed label", func(d *appsv1.Deployment) {
+			delete(d.Labels, "app")
+		}, true, nil},
+		{"restarted and edited", func(d *appsv1.Deployment) {
+			d.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "now"}
+			d.Spec.Template.Spec.Containers[0].Image = "openedx:edited"
+		}, true, func(t *testing.T, d *appsv1.Deployment) {
+			if d.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] != "now" {
+				t.Errorf("dropped the restart annotation: %v", d.Spec.Template.Annotations)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		desired := r.lmsDeployment(instance)
+		found := desired.DeepCopy()
+		tt.update(found)
+		foreign := found.DeepCopy()
+
+		if got := syncDeployment(found, desired); got != tt.want {
+			t.Errorf("%s: changed %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.want && podTemplateDiffers(&desired.Spec.Template, &found.Spec.Template) {
+			t.Errorf("%s: still differs after the sync", tt.name)
+		}
+		if syncDeployment(found, desired) {
+			t.Errorf("%s: changed again", tt.name)
+		}
+		if !equality.Semantic.DeepEqual(found.Spec.Selector, foreign.Spec.Selector) {
+			t.Errorf("%s: updated the selector", tt.name)
+		}
+		for k, v := range foreign.Annotations {
+			if found.Annotations[k] != v {
+				t.Errorf("%s: dropped the annotation %s", tt.name, k)
+			}
+		}
+		if foreign.Labels["team"] != "" && found.Labels["team"] != "learning" {
+			t.Errorf("%s: dropped a foreign label", tt.name)
+		}
+		if tt.check != nil {
+			tt.check(t, found)
+		}
+	}
+}
+
+func TestSyncStatefulSet(t *testing.T) {
+	r, instance := compareReconciler(t)
+
+	tests := []struct {
+		name    string
+		desired func(*appsv1.StatefulSet)
+		found   func(*appsv1.StatefulSet)
+		want    bool
+	}{
+		{"defaulted by the API server", nil, func(s *appsv1.StatefulSet) {
+			revisions := int32(10)
+			mode := corev1.PersistentVolumeFilesystem
+			s.Spec.RevisionHistoryLimit = &revisions
+			s.Spec.VolumeClaimTemplates[0].Spec.VolumeMode = &mode
+			s.Spec.VolumeClaimTemplates[0].Status.Phase = corev1.ClaimPending
+			applyServerDefaults(&s.Spec.Template)
+		}, false},
+		{"claim template size", func(s *appsv1.StatefulSet) {
+			s.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage] = resource.MustParse("50Gi")
+		}, nil, false},
+		{"claim template class", func(s *appsv1.StatefulSet) {
+			class := "fast"
+			s.Spec.VolumeClaimTemplates[0].Spec.StorageClassName = &class
+		}, nil, false},
+		{"selector", func(s *appsv1.StatefulSet) {
+			s.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "mysql"}}
+		}, nil, false},
+		{"service name", func(s *appsv1.StatefulSet) {
+			s.Spec.ServiceName = "mysql"
+		}, nil, false},
+		{"image", func(s *appsv1.StatefulSet) {
+			s.Spec.Template.Spec.Containers[0].Image = "mysql:8.0"
+		}, nil, true},
+		{"removed env var", nil, func(s *appsv1.StatefulSet) {
+			c := &s.Spec.Template.Spec.Containers[0]
+			c.Env = c.Env[1:]
+		}, true},
+		{"foreign labels", nil, func(s *appsv1.StatefulSet) {
+			s.Labels["team"] = "learning"
+			s.Annotations = map[string]string{"note": "kept"}
+		}, false},
+	}
+
+	for _, tt := range tests {
+		desired := r.mysqlStatefulSet(instance)
+		found := desired.DeepCopy()
+		if tt.found != nil {
+			tt.found(found)
+		}
+		if tt.desired != nil {
+			tt.desired(desired)
+		}
+		before := found.DeepCopy()
+
+		if got := syncStatefulSet(found, desired); got != tt.want {
+			t.Errorf("%s: changed %v, want %v", tt.name, got, tt.want)
+		}
+		if syncStatefulSet(found, desired) {
+			t.Errorf("%s: changed again", tt.name)
+		}
+
+		// The API server refuses to update these fields
+		if !equality.Semantic.DeepEqual(found.Spec.Selector, before.Spec.Selector) ||
+			found.Spec.ServiceName != before.Spec.ServiceName ||
+			!equality.Semantic.DeepEqual(found.Spec.VolumeClaimTemplates, before.Spec.VolumeClaimTemplates) {
+			t.Errorf("%s: updated an immutable field", tt.name)
+		}
+		if !equality.Semantic.DeepEqual(found.Annotations, before.Annotations) ||
+			(before.Labels["team"] != "" && found.Labels["team"] != "learning") {
+			t.Errorf("%s: dropped foreign metadata", tt.name)
+		}
+	}
+}
+
+func TestSyncService(t *testing.T) {
+	r, instance := compareReconciler(t)
+
+	// allocated sets the fields the API server allocates to a Service
+	allocated := func(s *corev1.Service) {
+		s.Spec.ClusterIP = "10.0.0.12"
+		s.Spec.SessionAffinity = corev1.ServiceAffinityNone
+		s.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyTypeCluster
+		s.Spec.Ports[0].NodePort = 31000
+	}
+
+	tests := []struct {
+		name   string
+		update func(*corev1.Service)
+		want   bool
+	}{
+		{"allocated by the API server", allocated, false},
+		{"foreign metadata", func(s *corev1.Service) {
+			allocated(s)
+			s.Labels["team"] = "learning"
+			s.Annotations = map[string]string{"note": "kept"}
+		}, false},
+		{"selector", func(s *corev1.Service) {
+			allocated(s)
+			s.Spec.Selector = map[string]string{"app": "other"}
+		}, true},
+		{"type", func(s *corev1.Service) {
+			allocated(s)
+			s.Spec.Type = corev1.ServiceTypeClusterIP
+		}, true},
+		{"target port", func(s *corev1.Service) {
+			allocated(s)
+			s.Spec.Ports[0].TargetPort.IntVal = 8080
+		}, true},
+		{"extra port", func(s *corev1.Service) {
+			allocated(s)
+			s.Spec.Ports = append(s.Spec.Ports, corev1.ServicePort{Port: 9000, Protocol: corev1.ProtocolTCP, NodePort: 31001})
+		}, true},
+	}
+
+	for _, tt := range tests {
+		desired := r.lmsService(instance)
+		found := desired.DeepCopy()
+		tt.update(found)
+		before := found.DeepCopy()
+
+		if got := syncService(found, desired); got != tt.want {
+			t.Errorf("%s: changed %v, want %v", tt.name, got, tt.want)
+		}
+		if syncService(found, desired) {
+			t.Errorf("%s: changed again", tt.name)
+		}
+		if found.Spec.ClusterIP != "10.0.0.12" {
+			t.Errorf("%s: cluster IP %q not kept", tt.name, found.Spec.ClusterIP)
+		}
+		if len(found.Spec.Ports) != 1 || found.Spec.Ports[0].NodePort != 31000 {
+			t.Errorf("%s: node port not kept: %+v", tt.name, found.Spec.Ports)
+		}
+		if !equality.Semantic.DeepEqual(found.Annotations, before.Annotations) ||
+			(before.Labels["team"] != "" && found.Labels["team"] != "learning") {
+			t.Errorf("%s: dropped foreign metadata", tt.name)
+		}
+	}
+}
+
+func TestSyncHPA(t *testing.T) {
+	r, instance := compareReconciler(t)
+	target := int32(70)
+	spec := &cachev1.AutoscalerSpec{MaxReplicas: 5, TargetCPUUtilizationPercentage: &target}
+
+	tests := []struct {
+		name   string
+		update func(*autoscalingv2beta2.HorizontalPodAutoscaler)
+		want   bool
+	}{
+		{"unchanged", func(*autoscalingv2beta2.HorizontalPodAutoscaler) {}, false},
+		{"foreign metadata", func(h *autoscalingv2beta2.HorizontalPodAutoscaler) {
+			h.Labels["team"] = "learning"
+			h.Annotations = map[string]string{"autoscaling.alpha.kubernetes.io/conditions": "[]"}
+		}, false},
+		{"max replicas", func(h *autoscalingv2beta2.HorizontalPodAutoscaler) {
+			h.Spec.MaxReplicas = 10
+		}, true},
+		{"extra metric", func(h *autoscalingv2beta2.HorizontalPodAutoscaler) {
+			h.Spec.Metrics = append(h.Spec.Metrics, utilizationMetric(corev1.ResourceMemory, 80))
+		}, true},
+		{"removed metric", func(h *autoscalingv2beta2.HorizontalPodAutoscaler) {
+			h.Spec.Metrics = nil
+		}, true},
+	}
+
+	for _, tt := range tests {
+		desired := r.horizontalPodAutoscaler(instance, lmsDeploymentName(instance), spec)
+		found := desired.DeepCopy()
+		tt.update(found)
+		before := found.DeepCopy()
+
+		if got := syncHPA(found, desired); got != tt.want {
+			t.Errorf("%s: changed %v, want %v", tt.name, got, tt.want)
+		}
+		if syncHPA(found, desired) {
+			t.Errorf("%s: changed again", tt.name)
+		}
+		if !equality.Semantic.DeepEqual(found.Annotations, before.Annotations) {
+			t.Errorf("%s: dropped foreign annotations", tt.name)
+		}
+	}
+}
+
+func TestSyncCronJob(t *testing.T) {
+	r, instance := compareReconciler(t)
+
+	tests := []struct {
+		name   string
+		update func(*batchv1beta1.CronJob)
+		want   bool
+	}{
+		{"defaulted by the API server", func(c *batchv1beta1.CronJob) {
+			succeeded, failed := int32(3), int32(1)
+			parallelism, completions := int32(1), int32(1)
+			c.Spec.SuccessfulJobsHistoryLimit = &succeeded
+			c.Spec.FailedJobsHistoryLimit = &failed
+			c.Spec.JobTemplate.Spec.Parallelism = &parallelism
+			c.Spec.JobTemplate.Spec.Completions = &completions
+			applyServerDefaults(&c.Spec.JobTemplate.Spec.Template)
+		}, false},
+		{"foreign metadata", func(c *batchv1beta1.CronJob) {
+			c.Labels["team"] = "learning"
+			c.Annotations = map[string]string{"note": "kept"}
+		}, false},
+		{"schedule", func(c *batchv1beta1.CronJob) {
+			c.Spec.Schedule = "0 4 * * *"
+		}, true},
+		{"suspended", func(c *batchv1beta1.CronJob) {
+			suspend := true
+			c.Spec.Suspend = &suspend
+		}, true},
+		{"backoff limit", func(c *batchv1beta1.CronJob) {
+			backoffLimit := int32(6)
+			c.Spec.JobTemplate.Spec.BackoffLimit = &backoffLimit
+		}, true},
+		{"removed container", func(c *batchv1beta1.CronJob) {
+			spec := &c.Spec.JobTemplate.Spec.Template.Spec
+			spec.Containers = spec.Containers[:1]
+		}, true},
+	}
+
+	for _, tt := range tests {
+		desired := r.backupCronJob(instance)
+		found := desired.DeepCopy()
+		tt.update(found)
+		before := found.DeepCopy()
+
+		if got := syncCronJob(found, desired); got != tt.want {
+			t.Errorf("%s: changed %v, want %v", tt.name, got, tt.want)
+		}
+		if syncCronJob(found, desired) {
+			t.Errorf("%s: changed again", tt.name)
+		}
+		if !equality.Semantic.DeepEqual(found.Annotations, before.Annotations) {
+			t.Errorf("%s: dropped foreign annotations", tt.name)
+		}
+	}
+}
+
+func TestSyncJob(t *testing.T) {
+	desired := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "lms-migrations", Labels: map[string]string{"app": "lms"}},
+		Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "lms", Image: "openedx"}},
+		}}},
+	}
+	found := desired.DeepCopy()
+	found.Spec.Template.Spec.Containers[0].Image = "openedx:edited"
+
+	// The pod template of a Job is immutable
+	if syncJob(found, desired) || found.Spec.Template.Spec.Containers[0].Image != "openedx:edited" {
+		t.Errorf("updated the pod template of a Job")
+	}
+	delete(found.Labels, "app")
+	if !syncJob(found, desired) || found.Labels["app"] != "lms" {
+		t.Errorf("did not restore the labels of a Job")
+	}
+}
@@ -24,6 +24,7 @@ func getDemoContainerEnv(cr *cachev1.Openedx) []corev1.EnvVar {
 		Name:  "SERVICE_VARIANT",
 		Value: "cms",
 	})
+	env = append(env, getOpenedxSecretEnv(cr)...)
 
 	return env
 }
@@ -34,7 +35,7 @@ func newDemoJob(instance *cachev1.Openedx) *batchv1.Job {
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      demoJobName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 	}
@@ -52,7 +53,7 @@ func newDemoPodSpec(cr *cachev1.Openedx) corev1.PodSpec {
 		{
 			Command:         cmd,
 			Env:             getDemoContainerEnv(cr),
-			Image:           "docker.io/overhangio/openedx:11.2.3",
+			Image:           getOpenedxImage(cr),
 			ImagePullPolicy: corev1.PullAlways,
 			Name:            "init-clone-democourse",
 			VolumeMounts: []corev1.VolumeMount{
@@ -83,7 +84,7 @@ func newDemoPodSpec(cr *cachev1.Openedx) corev1.PodSpec {
 				"../coursedata",
 			},
 			Env:             getDemoContainerEnv(cr),
-			Image:           "docker.io/overhangio/openedx:11.2.3",
+			Image:           getOpenedxImage(cr),
 			ImagePullPolicy: corev1.PullAlways,
 			Name:            "init-import-democourse",
 			VolumeMounts: []corev1.VolumeMount{
@@ -116,7 +117,7 @@ func newDemoPodSpec(cr *cachev1.Openedx) corev1.PodSpec {
 			"--setup",
 		},
 		Env:             getDemoContainerEnv(cr),
-		Image:           "docker.io/overhangio/openedx:11.2.3",
+		Image:           getOpenedxImage(cr),
 		ImagePullPolicy: corev1.PullAlways,
 		Name:            "reindex-course",
 		VolumeMounts: []corev1.VolumeMount{
@@ -173,6 +174,7 @@ func newDemoPodSpec(cr *cachev1.Openedx) corev1.PodSpec {
 		},
 	}
 
+	mountSearchCA(cr, &pod)
 	return pod
 }
 
@@ -182,7 +184,7 @@ func newDemoPodTemplateSpec(cr *cachev1.Openedx) corev1.PodTemplateSpec {
 	return corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      demoJobName(cr),
-			Namespace: cr.Namespace,
+			Namespace: getOpenedxNamespace(cr),
 			Labels:    labels,
 		},
 		Spec: newDemoPodSpec(cr),
@@ -203,7 +205,7 @@ func (r *OpenedxReconciler) isDemoJobDone(instance *cachev1.Openedx) bool {
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      demoJobName(instance),
-		Namespace: instance.Namespace,
+		Namespace: getOpenedxNamespace(instance),
 	}, job)
 
 	if err != nil {
@@ -2,9 +2,15 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/prometheus/common/log"
 	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	"github.com/rocrisp/openedx-operator/render"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -14,9 +20,22 @@ import (
 )
 
 const elasticsearchPort = 9200
-const elasticsearchImage = "docker.io/elasticsearch:1.5.2"
+const elasticsearchHeap = "1g"
+const elasticsearchStorage = "2Gi"
 
-func elasticsearchDeploymentName(elasticsearch *cachev1.Openedx) string {
+// Keys of the Secrets of an external search cluster.
+const (
+	searchUsernameKey = "username"
+	searchPasswordKey = "password"
+	searchAPIKeyKey   = "api-key"
+	searchCAKey       = "ca.crt"
+)
+
+// searchCAMountPath is where the CA bundle of an external search cluster is
+// mounted in the Django pods.
+const searchCAMountPath = "/openedx/search-ca"
+
+func elasticsearchStatefulSetName(elasticsearch *cachev1.Openedx) string {
 	return elasticsearch.Name + "-elasticsearch"
 }
 
@@ -24,87 +43,309 @@ func elasticsearchServiceName(elasticsearch *cachev1.Openedx) string {
 	return "elasticsearch"
 }
 
-func elasticsearchAuthName() string {
-	return "elasticsearch-auth"
+// getOpenedxExternalSearch returns the external search cluster, or nil when
+// search runs in the cluster.
+func getOpenedxExternalSearch(cr *cachev1.Openedx) *cachev1.ExternalSearchSpec {
+	if cr.Spec.Search == nil {
+		return nil
+	}
+	return cr.Spec.Search.External
 }
 
-func (r *OpenedxReconciler) elasticsearchAuthSecret(d *cachev1.Openedx) *corev1.Secret {
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      elasticsearchAuthName(),
-			Namespace: d.Namespace,
-		},
-		Type: "Opaque",
-		StringData: map[string]string{
-			"username": "root",
-			"password": "cakephp",
+// getOpenedxInClusterSearch will return the in-cluster search settings. It never returns nil.
+func getOpenedxInClusterSearch(cr *cachev1.Openedx) *cachev1.InClusterSearchSpec {
+	if cr.Spec.Search == nil || cr.Spec.Search.InCluster == nil {
+		return &cachev1.InClusterSearchSpec{}
+	}
+	return cr.Spec.Search.InCluster
+}
+
+// getOpenedxSearchDistribution defaults the distribution of the in-cluster search to Elasticsearch.
+func getOpenedxSearchDistribution(cr *cachev1.Openedx) cachev1.SearchDistribution {
+	if d := getOpenedxInClusterSearch(cr).Distribution; len(d) > 0 {
+		return d
+	}
+	return cachev1.SearchElasticsearch
+}
+
+// getOpenedxSearchImage will return the image of the in-cluster search, the
+// Elasticsearch of the release unless the spec sets one.
+func getOpenedxSearchImage(cr *cachev1.Openedx) string {
+	if image := getOpenedxInClusterSearch(cr).Image; len(image) > 0 {
+		return image
+	}
+	return getOpenedxDatastoreRelease(cr).elasticsearchImage
+}
+
+// getSearchDataDir will return the directory of the data volume the
+// in-cluster search of a release keeps its indices in, "" for the root of the
+// volume. An image set by the spec keeps its indices across releases.
+func getSearchDataDir(cr *cachev1.Openedx, rel release) string {
+	if len(getOpenedxInClusterSearch(cr).Image) > 0 {
+		return ""
+	}
+	return rel.searchDataDir
+}
+
+// getOpenedxSearchHeap will return the JVM heap size of the in-cluster search.
+func getOpenedxSearchHeap(cr *cachev1.Openedx) string {
+	if heap := getOpenedxInClusterSearch(cr).Heap; len(heap) > 0 {
+		return heap
+	}
+	return elasticsearchHeap
+}
+
+// getOpenedxSearchStorage will return the size of the data volume of the in-cluster search.
+func getOpenedxSearchStorage(cr *cachev1.Openedx) string {
+	if storage := getOpenedxInClusterSearch(cr).Storage; storage != nil {
+		return storage.String()
+	}
+	return elasticsearchStorage
+}
+
+// getOpenedxSearchURL will return the URL of the search cluster.
+func getOpenedxSearchURL(cr *cachev1.Openedx) string {
+	if search := getOpenedxExternalSearch(cr); search != nil {
+		return strings.TrimRight(search.URL, "/")
+	}
+	return fmt.Sprintf("http://%s:%d", elasticsearchServiceName(cr), elasticsearchPort)
+}
+
+// parseSearchURL splits the URL of a search cluster into the parts of an
+// ELASTIC_SEARCH_CONFIG entry. The port defaults to the one of the scheme.
+func parseSearchURL(raw string) (tls bool, host string, port int32, prefix string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false, "", 0, "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false, "", 0, "", fmt.Errorf("scheme must be http or https")
+	}
+	if len(u.Hostname()) == 0 {
+		return false, "", 0, "", fmt.Errorf("missing host")
+	}
+	if u.User != nil || len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+		return false, "", 0, "", fmt.Errorf("credentials, query and fragment are not supported")
+	}
+
+	tls = u.Scheme == "https"
+	port = 80
+	if tls {
+		port = 443
+	}
+	if p := u.Port(); len(p) > 0 {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil || n == 0 {
+			return false, "", 0, "", fmt.Errorf("invalid port %s", p)
+		}
+		port = int32(n)
+	}
+	return tls, u.Hostname(), port, strings.TrimRight(u.Path, "/"), nil
+}
+
+// getOpenedxRenderElasticsearch returns the search cluster of the settings of the LMS and CMS.
+func getOpenedxRenderElasticsearch(cr *cachev1.Openedx) render.Elasticsearch {
+	search := getOpenedxExternalSearch(cr)
+	if search == nil {
+		return render.Elasticsearch{
+			Host: elasticsearchServiceName(cr),
+			Port: elasticsearchPort,
+		}
+	}
+
+	// The URL is validated before anything is rendered.
+	tls, host, port, prefix, _ := parseSearchURL(search.URL)
+	es := render.Elasticsearch{
+		Host:      host,
+		Port:      port,
+		TLS:       tls,
+		URLPrefix: prefix,
+		BasicAuth: len(search.BasicAuthSecret) > 0,
+		APIKey:    len(search.APIKeySecret) > 0,
+	}
+	if len(search.CASecret) > 0 {
+		es.CACerts = searchCAMountPath + "/" + searchCAKey
+	}
+	return es
+}
+
+// getOpenedxSearchSecrets returns the Secrets of the external search cluster
+// named in the spec. They are always provided by the user.
+func getOpenedxSearchSecrets(cr *cachev1.Openedx) []string {
+	search := getOpenedxExternalSearch(cr)
+	if search == nil {
+		return nil
+	}
+	names := []string{}
+	for _, name := range []string{search.BasicAuthSecret, search.APIKeySecret, search.CASecret} {
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// getOpenedxSearchEnv returns the credentials of the search cluster read by the Django settings.
+func getOpenedxSearchEnv(cr *cachev1.Openedx) []corev1.EnvVar {
+	search := getOpenedxExternalSearch(cr)
+	if search == nil {
+		return nil
+	}
+	env := []corev1.EnvVar{}
+	if len(search.BasicAuthSecret) > 0 {
+		env = append(env,
+			secretEnvVar("OPENEDX_ELASTICSEARCH_USERNAME", search.BasicAuthSecret, searchUsernameKey),
+			secretEnvVar("OPENEDX_ELASTICSEARCH_PASSWORD", search.BasicAuthSecret, searchPasswordKey),
+		)
+	}
+	if len(search.APIKeySecret) > 0 {
+		env = append(env, secretEnvVar("OPENEDX_ELASTICSEARCH_API_KEY", search.APIKeySecret, searchAPIKeyKey))
+	}
+	return env
+}
+
+// mountSearchCA mounts the CA bundle of the external search cluster in every
+// container of a Django pod.
+func mountSearchCA(cr *cachev1.Openedx, pod *corev1.PodSpec) {
+	search := getOpenedxExternalSearch(cr)
+	if search == nil || len(search.CASecret) == 0 {
+		return
+	}
+
+	pod.Volumes = append(pod.Volumes, corev1.Volume{
+		Name: "search-ca",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: search.CASecret,
+				Items:      []corev1.KeyToPath{{Key: searchCAKey, Path: searchCAKey}},
+			},
 		},
+	})
+	mount := corev1.VolumeMount{
+		Name:      "search-ca",
+		MountPath: searchCAMountPath,
+		ReadOnly:  true,
+	}
+	for i := range pod.InitContainers {
+		pod.InitContainers[i].VolumeMounts = append(pod.InitContainers[i].VolumeMounts, mount)
+	}
+	for i := range pod.Containers {
+		pod.Containers[i].VolumeMounts = append(pod.Containers[i].VolumeMounts, mount)
 	}
-	controllerutil.SetControllerReference(d, secret, r.Scheme)
-	return secret
 }
 
-func (r *OpenedxReconciler) elasticsearchDeployment(instance *cachev1.Openedx) *appsv1.Deployment {
+// getForumSearchEnv returns the search cluster of the forum. The entrypoint of
+// the image waits for SEARCH_SERVER to answer HTTP requests successfully, which
+// an authenticated cluster does not do, so it is given a TCP address to wait
+// for and the URL is passed as FORUM_SEARCH_SERVER, exported again by forumArgs.
+// The basic auth credentials are expanded by Kubernetes into the URL.
+func getForumSearchEnv(cr *cachev1.Openedx) []corev1.EnvVar {
+	search := getOpenedxExternalSearch(cr)
+	if search == nil {
+		return []corev1.EnvVar{
+			{Name: "SEARCH_SERVER", Value: getOpenedxSearchURL(cr)},
+			{Name: "FORUM_SEARCH_SERVER", Value: getOpenedxSearchURL(cr)},
+		}
+	}
+
+	tls, host, port, prefix, _ := parseSearchURL(search.URL)
+	scheme, auth := "http", ""
+	if tls {
+		scheme = "https"
+	}
+	env := []corev1.EnvVar{
+		{Name: "SEARCH_SERVER", Value: "tcp://" + net.JoinHostPort(host, strconv.Itoa(int(port)))},
+	}
+	if len(search.BasicAuthSecret) > 0 {
+		env = append(env,
+			secretEnvVar("SEARCH_USERNAME", search.BasicAuthSecret, searchUsernameKey),
+			secretEnvVar("SEARCH_PASSWORD", search.BasicAuthSecret, searchPasswordKey),
+		)
+		auth = "$(SEARCH_USERNAME):$(SEARCH_PASSWORD)@"
+	}
+	if len(search.CASecret) > 0 {
+		env = append(env, corev1.EnvVar{Name: "SSL_CERT_FILE", Value: searchCAMountPath + "/" + searchCAKey})
+	}
+	url := scheme + "://" + auth + net.JoinHostPort(host, strconv.Itoa(int(port))) + prefix
+	return append(env, corev1.EnvVar{Name: "FORUM_SEARCH_SERVER", Value: url})
+}
+
+func (r *OpenedxReconciler) elasticsearchStatefulSet(instance *cachev1.Openedx) *appsv1.StatefulSet {
 	labels := labels(instance, "elasticsearch")
-	size := instance.Spec.Size
+	size := getOpenedxDatastoreReplicas(getOpenedxComponents(instance).Elasticsearch)
 
-	deployment := &appsv1.Deployment{
+	data := corev1.VolumeMount{
+		Name:      datastoreClaimName,
+		MountPath: fmt.Sprintf("/usr/share/%s/data", getOpenedxSearchDistribution(instance)),
+		SubPath:   getSearchDataDir(instance, getOpenedxDatastoreRelease(instance)),
+	}
+
+	template := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      elasticsearchDeploymentName(instance),
-			Namespace: instance.Namespace,
-			Labels:    labels,
+			Labels: labels,
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &size,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{{
-						Name: "data",
-						VolumeSource: corev1.VolumeSource{
-							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-								ClaimName: "elasticsearch",
-							},
-						},
-					}},
-					Containers: []corev1.Container{{
-						Image: elasticsearchImage,
-						Name:  "elasticsearch",
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: elasticsearchPort,
-							Name:          "elasticsearch",
-						}},
-						VolumeMounts: []corev1.VolumeMount{{
-							Name:      "data",
-							MountPath: "/usr/share/elasticsearch/data",
-						}},
-						Env: []corev1.EnvVar{
-							{
-								Name:  "ES_JAVA_OPTS",
-								Value: "-Xms1g -Xmx1g",
-							},
-							{
-								Name:  "cluster.name",
-								Value: "openedx",
-							},
-							{
-								Name:  "bootstrap.memory_lock",
-								Value: "true",
-							},
-						},
-					}},
-				},
-			},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image: getOpenedxSearchImage(instance),
+				Name:  "elasticsearch",
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: elasticsearchPort,
+					Name:          "elasticsearch",
+				}},
+				VolumeMounts: []corev1.VolumeMount{data},
+				Env:          searchEnv(instance),
+			}},
+		},
+	}
+
+	if len(data.SubPath) > 0 {
+		// The kubelet creates the directory owned by root, Elasticsearch runs as
+		// user 1000 of group 0
+		root := int64(0)
+		template.Spec.InitContainers = []corev1.Container{{
+			Command:         []string{"chown", "1000:0", data.MountPath},
+			Image:           getOpenedxSearchImage(instance),
+			Name:            "data",
+			SecurityContext: &corev1.SecurityContext{RunAsUser: &root},
+			VolumeMounts:    []corev1.VolumeMount{data},
+		}}
+	}
+
+	statefulSet := datastoreStatefulSet(instance, elasticsearchStatefulSetName(instance), elasticsearchServiceName(instance), size, "elasticsearch", template)
+	controllerutil.SetControllerReference(instance, statefulSet, r.Scheme)
+	return statefulSet
+}
+
+// searchEnv returns the settings of the in-cluster search node. Versions after
+// Elasticsearch 1.5 read the dotted variables as settings; the single node
+// discovery skips the production bootstrap checks. The security plugin of
+// OpenSearch is disabled; Elasticsearch 8 needs xpack.security.enabled=false
+// from the Env of the spec.
+func searchEnv(cr *cachev1.Openedx) []corev1.EnvVar {
+	heap := getOpenedxSearchHeap(cr)
+	env := []corev1.EnvVar{
+		{
+			Name:  "cluster.name",
+			Value: "openedx",
+		},
+		{
+			Name:  "bootstrap.memory_lock",
+			Value: "true",
+		},
+		{
+			Name:  "discovery.type",
+			Value: "single-node",
 		},
 	}
 
-	controllerutil.SetControllerReference(instance, deployment, r.Scheme)
-	return deployment
+	if getOpenedxSearchDistribution(cr) == cachev1.SearchOpenSearch {
+		return append(append(env,
+			corev1.EnvVar{Name: "OPENSEARCH_JAVA_OPTS", Value: fmt.Sprintf("-Xms%s -Xmx%s", heap, heap)},
+			corev1.EnvVar{Name: "DISABLE_SECURITY_PLUGIN", Value: "true"},
+		), getOpenedxInClusterSearch(cr).Env...)
+	}
+	env = append([]corev1.EnvVar{{Name: "ES_JAVA_OPTS", Value: fmt.Sprintf("-Xms%s -Xmx%s", heap, heap)}}, env...)
+	return append(env, getOpenedxInClusterSearch(cr).Env...)
 }
 
 func (r *OpenedxReconciler) elasticsearchService(instance *cachev1.Openedx) *corev1.Service {
@@ -113,7 +354,7 @@ func (r *OpenedxReconciler) elasticsearchService(instance *cachev1.Openedx) *cor
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      elasticsearchServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -131,22 +372,26 @@ func (r *OpenedxReconciler) elasticsearchService(instance *cachev1.Openedx) *cor
 	return service
 }
 
-// Returns whether or not the elasticsearch deployment is running
+// Returns whether or not the elasticsearch StatefulSet is running
+// An external search cluster is assumed to be up.
 func (r *OpenedxReconciler) iselasticsearchUp(instance *cachev1.Openedx) bool {
+	if getOpenedxExternalSearch(instance) != nil {
+		return true
+	}
 
-	deployment := &appsv1.Deployment{}
+	statefulSet := &appsv1.StatefulSet{}
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
-		Name:      elasticsearchDeploymentName(instance),
-		Namespace: instance.Namespace,
-	}, deployment)
+		Name:      elasticsearchStatefulSetName(instance),
+		Namespace: getOpenedxNamespace(instance),
+	}, statefulSet)
 
 	if err != nil {
-		log.Error(err, "Deployment elasticsearch not found")
+		log.Error(err, "StatefulSet elasticsearch not found")
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if statefulSet.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
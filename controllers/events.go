@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// eventInterval is how long an event is not emitted again, so that the
+// reconciles requeued while nothing changes do not repeat it.
+const eventInterval = 10 * time.Minute
+
+// eventKey identifies an event of an Openedx.
+type eventKey struct {
+	uid       types.UID
+	eventType string
+	reason    string
+	message   string
+}
+
+// recentEvents records when each event was last emitted. It is shared by the
+// steps of a reconcile, which run in parallel, and by the reconcilers.
+var recentEvents = struct {
+	sync.Mutex
+	emitted map[eventKey]time.Time
+}{emitted: make(map[eventKey]time.Time)}
+
+// event emits an event about the Openedx, unless the same event was emitted
+// in the last eventInterval.
+func (r *OpenedxReconciler) event(instance *cachev1.Openedx, eventType, reason, message string) {
+	if r.Recorder == nil {
+		return
+	}
+
+	key := eventKey{uid: instance.UID, eventType: eventType, reason: reason, message: message}
+	now := time.Now()
+
+	recentEvents.Lock()
+	for k, emitted := range recentEvents.emitted {
+		if now.Sub(emitted) >= eventInterval {
+			delete(recentEvents.emitted, k)
+		}
+	}
+	_, recent := recentEvents.emitted[key]
+	if !recent {
+		recentEvents.emitted[key] = now
+	}
+	recentEvents.Unlock()
+
+	if !recent {
+		r.Recorder.Event(instance, eventType, reason, message)
+	}
+}
+
+// recordCreate emits the event of creating an object of the platform.
+func (r *OpenedxReconciler) recordCreate(instance *cachev1.Openedx, kind, name string, err error) {
+	if err != nil {
+		r.event(instance, corev1.EventTypeWarning, "CreateFailed", fmt.Sprintf("Failed to create %s %s: %v", kind, name, err))
+		return
+	}
+	r.event(instance, corev1.EventTypeNormal, "Created", fmt.Sprintf("Created %s %s", kind, name))
+}
+
+// recordJobStart emits the event of starting a Job of the platform.
+func (r *OpenedxReconciler) recordJobStart(instance *cachev1.Openedx, name string, err error) {
+	if err != nil {
+		r.recordCreate(instance, "Job", name, err)
+		return
+	}
+	r.event(instance, corev1.EventTypeNormal, "JobStarted", fmt.Sprintf("Started Job %s", name))
+}
+
+// recordUpdate emits the event of bringing an object of the platform back to
+// its desired state.
+func (r *OpenedxReconciler) recordUpdate(instance *cachev1.Openedx, kind, name string, err error) {
+	if err != nil {
+		r.event(instance, corev1.EventTypeWarning, "UpdateFailed", fmt.Sprintf("Failed to update %s %s: %v", kind, name, err))
+		return
+	}
+	r.event(instance, corev1.EventTypeNormal, "Updated", fmt.Sprintf("Updated %s %s", kind, name))
+}
+
+// recordTransitions emits the events of the changes between the previous
+// status of the Openedx and the one observed: the components, datastores
+// included, getting ready or going down, and the platform changing phase.
+func (r *OpenedxReconciler) recordTransitions(instance *cachev1.Openedx, previous, status *cachev1.OpenedxStatus) {
+	for _, name := range append(datastoreComponents, webComponents...) {
+		state, ok := status.Components[name]
+		if !ok || state == previous.Components[name] {
+			continue
+		}
+		switch {
+		case state == cachev1.ComponentReady:
+			r.event(instance, corev1.EventTypeNormal, "ComponentReady", name+" is ready")
+		case previous.Components[name] == cachev1.ComponentReady:
+			r.event(instance, corev1.EventTypeWarning, "ComponentNotReady", name+" is not ready anymore")
+		}
+	}
+
+	if status.Phase != previous.Phase {
+		eventType := corev1.EventTypeNormal
+		if status.Phase == cachev1.PhaseDegraded {
+			eventType = corev1.EventTypeWarning
+		}
+		message := fmt.Sprintf("Platform is %s", status.Phase)
+		if len(previous.Phase) > 0 {
+			message = fmt.Sprintf("Platform went from %s to %s", previous.Phase, status.Phase)
+		}
+		r.event(instance, eventType, string(status.Phase), message)
+	}
+
+	before := findCondition(previous.Conditions, cachev1.ConditionDemoCourseImported)
+	after := findCondition(status.Conditions, cachev1.ConditionDemoCourseImported)
+	if after != nil && after.Status == corev1.ConditionTrue && (before == nil || before.Status != corev1.ConditionTrue) {
+		r.event(instance, corev1.EventTypeNormal, "DemoCourseImported", "Demo course imported")
+	}
+}
@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/log"
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// openedxFinalizer holds the deletion of an Openedx until its data has been
+// handled as its deletion policy says, and the objects owner references
+// cannot cover have been removed.
+const openedxFinalizer = "cache.operatortrain.me/finalizer"
+
+// volumeSnapshotGVK is the VolumeSnapshot of the CSI external snapshotter,
+// whose types are not part of client-go.
+var volumeSnapshotGVK = schema.GroupVersionKind{
+	Group:   "snapshot.storage.k8s.io",
+	Version: "v1beta1",
+	Kind:    "VolumeSnapshot",
+}
+
+// getOpenedxDeletionPolicy will return what happens to the data of the platform when it is deleted.
+func getOpenedxDeletionPolicy(cr *cachev1.Openedx) cachev1.DeletionPolicy {
+	if len(cr.Spec.DeletionPolicy) > 0 {
+		return cr.Spec.DeletionPolicy
+	}
+	return cachev1.DeletionPolicyDelete
+}
+
+// finalizeOpenedx tears the platform down once the Openedx is deleted. The
+// volume claims and generated Secrets are snapshotted, orphaned or left to
+// the garbage collector, then the objects created in another namespace are
+// deleted, and the finalizer is removed.
+func (r *OpenedxReconciler) finalizeOpenedx(instance *cachev1.Openedx) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(instance, openedxFinalizer) {
+		return reconcile.Result{}, nil
+	}
+
+	policy := getOpenedxDeletionPolicy(instance)
+	r.Log.Info("Finalizing Openedx with deletion policy " + string(policy))
+
+	if policy == cachev1.DeletionPolicySnapshot {
+		ready, err := r.snapshotVolumes(instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if !ready {
+			// The claims are only deleted once their snapshots are usable
+			delay := time.Second * time.Duration(10)
+
+			r.Log.Info(fmt.Sprintf("VolumeSnapshots are not ready to use yet, waiting for %s", delay))
+			return reconcile.Result{RequeueAfter: delay}, nil
+		}
+	}
+
+	switch policy {
+	case cachev1.DeletionPolicyRetain:
+		if err := r.orphanData(instance, &corev1.PersistentVolumeClaimList{}, &corev1.SecretList{}); err != nil {
+			return reconcile.Result{}, err
+		}
+	case cachev1.DeletionPolicySnapshot:
+		// The snapshots are only restorable with the credentials of their databases
+		if err := r.orphanData(instance, &corev1.SecretList{}); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if err := r.deleteForeignObjects(instance, policy); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(instance, openedxFinalizer)
+	return reconcile.Result{}, r.Client.Update(context.TODO(), instance)
+}
+
+// ensureFinalizer adds the finalizer to an Openedx that does not have it yet.
+func (r *OpenedxReconciler) ensureFinalizer(instance *cachev1.Openedx) error {
+	if controllerutil.ContainsFinalizer(instance, openedxFinalizer) {
+		return nil
+	}
+
+	controllerutil.AddFinalizer(instance, openedxFinalizer)
+	return r.Client.Update(context.TODO(), instance)
+}
+
+// listOwned returns the objects of list, in the namespace, created for instance.
+func (r *OpenedxReconciler) listOwned(instance *cachev1.Openedx, namespace string, list runtime.Object) ([]runtime.Object, error) {
+	if err := r.Client.List(context.TODO(), list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make([]runtime.Object, 0, len(items))
+	for _, item := range items {
+		obj, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		if isOwnedBy(instance, obj) {
+			owned = append(owned, item)
+		}
+	}
+	return owned, nil
+}
+
+// orphanData removes the ownership of instance from the objects of the lists,
+// its volume claims or generated Secrets, so neither the garbage collector
+// nor deleteForeignObjects deletes them.
+func (r *OpenedxReconciler) orphanData(instance *cachev1.Openedx, lists ...runtime.Object) error {
+	for _, list := range lists {
+		items, err := r.listOwned(instance, getOpenedxNamespace(instance), list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			obj, _ := meta.Accessor(item)
+
+			refs := make([]metav1.OwnerReference, 0)
+			for _, ref := range obj.GetOwnerReferences() {
+				if ref.UID != instance.UID {
+					refs = append(refs, ref)
+				}
+			}
+			obj.SetOwnerReferences(refs)
+			annotations := obj.GetAnnotations()
+			delete(annotations, ownerAnnotation)
+			obj.SetAnnotations(annotations)
+
+			log.Info("Orphaning ", obj.GetNamespace(), "/", obj.GetName())
+			if err := r.Client.Update(context.TODO(), item); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteForeignObjects deletes what was created for instance outside its
+// namespace, which owner references cannot cover. A namespace created by the
+// operator is deleted as a whole, unless the data it holds is retained or
+// snapshotted.
+func (r *OpenedxReconciler) deleteForeignObjects(instance *cachev1.Openedx, policy cachev1.DeletionPolicy) error {
+	namespace := getOpenedxNamespace(instance)
+	if namespace == instance.Namespace {
+		return nil
+	}
+
+	ns := &corev1.Namespace{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: namespace}, ns)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	createdNamespace := isOwnedBy(instance, ns)
+
+	if createdNamespace && policy == cachev1.DeletionPolicyDelete {
+		log.Info("Deleting namespace : ", namespace)
+		err = r.Client.Delete(context.TODO(), ns, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	lists := []runtime.Object{
+		&appsv1.DeploymentList{},
+		&appsv1.StatefulSetList{},
+		&batchv1.JobList{},
+		&autoscalingv2beta2.HorizontalPodAutoscalerList{},
+		&extv1beta1.IngressList{},
+		&corev1.ServiceList{},
+		&corev1.ConfigMapList{},
+	}
+	if policy == cachev1.DeletionPolicyDelete {
+		lists = append(lists, &corev1.SecretList{})
+	}
+	if policy != cachev1.DeletionPolicyRetain {
+		lists = append(lists, &corev1.PersistentVolumeClaimList{})
+	}
+	for _, list := range lists {
+		items, err := r.listOwned(instance, namespace, list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			obj, _ := meta.Accessor(item)
+			log.Info("Deleting ", obj.GetNamespace(), "/", obj.GetName())
+
+			err = r.Client.Delete(context.TODO(), item, client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	if createdNamespace {
+		// The namespace now only holds the retained data or the snapshots, leave it to the user
+		delete(ns.Annotations, ownerAnnotation)
+		log.Info("Releasing namespace : ", namespace)
+		return r.Client.Update(context.TODO(), ns)
+	}
+	return nil
+}
+
+// snapshotVolumes takes a VolumeSnapshot of every volume claim the deletion
+// removes, and reports whether they are all ready to use. The snapshots are
+// not owned by the Openedx, so they outlive it.
+func (r *OpenedxReconciler) snapshotVolumes(instance *cachev1.Openedx) (bool, error) {
+	ready := true
+	for _, vol := range r.getOpenedxVolumes(instance) {
+		if vol.existing || getOpenedxVolume(instance, vol.name).RetainOnDelete {
+			continue
+		}
+
+		claim := &corev1.PersistentVolumeClaim{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{
+			Name:      vol.claimName,
+			Namespace: getOpenedxNamespace(instance),
+		}, claim)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+
+		snapshot, err := r.ensureVolumeSnapshot(instance, claim)
+		if err != nil {
+			return false, err
+		}
+		readyToUse, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		if !readyToUse {
+			if msg, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+				log.Info("VolumeSnapshot ", snapshot.GetName(), " failed : ", msg)
+			}
+			ready = false
+		}
+	}
+	return ready, nil
+}
+
+// ensureVolumeSnapshot returns the final snapshot of the claim, creating it
+// when it does not exist.
+func (r *OpenedxReconciler) ensureVolumeSnapshot(instance *cachev1.Openedx,
+	claim *corev1.PersistentVolumeClaim,
+) (*unstructured.Unstructured, error) {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      claim.Name + "-final",
+		Namespace: claim.Namespace,
+	}, snapshot)
+	if err == nil {
+		return snapshot, nil
+	} else if meta.IsNoMatchError(err) {
+		return nil, fmt.Errorf("the VolumeSnapshot API is not installed, use another deletion policy: %v", err)
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	snapshot = &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	snapshot.SetName(claim.Name + "-final")
+	snapshot.SetNamespace(claim.Namespace)
+	snapshot.SetLabels(labels(instance, "snapshot"))
+
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": claim.Name,
+		},
+	}
+	if class := instance.Spec.VolumeSnapshotClassName; class != nil {
+		spec["volumeSnapshotClassName"] = *class
+	}
+	snapshot.Object["spec"] = spec
+
+	log.Info("Creating a new VolumeSnapshot")
+	log.Info("VolumeSnapshot Namespace : ", snapshot.GetNamespace())
+	log.Info("VolumeSnapshot Name : ", snapshot.GetName())
+
+	if err := r.Client.Create(context.TODO(), snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
@@ -2,6 +2,8 @@ package controllers
 
 import (
 	"context"
+	"net"
+	"strconv"
 
 	"github.com/prometheus/common/log"
 	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
@@ -14,7 +16,6 @@ import (
 )
 
 const forumPort = 4567
-const forumImage = "docker.io/overhangio/openedx-forum:11.2.3"
 
 func forumDeploymentName(instance *cachev1.Openedx) string {
 	return instance.Name + "-forum"
@@ -24,48 +25,74 @@ func forumServiceName(instance *cachev1.Openedx) string {
 	return "forum"
 }
 
-func forumAuthName() string {
+// forumAPIKeyKey is the key of the forum Secret holding the API key shared with the LMS.
+const forumAPIKeyKey = "api-key"
+
+func forumAuthName(instance *cachev1.Openedx) string {
+	if instance.Spec.Secrets != nil && len(instance.Spec.Secrets.Forum) > 0 {
+		return instance.Spec.Secrets.Forum
+	}
 	return "forum-auth"
 }
 
-func (r *OpenedxReconciler) forumAuthSecret(d *cachev1.Openedx) *corev1.Secret {
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      forumAuthName(),
-			Namespace: d.Namespace,
-		},
-		Type: "Opaque",
-		StringData: map[string]string{
-			"username": "root",
-			"password": "cakephp",
-		},
+// forumAuthSecret generates the API key the LMS uses to call the forum.
+func (r *OpenedxReconciler) forumAuthSecret(d *cachev1.Openedx) (*corev1.Secret, error) {
+	apiKey, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := newSecret(forumAuthName(d), d)
+	secret.StringData = map[string]string{
+		forumAPIKeyKey: apiKey,
 	}
 	controllerutil.SetControllerReference(d, secret, r.Scheme)
-	return secret
+	return secret, nil
+}
+
+// getForumMongoDBEnv returns the MongoDB connection of the forum. The entrypoint
+// of the image waits for MONGODB_HOST and MONGODB_PORT, then overwrites
+// MONGOHQ_URL with a URI for a single server without authentication, so the
+// full URI is passed as FORUM_MONGOHQ_URL and exported again by forumArgs.
+func getForumMongoDBEnv(cr *cachev1.Openedx) []corev1.EnvVar {
+	host, port := getOpenedxMongoDBHosts(cr)[0], strconv.Itoa(mongodbPort)
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "MONGODB_AUTH", Value: ""},
+		{Name: "MONGODB_HOST", Value: host},
+		{Name: "MONGODB_PORT", Value: port},
+	}
+	if name := getOpenedxMongoDBAuthName(cr); len(name) > 0 {
+		env = append(env,
+			secretEnvVar("MONGODB_USERNAME", name, mongodbUsernameKey),
+			secretEnvVar("MONGODB_PASSWORD", name, mongodbPasswordKey),
+		)
+	}
+	return append(env, corev1.EnvVar{Name: "FORUM_MONGOHQ_URL", Value: getForumMongoDBURI(cr)})
+}
+
+// forumArgs runs script in the forum image with the MongoDB URI of
+// getForumMongoDBEnv and the search cluster of getForumSearchEnv.
+func forumArgs(script string) []string {
+	return []string{
+		"sh",
+		"-e",
+		"-c",
+		"export MONGOHQ_URL=\"$FORUM_MONGOHQ_URL\" SEARCH_SERVER=\"$FORUM_SEARCH_SERVER\"\n" + script,
+	}
 }
 
 func (r *OpenedxReconciler) forumDeployment(d *cachev1.Openedx) *appsv1.Deployment {
 	labels := labels(d, "forum")
-	size := d.Spec.Size
-
-	// userSecret := &corev1.EnvVarSource{
-	// 	SecretKeyRef: &corev1.SecretKeySelector{
-	// 		LocalObjectReference: corev1.LocalObjectReference{Name: forumAuthName()},
-	// 		Key:                  "username",
-	// 	},
-	// }
-
-	// passwordSecret := &corev1.EnvVarSource{
-	// 	SecretKeyRef: &corev1.SecretKeySelector{
-	// 		LocalObjectReference: corev1.LocalObjectReference{Name: forumAuthName()},
-	// 		Key:                  "password",
-	// 	},
-	// }
+	size := getOpenedxReplicas(d, getOpenedxComponents(d).Forum)
 
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      forumDeploymentName(d),
-			Namespace: d.Namespace,
+			Namespace: getOpenedxNamespace(d),
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
@@ -80,36 +107,24 @@ func (r *OpenedxReconciler) forumDeployment(d *cachev1.Openedx) *appsv1.Deployme
 				Spec: corev1.PodSpec{
 
 					Containers: []corev1.Container{{
-						Image: forumImage,
-						Name:  "forum",
+						Image:     getOpenedxForumImage(d),
+						Name:      "forum",
+						Resources: getOpenedxResources(getOpenedxComponents(d).Forum),
 						Ports: []corev1.ContainerPort{{
 							ContainerPort: forumPort,
 							Name:          "forum",
 						}},
-						Env: []corev1.EnvVar{
-							{
-								Name:  "SEARCH_SERVER",
-								Value: "http://elasticsearch:9200",
-							},
-							{
-								Name:  "MONGODB_AUTH",
-								Value: "",
-							},
-							{
-								Name:  "MONGODB_HOST",
-								Value: "mongodb",
-							},
-							{
-								Name:  "MONGODB_PORT",
-								Value: "27017",
-							},
-						},
+						Args: forumArgs("exec ./bin/unicorn -c config/unicorn_tcp.rb -I ."),
+						Env: append(append([]corev1.EnvVar{
+							secretEnvVar("API_KEY", forumAuthName(d), forumAPIKeyKey),
+						}, getForumSearchEnv(d)...), getForumMongoDBEnv(d)...),
 					}},
 				},
 			},
 		},
 	}
 
+	mountSearchCA(d, &dep.Spec.Template.Spec)
 	controllerutil.SetControllerReference(d, dep, r.Scheme)
 	return dep
 }
@@ -120,7 +135,7 @@ func (r *OpenedxReconciler) forumService(instance *cachev1.Openedx) *corev1.Serv
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      forumServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -144,7 +159,7 @@ func (r *OpenedxReconciler) isforumUp(d *cachev1.Openedx) bool {
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      forumDeploymentName(d),
-		Namespace: d.Namespace,
+		Namespace: getOpenedxNamespace(d),
 	}, deployment)
 
 	if err != nil {
@@ -152,7 +167,7 @@ func (r *OpenedxReconciler) isforumUp(d *cachev1.Openedx) bool {
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if deployment.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// step is a node of the graph the platform is reconciled along.
+type step struct {
+	name string
+	// dependsOn names the steps that must be ready before this one runs.
+	dependsOn []string
+	// run applies the objects of the step, and returns a nil result and error
+	// once they are ready for the steps depending on them, as the ensure
+	// functions do.
+	// Otherwise the step waits: for a change of an object the controller
+	// watches when the result is empty, or for the RequeueAfter it sets.
+	run func() (*reconcile.Result, error)
+}
+
+// runSteps reconciles the graph of steps in waves. Each wave runs in parallel
+// the steps whose dependencies are all ready, so independent objects are
+// applied together, and a step that waits only holds back its dependents.
+// The steps depending on one that waits or failed run in a later reconcile,
+// when the object it waits for changes.
+func (r *OpenedxReconciler) runSteps(steps []step) (ctrl.Result, error) {
+	byName := make(map[string]step, len(steps))
+	for _, s := range steps {
+		byName[s.name] = s
+	}
+	for _, s := range steps {
+		for _, dep := range s.dependsOn {
+			if _, ok := byName[dep]; !ok {
+				return ctrl.Result{}, fmt.Errorf("step %s depends on unknown step %s", s.name, dep)
+			}
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		ready  = make(map[string]bool, len(steps))
+		done   = make(map[string]bool, len(steps))
+		errs   []error
+		result ctrl.Result
+	)
+
+	for {
+		wave := make([]step, 0)
+		for _, s := range steps {
+			if done[s.name] {
+				continue
+			}
+			runnable := true
+			for _, dep := range s.dependsOn {
+				runnable = runnable && ready[dep]
+			}
+			if runnable {
+				wave = append(wave, s)
+			}
+		}
+		if len(wave) == 0 {
+			break
+		}
+
+		var wg sync.WaitGroup
+		for _, s := range wave {
+			done[s.name] = true
+			wg.Add(1)
+			go func(s step) {
+				defer wg.Done()
+				res, err := s.run()
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					// A step that failed is not ready, whatever its result.
+					// Spec errors name the field at fault and are kept as is,
+					// see isSpecError
+					if !isSpecError(err) {
+						err = fmt.Errorf("%s: %v", s.name, err)
+					}
+					errs = append(errs, err)
+					return
+				}
+				if res == nil {
+					ready[s.name] = true
+					return
+				}
+				result = mergeResults(result, *res)
+			}(s)
+		}
+		wg.Wait()
+	}
+
+	if blocked := blockedSteps(steps, done); len(blocked) > 0 {
+		r.Log.Info("Steps waiting for their dependencies : " + strings.Join(blocked, ", "))
+	}
+	return result, utilerrors.NewAggregate(errs)
+}
+
+// blockedSteps returns the sorted names of the steps that did not run.
+func blockedSteps(steps []step, done map[string]bool) []string {
+	blocked := make([]string, 0)
+	for _, s := range steps {
+		if !done[s.name] {
+			blocked = append(blocked, s.name)
+		}
+	}
+	sort.Strings(blocked)
+	return blocked
+}
+
+// mergeResults requeues as soon as any of the results asks to.
+func mergeResults(a, b ctrl.Result) ctrl.Result {
+	merged := ctrl.Result{
+		Requeue:      a.Requeue || b.Requeue,
+		RequeueAfter: a.RequeueAfter,
+	}
+	if merged.RequeueAfter == 0 || (b.RequeueAfter > 0 && b.RequeueAfter < merged.RequeueAfter) {
+		merged.RequeueAfter = b.RequeueAfter
+	}
+	return merged
+}
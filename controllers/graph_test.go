@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// stepRecorder runs fake steps and records which ran.
+type stepRecorder struct {
+	mu  sync.Mutex
+	ran map[string]bool
+}
+
+// step returns a step returning res and err, which checks its dependencies
+// ran before it.
+func (rec *stepRecorder) step(t *testing.T, name string, dependsOn []string,
+	res *reconcile.Result, err error) step {
+
+	return step{name: name, dependsOn: dependsOn, run: func() (*reconcile.Result, error) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		for _, dep := range dependsOn {
+			if !rec.ran[dep] {
+				t.Errorf("%s ran before its dependency %s", name, dep)
+			}
+		}
+		rec.ran[name] = true
+		return res, err
+	}}
+}
+
+func TestRunSteps(t *testing.T) {
+	failed := errors.New("failed")
+
+	tests := []struct {
+		name   string
+		steps  func(*testing.T, *stepRecorder) []step
+		ran    []string
+		result ctrl.Result
+		errs   []string
+	}{
+		{
+			name: "all ready",
+			steps: func(t *testing.T, rec *stepRecorder) []step {
+				return []step{
+					rec.step(t, "c", []string{"a", "b"}, nil, nil),
+					rec.step(t, "a", nil, nil, nil),
+					rec.step(t, "b", []string{"a"}, nil, nil),
+				}
+			},
+			ran: []string{"a", "b", "c"},
+		},
+		{
+			name: "waiting step blocks its dependents",
+			steps: func(t *testing.T, rec *stepRecorder) []step {
+				return []step{
+					rec.step(t, "a", nil, &reconcile.Result{}, nil),
+					rec.step(t, "b", []string{"a"}, nil, nil),
+					rec.step(t, "c", nil, nil, nil),
+				}
+			},
+			ran: []string{"a", "c"},
+		},
+		{
+			name: "requeues are merged",
+			steps: func(t *testing.T, rec *stepRecorder) []step {
+				return []step{
+					rec.step(t, "a", nil, &reconcile.Result{RequeueAfter: time.Minute}, nil),
+					rec.step(t, "b", nil, &reconcile.Result{RequeueAfter: time.Second}, nil),
+				}
+			},
+			ran:    []string{"a", "b"},
+			result: ctrl.Result{RequeueAfter: time.Second},
+		},
+		{
+			name: "errors are aggregated",
+			steps: func(t *testing.T, rec *stepRecorder) []step {
+				return []step{
+					rec.step(t, "a", nil, &reconcile.Result{}, failed),
+					rec.step(t, "b", nil, &reconcile.Result{}, failed),
+					rec.step(t, "c", nil, nil, nil),
+				}
+			},
+			ran:  []string{"a", "b", "c"},
+			errs: []string{"a: failed", "b: failed"},
+		},
+		{
+			name: "failed step is not ready without a result",
+			steps: func(t *testing.T, rec *stepRecorder) []step {
+				return []step{
+					rec.step(t, "a", nil, nil, failed),
+					rec.step(t, "b", []string{"a"}, nil, nil),
+				}
+			},
+			ran:  []string{"a"},
+			errs: []string{"a: failed"},
+		},
+		{
+			name: "unknown dependency",
+			steps: func(t *testing.T, rec *stepRecorder) []step {
+				return []step{
+					rec.step(t, "a", []string{"z"}, nil, nil),
+				}
+			},
+			errs: []string{"step a depends on unknown step z"},
+		},
+	}
+
+	r := &OpenedxReconciler{Log: ctrl.Log}
+	for _, tt := range tests {
+		rec := &stepRecorder{ran: make(map[string]bool)}
+		result, err := r.runSteps(tt.steps(t, rec))
+
+		if ran := sortedKeys(rec.ran); len(ran)+len(tt.ran) > 0 && !reflect.DeepEqual(ran, tt.ran) {
+			t.Errorf("%s: ran %v, want %v", tt.name, ran, tt.ran)
+		}
+		if result != tt.result {
+			t.Errorf("%s: result %+v, want %+v", tt.name, result, tt.result)
+		}
+		if len(tt.errs) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected errors %v", tt.name, tt.errs)
+			continue
+		}
+		for _, want := range tt.errs {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tt.name, err, want)
+			}
+		}
+	}
+}
+
+func TestRunStepsSpecError(t *testing.T) {
+	invalid := &specError{errs: field.ErrorList{field.Required(field.NewPath("spec", "version"), "")}}
+
+	r := &OpenedxReconciler{Log: ctrl.Log}
+	_, err := r.runSteps([]step{
+		{name: "a", run: func() (*reconcile.Result, error) { return &reconcile.Result{}, invalid }},
+		{name: "b", run: func() (*reconcile.Result, error) { return &reconcile.Result{}, errors.New("failed") }},
+	})
+	if !isSpecError(err) {
+		t.Errorf("expected a spec error, got %v", err)
+	}
+
+	_, err = r.runSteps([]step{
+		{name: "b", run: func() (*reconcile.Result, error) { return &reconcile.Result{}, errors.New("failed") }},
+	})
+	if err == nil || isSpecError(err) {
+		t.Errorf("expected an error other than a spec error, got %v", err)
+	}
+}
+
+func TestRunStepsInParallel(t *testing.T) {
+	// Each step waits for the other to start, which only ends when they run together
+	var started sync.WaitGroup
+	started.Add(2)
+	parallel := func() (*reconcile.Result, error) {
+		started.Done()
+		done := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil, nil
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("the other step did not run in parallel")
+		}
+	}
+
+	r := &OpenedxReconciler{Log: ctrl.Log}
+	_, err := r.runSteps([]step{
+		{name: "a", run: parallel},
+		{name: "b", run: parallel},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	tests := []struct {
+		a, b, want ctrl.Result
+	}{
+		{ctrl.Result{}, ctrl.Result{}, ctrl.Result{}},
+		{ctrl.Result{Requeue: true}, ctrl.Result{}, ctrl.Result{Requeue: true}},
+		{ctrl.Result{}, ctrl.Result{Requeue: true}, ctrl.Result{Requeue: true}},
+		{ctrl.Result{}, ctrl.Result{RequeueAfter: time.Minute}, ctrl.Result{RequeueAfter: time.Minute}},
+		{ctrl.Result{RequeueAfter: time.Minute}, ctrl.Result{}, ctrl.Result{RequeueAfter: time.Minute}},
+		{ctrl.Result{RequeueAfter: time.Minute}, ctrl.Result{RequeueAfter: time.Second}, ctrl.Result{RequeueAfter: time.Second}},
+		{ctrl.Result{RequeueAfter: time.Second}, ctrl.Result{RequeueAfter: time.Minute}, ctrl.Result{RequeueAfter: time.Second}},
+	}
+
+	for _, tt := range tests {
+		if got := mergeResults(tt.a, tt.b); got != tt.want {
+			t.Errorf("mergeResults(%+v, %+v) = %+v, want %+v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestBlockedSteps(t *testing.T) {
+	steps := []step{{name: "c"}, {name: "a"}, {name: "b"}}
+
+	tests := []struct {
+		done map[string]bool
+		want []string
+	}{
+		{map[string]bool{}, []string{"a", "b", "c"}},
+		{map[string]bool{"a": true}, []string{"b", "c"}},
+		{map[string]bool{"a": true, "b": true, "c": true}, []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := blockedSteps(steps, tt.done); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("blockedSteps(%v) = %v, want %v", tt.done, got, tt.want)
+		}
+	}
+}
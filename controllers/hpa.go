@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/prometheus/common/log"
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// The autoscalers use autoscaling/v2beta2: autoscaling/v2 is only available
+// from the Kubernetes 1.23 client, and v2beta2 has the same fields. Moving to
+// v2 is a matter of switching the import once client-go is upgraded.
+
+// defaultTargetCPUUtilization is the CPU utilization pods are scaled to when
+// an autoscaler sets no target.
+const defaultTargetCPUUtilization = 80
+
+// autoscaledDeployment pairs a Deployment that may be autoscaled with its
+// autoscaler, which is nil when the Deployment is not autoscaled.
+type autoscaledDeployment struct {
+	name       string
+	component  *cachev1.ComponentSpec
+	autoscaler *cachev1.AutoscalerSpec
+}
+
+// getOpenedxAutoscaledDeployments will return every Deployment that can be autoscaled.
+func getOpenedxAutoscaledDeployments(cr *cachev1.Openedx) []autoscaledDeployment {
+	autoscaling := &cachev1.AutoscalingSpec{}
+	if cr.Spec.Autoscaling != nil {
+		autoscaling = cr.Spec.Autoscaling
+	}
+	components := getOpenedxComponents(cr)
+
+	return []autoscaledDeployment{
+		{lmsDeploymentName(cr), components.Lms, autoscaling.Lms},
+		{cmsDeploymentName(cr), components.Cms, autoscaling.Cms},
+		{lmsworkerDeploymentName(cr), components.LmsWorker, autoscaling.LmsWorker},
+		{cmsworkerDeploymentName(cr), components.CmsWorker, autoscaling.CmsWorker},
+	}
+}
+
+// isAutoscaled reports whether the replica count of the named Deployment is
+// owned by a HorizontalPodAutoscaler.
+func isAutoscaled(cr *cachev1.Openedx, deploymentName string) bool {
+	for _, d := range getOpenedxAutoscaledDeployments(cr) {
+		if d.name == deploymentName {
+			return d.autoscaler != nil
+		}
+	}
+	return false
+}
+
+func utilizationMetric(resource corev1.ResourceName, target int32) autoscalingv2beta2.MetricSpec {
+	return autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name: resource,
+			Target: autoscalingv2beta2.MetricTarget{
+				Type:               autoscalingv2beta2.UtilizationMetricType,
+				AverageUtilization: &target,
+			},
+		},
+	}
+}
+
+// autoscalerMetrics returns the metrics of an autoscaler, defaulting to CPU utilization.
+func autoscalerMetrics(spec *cachev1.AutoscalerSpec) []autoscalingv2beta2.MetricSpec {
+	metrics := []autoscalingv2beta2.MetricSpec{}
+	if spec.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, utilizationMetric(corev1.ResourceCPU, *spec.TargetCPUUtilizationPercentage))
+	}
+	if spec.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, utilizationMetric(corev1.ResourceMemory, *spec.TargetMemoryUtilizationPercentage))
+	}
+	if len(metrics) == 0 {
+		metrics = append(metrics, utilizationMetric(corev1.ResourceCPU, defaultTargetCPUUtilization))
+	}
+	return metrics
+}
+
+// horizontalPodAutoscaler returns the autoscaler of the named Deployment. It
+// shares the name of the Deployment it scales.
+func (r *OpenedxReconciler) horizontalPodAutoscaler(instance *cachev1.Openedx,
+	deploymentName string,
+	spec *cachev1.AutoscalerSpec,
+) *autoscalingv2beta2.HorizontalPodAutoscaler {
+	labels := labels(instance, "hpa")
+
+	minReplicas := int32(1)
+	if spec.MinReplicas != nil {
+		minReplicas = *spec.MinReplicas
+	}
+
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       deploymentName,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: spec.MaxReplicas,
+			Metrics:     autoscalerMetrics(spec),
+		},
+	}
+
+	controllerutil.SetControllerReference(instance, hpa, r.Scheme)
+	return hpa
+}
+
+// deleteHPA removes the autoscaler of a Deployment that is no longer autoscaled.
+// Autoscalers the operator does not own are left alone.
+func (r *OpenedxReconciler) deleteHPA(instance *cachev1.Openedx, name string) error {
+	found := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: getOpenedxNamespace(instance),
+	}, found)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !isOwnedBy(instance, found) {
+		return nil
+	}
+
+	log.Info("Deleting HorizontalPodAutoscaler")
+	log.Info("HorizontalPodAutoscaler Namespace : ", found.Namespace)
+	log.Info("HorizontalPodAutoscaler Name : ", found.Name)
+
+	err = r.Client.Delete(context.TODO(), found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -16,7 +16,7 @@ func newIngress(name string, cr *cachev1.Openedx) *extv1beta1.Ingress {
 	return &extv1beta1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
-			Namespace: cr.Namespace,
+			Namespace: getOpenedxNamespace(cr),
 			Labels:    labels,
 		},
 	}
@@ -25,13 +25,10 @@ func newIngress(name string, cr *cachev1.Openedx) *extv1beta1.Ingress {
 func (r *OpenedxReconciler) ingress(name string, cr *cachev1.Openedx) *extv1beta1.Ingress {
 	ingress := newIngress(name, cr)
 
-	lmsName := getOpenedxLmsUrlName(cr)
-	cmsName := getOpenedxCmsUrlName(cr)
-
 	// Add rules
 	ingress.Spec.Rules = []extv1beta1.IngressRule{
 		{
-			Host: "www." + lmsName + "-openedx.apps.demo.coreostrain.me",
+			Host: getOpenedxLmsHost(cr),
 			IngressRuleValue: extv1beta1.IngressRuleValue{
 				HTTP: &extv1beta1.HTTPIngressRuleValue{
 					Paths: []extv1beta1.HTTPIngressPath{
@@ -46,7 +43,7 @@ func (r *OpenedxReconciler) ingress(name string, cr *cachev1.Openedx) *extv1beta
 			},
 		},
 		{
-			Host: "preview.www." + lmsName + "-openedx.apps.demo.coreostrain.me",
+			Host: getOpenedxPreviewHost(cr),
 			IngressRuleValue: extv1beta1.IngressRuleValue{
 				HTTP: &extv1beta1.HTTPIngressRuleValue{
 					Paths: []extv1beta1.HTTPIngressPath{
@@ -61,7 +58,7 @@ func (r *OpenedxReconciler) ingress(name string, cr *cachev1.Openedx) *extv1beta
 			},
 		},
 		{
-			Host: cmsName + ".www." + lmsName + "-openedx.apps.demo.coreostrain.me",
+			Host: getOpenedxCmsHost(cr),
 			IngressRuleValue: extv1beta1.IngressRuleValue{
 				HTTP: &extv1beta1.HTTPIngressRuleValue{
 					Paths: []extv1beta1.HTTPIngressPath{
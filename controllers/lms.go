@@ -1,17 +1,20 @@
 package controllers
 
 import (
+	"context"
+
 	routev1 "github.com/openshift/api/route/v1"
+	"github.com/prometheus/common/log"
 
 	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-const lmsImage = "docker.io/overhangio/openedx:11.2.3"
 const lmsPort = 8000
 
 func lmsDeploymentName(lms *cachev1.Openedx) string {
@@ -24,12 +27,12 @@ func lmsServiceName(lms *cachev1.Openedx) string {
 
 func (r *OpenedxReconciler) lmsDeployment(instance *cachev1.Openedx) *appsv1.Deployment {
 	labels := labels(instance, "lms")
-	size := instance.Spec.Size
+	size := getOpenedxReplicas(instance, getOpenedxComponents(instance).Lms)
 
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      lmsDeploymentName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
@@ -43,12 +46,14 @@ func (r *OpenedxReconciler) lmsDeployment(instance *cachev1.Openedx) *appsv1.Dep
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{{
-						Image: lmsImage,
-						Name:  "lms",
+						Image:     getOpenedxImage(instance),
+						Name:      "lms",
+						Resources: getOpenedxResources(getOpenedxComponents(instance).Lms),
 						Ports: []corev1.ContainerPort{{
 							ContainerPort: lmsPort,
 							Name:          "lms",
 						}},
+						Env: getOpenedxSecretEnv(instance),
 
 						VolumeMounts: []corev1.VolumeMount{
 							{
@@ -101,6 +106,7 @@ func (r *OpenedxReconciler) lmsDeployment(instance *cachev1.Openedx) *appsv1.Dep
 		},
 	}
 
+	mountSearchCA(instance, &deployment.Spec.Template.Spec)
 	controllerutil.SetControllerReference(instance, deployment, r.Scheme)
 	return deployment
 }
@@ -111,7 +117,7 @@ func (r *OpenedxReconciler) lmsService(instance *cachev1.Openedx) *corev1.Servic
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      lmsServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -129,13 +135,50 @@ func (r *OpenedxReconciler) lmsService(instance *cachev1.Openedx) *corev1.Servic
 	return service
 }
 
+// Returns whether or not the lms deployment is running
+func (r *OpenedxReconciler) isLmsUp(instance *cachev1.Openedx) bool {
+	deployment := &appsv1.Deployment{}
+
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      lmsDeploymentName(instance),
+		Namespace: getOpenedxNamespace(instance),
+	}, deployment)
+
+	if err != nil {
+		log.Error(err, "Deployment lms not found")
+		return false
+	}
+
+	if deployment.Status.ReadyReplicas >= 1 {
+		return true
+	}
+
+	return false
+}
+
+// lmsReplicas returns the number of pods of the lms deployment and their label
+// selector, as reported by the scale subresource.
+func (r *OpenedxReconciler) lmsReplicas(instance *cachev1.Openedx) (int32, string) {
+	selector := metav1.FormatLabelSelector(&metav1.LabelSelector{MatchLabels: labels(instance, "lms")})
+
+	deployment := &appsv1.Deployment{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      lmsDeploymentName(instance),
+		Namespace: getOpenedxNamespace(instance),
+	}, deployment)
+	if err != nil {
+		return 0, selector
+	}
+	return deployment.Status.Replicas, selector
+}
+
 func (r *OpenedxReconciler) lmsRoute(instance *cachev1.Openedx) *routev1.Route {
 	labels := labels(instance, "lms")
 
 	route := &routev1.Route{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      lmsServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: routev1.RouteSpec{
@@ -1,18 +1,16 @@
 package controllers
 
 import (
-	"context"
-	"github.com/prometheus/common/log"
 	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 const lmsJobPort = 8000
 
+// lmsJobName is the prefix of the names of the LMS migration Jobs, see migrationJob.
 func lmsJobName(instance *cachev1.Openedx) string {
 	return instance.Name + "-lmsjob"
 }
@@ -23,7 +21,7 @@ func newLmsJob(instance *cachev1.Openedx) *batchv1.Job {
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      lmsJobName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 	}
@@ -38,9 +36,10 @@ func newLmsPodSpec(cr *cachev1.Openedx) corev1.PodSpec {
 			"lms",
 			"migrate",
 		},
-		Image:           "docker.io/overhangio/openedx:11.2.3",
+		Image:           getOpenedxImage(cr),
 		ImagePullPolicy: corev1.PullAlways,
 		Name:            "lms",
+		Env:             getOpenedxSecretEnv(cr),
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      "settings-lms",
@@ -89,6 +88,7 @@ func newLmsPodSpec(cr *cachev1.Openedx) corev1.PodSpec {
 		},
 	}
 
+	mountSearchCA(cr, &pod)
 	return pod
 }
 
@@ -98,7 +98,7 @@ func newLmsPodTemplateSpec(cr *cachev1.Openedx) corev1.PodTemplateSpec {
 	return corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      lmsJobName(cr),
-			Namespace: cr.Namespace,
+			Namespace: getOpenedxNamespace(cr),
 			Labels:    labels,
 		},
 		Spec: newLmsPodSpec(cr),
@@ -112,25 +112,3 @@ func (r *OpenedxReconciler) lmsJob(instance *cachev1.Openedx) *batchv1.Job {
 	controllerutil.SetControllerReference(instance, job, r.Scheme)
 	return job
 }
-
-func (r *OpenedxReconciler) isLmsJobDone(instance *cachev1.Openedx) bool {
-
-	job := &batchv1.Job{}
-
-	err := r.Client.Get(context.TODO(), types.NamespacedName{
-		Name:      lmsJobName(instance),
-		Namespace: instance.Namespace,
-	}, job)
-
-	if err != nil {
-		log.Error(err, "lmsjob not found")
-		return false
-	}
-
-	if job.Status.Succeeded > 0 {
-		return true
-	}
-
-	return false // Job not complete.
-
-}
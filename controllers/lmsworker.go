@@ -8,7 +8,6 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-const lmsworkerImage = "docker.io/overhangio/openedx:11.2.3"
 const lmsworkerPort = 8000
 const lmsworkerPod = "lmsworker"
 
@@ -18,12 +17,12 @@ func lmsworkerDeploymentName(lmsworker *cachev1.Openedx) string {
 
 func (r *OpenedxReconciler) lmsworkerDeployment(lmsworker *cachev1.Openedx) *appsv1.Deployment {
 	labels := labels(lmsworker, "lmsworker")
-	size := lmsworker.Spec.Size
+	size := getOpenedxReplicas(lmsworker, getOpenedxComponents(lmsworker).LmsWorker)
 
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      lmsworkerDeploymentName(lmsworker),
-			Namespace: lmsworker.Namespace,
+			Namespace: getOpenedxNamespace(lmsworker),
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
@@ -40,19 +39,20 @@ func (r *OpenedxReconciler) lmsworkerDeployment(lmsworker *cachev1.Openedx) *app
 						Args: []string{
 							"celery",
 							"worker",
-							"--app=cms.celery",
+							"--app=lms.celery",
 							"--loglevel=info",
 							"--hostname=edx.lms.core.default.%%h",
 							"--maxtasksperchild", "100",
 							"--exclude-queues=edx.cms.core.default",
 						},
-						Image: lmsworkerImage,
-						Name:  "lms-worker",
+						Image:     getOpenedxImage(lmsworker),
+						Name:      "lms-worker",
+						Resources: getOpenedxResources(getOpenedxComponents(lmsworker).LmsWorker),
 						Ports: []corev1.ContainerPort{{
 							ContainerPort: lmsPort,
 							Name:          "lmsworker",
 						}},
-						Env: []corev1.EnvVar{
+						Env: append([]corev1.EnvVar{
 							{
 								Name:  "SERVICE_VARIANT",
 								Value: "lms",
@@ -61,7 +61,7 @@ func (r *OpenedxReconciler) lmsworkerDeployment(lmsworker *cachev1.Openedx) *app
 								Name:  "C_FORCE_ROOT",
 								Value: "1",
 							},
-						},
+						}, getOpenedxSecretEnv(lmsworker)...),
 
 						VolumeMounts: []corev1.VolumeMount{
 							{
@@ -114,6 +114,7 @@ func (r *OpenedxReconciler) lmsworkerDeployment(lmsworker *cachev1.Openedx) *app
 		},
 	}
 
+	mountSearchCA(lmsworker, &dep.Spec.Template.Spec)
 	controllerutil.SetControllerReference(lmsworker, dep, r.Scheme)
 	return dep
 }
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	"github.com/rocrisp/openedx-operator/render"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultMaintenanceRetryAfter is the Retry-After of the maintenance page, in seconds.
+const defaultMaintenanceRetryAfter = 600
+
+// defaultTrustedProxies are the private IPv4 ranges, which hold the pods of
+// Caddy and of the ingress controllers in front of nginx.
+var defaultTrustedProxies = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// getOpenedxMaintenance will return the maintenance settings, enabled or not.
+func getOpenedxMaintenance(cr *cachev1.Openedx) *cachev1.MaintenanceSpec {
+	if cr.Spec.Maintenance != nil {
+		return cr.Spec.Maintenance
+	}
+	return &cachev1.MaintenanceSpec{}
+}
+
+// maintenanceReason returns why the platform serves the maintenance page, or
+// an empty reason when it serves the LMS and CMS.
+func (r *OpenedxReconciler) maintenanceReason(cr *cachev1.Openedx) cachev1.MaintenanceReason {
+	switch {
+	case isUpgradeHolding(cr):
+		return cachev1.MaintenanceUpgrade
+	case r.isRestoring(cr):
+		return cachev1.MaintenanceRestore
+	case getOpenedxMaintenance(cr).Enabled:
+		return cachev1.MaintenanceRequested
+	}
+	return ""
+}
+
+// isWorkerDeployment reports whether the named Deployment runs Celery workers.
+func isWorkerDeployment(cr *cachev1.Openedx, deploymentName string) bool {
+	return deploymentName == lmsworkerDeploymentName(cr) || deploymentName == cmsworkerDeploymentName(cr)
+}
+
+// getOpenedxRenderMaintenance will return the maintenance page nginx serves
+// for the given reason, or nil when the platform is not in maintenance.
+func getOpenedxRenderMaintenance(cr *cachev1.Openedx, reason cachev1.MaintenanceReason) *render.Maintenance {
+	if len(reason) == 0 {
+		return nil
+	}
+	spec := getOpenedxMaintenance(cr)
+
+	maintenance := &render.Maintenance{
+		Page:           spec.Page,
+		RetryAfter:     defaultMaintenanceRetryAfter,
+		AllowedCIDRs:   spec.AllowedCIDRs,
+		TrustedProxies: defaultTrustedProxies,
+	}
+	if spec.RetryAfter != nil {
+		maintenance.RetryAfter = *spec.RetryAfter
+	}
+	if len(spec.TrustedProxies) > 0 {
+		maintenance.TrustedProxies = spec.TrustedProxies
+	}
+	return maintenance
+}
+
+// maintenanceStatus reports the maintenance for the given reason, keeping
+// when it started while the platform stays in maintenance.
+func maintenanceStatus(previous *cachev1.MaintenanceStatus, reason cachev1.MaintenanceReason) *cachev1.MaintenanceStatus {
+	if len(reason) == 0 {
+		return nil
+	}
+	if previous != nil && previous.Since != nil {
+		return &cachev1.MaintenanceStatus{Reason: reason, Since: previous.Since}
+	}
+	now := metav1.Now()
+	return &cachev1.MaintenanceStatus{Reason: reason, Since: &now}
+}
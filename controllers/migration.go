@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// migrationBackoffLimit is how many times a failed migration pod is retried.
+	migrationBackoffLimit = 3
+	// migrationDeadline bounds the run time of a migration Job, retries included.
+	migrationDeadline = time.Hour
+	// migrationJobTTL is how long a finished migration Job is kept, with the
+	// logs of its pods. Its outcome is recorded in the status, so a succeeded
+	// Job is not run again once deleted, while a failed one is.
+	migrationJobTTL = 24 * time.Hour
+	// maxTerminationMessage bounds the part of a termination message kept in the status.
+	maxTerminationMessage = 1024
+)
+
+// migration is a Job migrating the databases of a component.
+type migration struct {
+	component string
+	// prefix is the name of the Jobs of the component, before their hash.
+	prefix string
+	job    func(*cachev1.Openedx) *batchv1.Job
+}
+
+// migrations returns the migration Jobs, in the order they run.
+func (r *OpenedxReconciler) migrations(instance *cachev1.Openedx) []migration {
+	return []migration{
+		{component: "lms", prefix: lmsJobName(instance), job: r.lmsJob},
+		{component: "cms", prefix: cmsJobName(instance), job: r.cmsJob},
+		{component: "forum", prefix: forumjobName(instance), job: r.forumJob},
+	}
+}
+
+// podTemplateHash returns a short hash of a pod template.
+func podTemplateHash(template *corev1.PodTemplateSpec) (string, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:10], nil
+}
+
+// migrationJob returns the migration Job of a component, named after a hash
+// of its pod template. The template holds the image and the checksum of the
+// settings, so a new image or new settings make a new Job.
+func (r *OpenedxReconciler) migrationJob(instance *cachev1.Openedx,
+	m migration,
+	rendered map[string]*corev1.ConfigMap,
+) (*batchv1.Job, error) {
+	job := m.job(instance)
+
+	backoffLimit := int32(migrationBackoffLimit)
+	deadline := int64(migrationDeadline.Seconds())
+	ttl := int32(migrationJobTTL.Seconds())
+	job.Spec.BackoffLimit = &backoffLimit
+	job.Spec.ActiveDeadlineSeconds = &deadline
+	job.Spec.TTLSecondsAfterFinished = &ttl
+
+	// Each attempt runs in its own pod, which keeps the end of its logs
+	// as termination message
+	pod := &job.Spec.Template.Spec
+	pod.RestartPolicy = corev1.RestartPolicyNever
+	for i := range pod.Containers {
+		pod.Containers[i].TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	}
+
+	if err := r.stampConfigChecksum(job.Namespace, &job.Spec.Template, rendered); err != nil {
+		return nil, err
+	}
+	hash, err := podTemplateHash(&job.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	job.Name = m.prefix + "-" + hash
+	return job, nil
+}
+
+// deleteStaleJobs removes the Jobs named after prefix other than the current
+// one, such as the migration Jobs of a component that migrate to another image
+// or other settings, including those named after a release or not versioned
+// at all, so that they never run along the current one.
+func (r *OpenedxReconciler) deleteStaleJobs(instance *cachev1.Openedx, prefix, current string) error {
+	jobs := &batchv1.JobList{}
+	if err := r.Client.List(context.TODO(), jobs, client.InNamespace(getOpenedxNamespace(instance))); err != nil {
+		return err
+	}
+
+	for _, job := range jobs.Items {
+		if job.Name == current || (job.Name != prefix && !strings.HasPrefix(job.Name, prefix+"-")) {
+			continue
+		}
+		if err := r.deleteJob(instance, job.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// podTerminationMessage returns the termination message of the last pod of a
+// Job that failed, which holds the end of its logs.
+func (r *OpenedxReconciler) podTerminationMessage(job *batchv1.Job) string {
+	pods := &corev1.PodList{}
+	err := r.Client.List(context.TODO(), pods,
+		client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return ""
+	}
+
+	var last *corev1.ContainerStateTerminated
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.State.Terminated
+			if terminated == nil || terminated.ExitCode == 0 {
+				continue
+			}
+			if last == nil || last.FinishedAt.Before(&terminated.FinishedAt) {
+				last = terminated
+			}
+		}
+	}
+	if last == nil {
+		return ""
+	}
+
+	message := strings.TrimSpace(last.Message)
+	if len(message) > maxTerminationMessage {
+		message = "..." + message[len(message)-maxTerminationMessage:]
+	}
+	return message
+}
+
+// reconcileMigration runs the migration Job of a component, unless the
+// status records it already succeeded. A failed Job is reported in the
+// status and left alone: a new image or new settings replace it with a new
+// Job, as does deleting it or its TTL expiring.
+func (r *OpenedxReconciler) reconcileMigration(req reconcile.Request,
+	instance *cachev1.Openedx,
+	m migration,
+	rendered map[string]*corev1.ConfigMap,
+) (*reconcile.Result, error) {
+	job, err := r.migrationJob(instance, m, rendered)
+	if err != nil {
+		return &reconcile.Result{}, err
+	}
+
+	if err = r.deleteStaleJobs(instance, m.prefix, job.Name); err != nil {
+		return &reconcile.Result{}, err
+	}
+
+	previous, ok := instance.Status.Migrations[m.component]
+	if ok && previous.Job == job.Name && previous.Succeeded {
+		return nil, nil
+	}
+	status := cachev1.MigrationStatus{Job: job.Name}
+	defer func() {
+		if instance.Status.Migrations == nil {
+			instance.Status.Migrations = make(map[string]cachev1.MigrationStatus)
+		}
+		instance.Status.Migrations[m.component] = status
+	}()
+
+	result, err := r.ensureJob(req, instance, job)
+	if result != nil {
+		return result, err
+	}
+
+	// A Job created in this reconcile may not be read back yet, it is then waited for
+	found := &batchv1.Job{}
+	err = r.Client.Get(context.TODO(), client.ObjectKey{Name: job.Name, Namespace: job.Namespace}, found)
+	if errors.IsNotFound(err) {
+		found = job
+	} else if err != nil {
+		return &reconcile.Result{}, err
+	}
+
+	for _, c := range found.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			status.Message = fmt.Sprintf("Job %s failed: %s", found.Name, c.Message)
+			if message := r.podTerminationMessage(found); len(message) > 0 {
+				status.Message += ": " + message
+			}
+			r.Log.Info(status.Message)
+			if status.Message != previous.Message {
+				r.event(instance, corev1.EventTypeWarning, "MigrationFailed", status.Message)
+			}
+			return &reconcile.Result{}, nil
+		}
+	}
+
+	if found.Status.Succeeded == 0 {
+		r.Log.Info(fmt.Sprintf("Migration Job %s isn't Complete, waiting for it", found.Name))
+		return &reconcile.Result{}, nil
+	}
+
+	status.Succeeded = true
+	status.CompletionTime = found.Status.CompletionTime
+	r.event(instance, corev1.EventTypeNormal, "MigrationSucceeded",
+		fmt.Sprintf("Migrated the %s databases with Job %s", m.component, found.Name))
+	return nil, nil
+}
+
+// isMigrated reports whether the migration Jobs of every component succeeded.
+func (r *OpenedxReconciler) isMigrated(instance *cachev1.Openedx) bool {
+	for _, m := range r.migrations(instance) {
+		if !instance.Status.Migrations[m.component].Succeeded {
+			return false
+		}
+	}
+	return true
+}
+
+// migrationFailure returns why a migration Job failed, or "".
+func migrationFailure(instance *cachev1.Openedx) string {
+	failures := make([]string, 0)
+	for _, status := range instance.Status.Migrations {
+		if len(status.Message) > 0 {
+			failures = append(failures, status.Message)
+		}
+	}
+	sort.Strings(failures)
+	return strings.Join(failures, "; ")
+}
@@ -2,9 +2,13 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/prometheus/common/log"
 	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	"github.com/rocrisp/openedx-operator/render"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -15,7 +19,13 @@ import (
 
 const mongodbPort = 27017
 
-func mongodbDeploymentName(instance *cachev1.Openedx) string {
+// Keys of the Secret holding the credentials of an external MongoDB.
+const (
+	mongodbUsernameKey = "username"
+	mongodbPasswordKey = "password"
+)
+
+func mongodbStatefulSetName(instance *cachev1.Openedx) string {
 	return instance.Name + "-mongodb"
 }
 
@@ -23,60 +33,155 @@ func mongodbServiceName(instance *cachev1.Openedx) string {
 	return "mongodb"
 }
 
-func (r *OpenedxReconciler) mongodbDeployment(instance *cachev1.Openedx) *appsv1.Deployment {
+// getOpenedxExternalMongoDB will return the external MongoDB, or nil when MongoDB runs in the cluster.
+func getOpenedxExternalMongoDB(cr *cachev1.Openedx) *cachev1.ExternalMongoDBSpec {
+	if cr.Spec.MongoDB != nil {
+		return cr.Spec.MongoDB.External
+	}
+	return nil
+}
+
+// getOpenedxMongoDBImage will return the image of the in-cluster MongoDB, whose
+// client also backs up and restores the databases.
+func getOpenedxMongoDBImage(cr *cachev1.Openedx) string {
+	return getOpenedxDatastoreRelease(cr).mongodbImage
+}
+
+// getOpenedxMongoDBAuthName will return the Secret holding the MongoDB credentials, or "" without authentication.
+func getOpenedxMongoDBAuthName(cr *cachev1.Openedx) string {
+	if db := getOpenedxExternalMongoDB(cr); db != nil {
+		return db.CredentialsSecret
+	}
+	return ""
+}
+
+// getOpenedxMongoDBHosts will return the host or host:port members MongoDB is reached on.
+func getOpenedxMongoDBHosts(cr *cachev1.Openedx) []string {
+	if db := getOpenedxExternalMongoDB(cr); db != nil {
+		return db.Hosts
+	}
+	return []string{fmt.Sprintf("%s:%d", mongodbServiceName(cr), mongodbPort)}
+}
+
+// getOpenedxMongoDBDatabase will return the database of the modulestore.
+func getOpenedxMongoDBDatabase(cr *cachev1.Openedx) string {
+	if db := getOpenedxExternalMongoDB(cr); db != nil && len(db.Database) > 0 {
+		return db.Database
+	}
+	return "openedx"
+}
+
+// getOpenedxForumDatabase will return the database of the forum.
+func getOpenedxForumDatabase(cr *cachev1.Openedx) string {
+	if db := getOpenedxExternalMongoDB(cr); db != nil && len(db.ForumDatabase) > 0 {
+		return db.ForumDatabase
+	}
+	return "cs_comments_service"
+}
+
+// getOpenedxMongoDBAuthSource will return the database the MongoDB user is defined in.
+func getOpenedxMongoDBAuthSource(cr *cachev1.Openedx) string {
+	if db := getOpenedxExternalMongoDB(cr); db != nil && len(db.AuthSource) > 0 {
+		return db.AuthSource
+	}
+	return "admin"
+}
+
+// getOpenedxRenderMongoDB returns the MongoDB connection of the Django settings.
+func getOpenedxRenderMongoDB(cr *cachev1.Openedx) render.MongoDB {
+	if db := getOpenedxExternalMongoDB(cr); db != nil {
+		return render.MongoDB{
+			Host:          strings.Join(db.Hosts, ","),
+			Port:          mongodbPort,
+			Database:      getOpenedxMongoDBDatabase(cr),
+			ReplicaSet:    db.ReplicaSet,
+			TLS:           db.TLS,
+			Authenticated: len(db.CredentialsSecret) > 0,
+			AuthSource:    getOpenedxMongoDBAuthSource(cr),
+		}
+	}
+	return render.MongoDB{
+		Host:     mongodbServiceName(cr),
+		Port:     mongodbPort,
+		Database: getOpenedxMongoDBDatabase(cr),
+	}
+}
+
+// getForumMongoDBURI returns the connection URI of the forum database. The
+// credentials are expanded by Kubernetes from the environment of the container.
+func getForumMongoDBURI(cr *cachev1.Openedx) string {
+	return getMongoDBURI(cr, getOpenedxForumDatabase(cr))
+}
+
+// getMongoDBURI returns the connection URI of a database, with the
+// credentials expanded from the environment of the container like
+// getForumMongoDBURI.
+func getMongoDBURI(cr *cachev1.Openedx, database string) string {
+	auth := ""
+	if len(getOpenedxMongoDBAuthName(cr)) > 0 {
+		auth = "$(MONGODB_USERNAME):$(MONGODB_PASSWORD)@"
+	}
+
+	options := url.Values{}
+	if db := getOpenedxExternalMongoDB(cr); db != nil {
+		if len(db.ReplicaSet) > 0 {
+			options.Set("replicaSet", db.ReplicaSet)
+		}
+		if db.TLS {
+			options.Set("ssl", "true")
+		}
+		if len(auth) > 0 {
+			options.Set("authSource", getOpenedxMongoDBAuthSource(cr))
+		}
+	}
+
+	uri := "mongodb://" + auth + strings.Join(getOpenedxMongoDBHosts(cr), ",") + "/" + database
+	if len(options) > 0 {
+		uri += "?" + options.Encode()
+	}
+	return uri
+}
+
+func (r *OpenedxReconciler) mongodbStatefulSet(instance *cachev1.Openedx) *appsv1.StatefulSet {
 	labels := labels(instance, "mongodb")
-	size := instance.Spec.Size
+	size := getOpenedxDatastoreReplicas(getOpenedxComponents(instance).MongoDB)
+
+	args := []string{
+		"mongod",
+		"--smallfiles",
+		"--nojournal",
+		"--storageEngine",
+		"wiredTiger",
+	}
+	if releaseIndex(getOpenedxDatastoreRelease(instance).name) >= releaseIndex("maple") {
+		// --smallfiles only ever applied to MMAPv1, MongoDB 4.2 refuses it
+		args = append(args[:1], args[2:]...)
+	}
 
-	deployment := &appsv1.Deployment{
+	template := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      mongodbDeploymentName(instance),
-			Namespace: instance.Namespace,
-			Labels:    labels,
+			Labels: labels,
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &size,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{{
-						Name: "mongodb-data",
-						VolumeSource: corev1.VolumeSource{
-							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-								ClaimName: "mongodb",
-							},
-						},
-					}},
-					Containers: []corev1.Container{{
-						Args: []string{
-							"mongod",
-							"--smallfiles",
-							"--nojournal",
-							"--storageEngine",
-							"wiredTiger",
-						},
-						Image: "docker.io/mongo:3.6.18",
-						Name:  "mongodb-server",
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: mongodbPort,
-							Name:          "mongodb",
-						}},
-						VolumeMounts: []corev1.VolumeMount{{
-							Name:      "mongodb-data",
-							MountPath: "/data/db",
-						}},
-					}},
-				},
-			},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Args:  args,
+				Image: getOpenedxMongoDBImage(instance),
+				Name:  "mongodb-server",
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: mongodbPort,
+					Name:          "mongodb",
+				}},
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      datastoreClaimName,
+					MountPath: "/data/db",
+				}},
+			}},
 		},
 	}
 
-	controllerutil.SetControllerReference(instance, deployment, r.Scheme)
-	return deployment
+	statefulSet := datastoreStatefulSet(instance, mongodbStatefulSetName(instance), mongodbServiceName(instance), size, "mongodb", template)
+	controllerutil.SetControllerReference(instance, statefulSet, r.Scheme)
+	return statefulSet
 }
 
 func (r *OpenedxReconciler) mongodbService(instance *cachev1.Openedx) *corev1.Service {
@@ -85,7 +190,7 @@ func (r *OpenedxReconciler) mongodbService(instance *cachev1.Openedx) *corev1.Se
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      mongodbServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -103,22 +208,26 @@ func (r *OpenedxReconciler) mongodbService(instance *cachev1.Openedx) *corev1.Se
 	return service
 }
 
-// Returns whether or not the MySQL deployment is running
+// Returns whether or not the mongodb StatefulSet is running. An external MongoDB
+// is managed elsewhere and not probed.
 func (r *OpenedxReconciler) isMongodbUp(instance *cachev1.Openedx) bool {
+	if getOpenedxExternalMongoDB(instance) != nil {
+		return true
+	}
 
-	deployment := &appsv1.Deployment{}
+	statefulSet := &appsv1.StatefulSet{}
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
-		Name:      mongodbDeploymentName(instance),
-		Namespace: instance.Namespace,
-	}, deployment)
+		Name:      mongodbStatefulSetName(instance),
+		Namespace: getOpenedxNamespace(instance),
+	}, statefulSet)
 
 	if err != nil {
-		log.Error(err, "Deployment mongodb not found")
+		log.Error(err, "StatefulSet mongodb not found")
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if statefulSet.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
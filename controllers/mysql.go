@@ -2,21 +2,25 @@ package controllers
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	"github.com/prometheus/common/log"
 	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-const sqlImage = "docker.io/mysql:5.7.32"
 const sqlPort = 3306
 
-func mysqlDeploymentName(instance *cachev1.Openedx) string {
+func mysqlStatefulSetName(instance *cachev1.Openedx) string {
 	return instance.Name + "-mysql"
 }
 
@@ -24,103 +28,172 @@ func mysqlServiceName(instance *cachev1.Openedx) string {
 	return "mysql"
 }
 
-func mysqlAuthName() string {
+// mysqlPreflightJobPrefix is the name of the preflight Jobs, before their hash.
+func mysqlPreflightJobPrefix(instance *cachev1.Openedx) string {
+	return instance.Name + "-mysql-preflight"
+}
+
+// getOpenedxExternalDatabase will return the external MySQL database, or nil when MySQL runs in the cluster.
+func getOpenedxExternalDatabase(cr *cachev1.Openedx) *cachev1.ExternalDatabaseSpec {
+	if cr.Spec.Database != nil {
+		return cr.Spec.Database.External
+	}
+	return nil
+}
+
+// getOpenedxMySQLImage will return the image of the in-cluster MySQL, whose
+// client also checks, backs up and restores the database.
+func getOpenedxMySQLImage(cr *cachev1.Openedx) string {
+	return getOpenedxDatastoreRelease(cr).mysqlImage
+}
+
+// getOpenedxMySQLHost will return the host the LMS and CMS connect to MySQL on.
+func getOpenedxMySQLHost(cr *cachev1.Openedx) string {
+	if db := getOpenedxExternalDatabase(cr); db != nil {
+		return db.Host
+	}
+	return mysqlServiceName(cr)
+}
+
+// getOpenedxMySQLPort will return the port the LMS and CMS connect to MySQL on.
+func getOpenedxMySQLPort(cr *cachev1.Openedx) int32 {
+	if db := getOpenedxExternalDatabase(cr); db != nil && db.Port != 0 {
+		return db.Port
+	}
+	return sqlPort
+}
+
+// getOpenedxMySQLDatabase will return the name of the database of the LMS and CMS.
+func getOpenedxMySQLDatabase(cr *cachev1.Openedx) string {
+	if db := getOpenedxExternalDatabase(cr); db != nil && len(db.Database) > 0 {
+		return db.Database
+	}
+	return "openedx"
+}
+
+// Keys of the MySQL Secret.
+const (
+	mysqlRootPasswordKey = "root-password"
+	mysqlUsernameKey     = "username"
+	mysqlPasswordKey     = "password"
+)
+
+func mysqlAuthName(instance *cachev1.Openedx) string {
+	if db := getOpenedxExternalDatabase(instance); db != nil {
+		return db.CredentialsSecret
+	}
+	if instance.Spec.Secrets != nil && len(instance.Spec.Secrets.MySQL) > 0 {
+		return instance.Spec.Secrets.MySQL
+	}
 	return "mysql-auth"
 }
 
-func (r *OpenedxReconciler) mysqlAuthSecret(instance *cachev1.Openedx) *corev1.Secret {
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      mysqlAuthName(),
-			Namespace: instance.Namespace,
-		},
-		Type: "Opaque",
-		StringData: map[string]string{
-			"username": "root",
-			"password": "cakephp",
-		},
+// Credentials the MySQL of the platforms deployed before the operator
+// generated them was initialized with. MySQL only reads its credentials from
+// the environment when the data directory is empty, so they are kept.
+const (
+	legacyMysqlRootPassword = "mQh8ZJz4"
+	legacyMysqlPassword     = "0yMvt69B"
+)
+
+// hasLegacyMysqlData reports whether MySQL still runs as the Deployment, or
+// on the standalone claim, of the platforms deployed before the operator
+// generated its credentials.
+func (r *OpenedxReconciler) hasLegacyMysqlData(instance *cachev1.Openedx) (bool, error) {
+	ns := getOpenedxNamespace(instance)
+
+	deployment := &appsv1.Deployment{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: mysqlStatefulSetName(instance), Namespace: ns}, deployment)
+	if err == nil && isOwnedBy(instance, deployment) {
+		return true, nil
+	} else if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	claim := &corev1.PersistentVolumeClaim{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: "mysql", Namespace: ns}, claim)
+	if err == nil {
+		return isOwnedBy(instance, claim), nil
+	} else if !errors.IsNotFound(err) {
+		return false, err
+	}
+	return false, nil
+}
+
+// mysqlAuthSecret generates the root password and the credentials of the
+// openedx database user. A platform deployed before the operator generated
+// them keeps the credentials its data was initialized with.
+func (r *OpenedxReconciler) mysqlAuthSecret(instance *cachev1.Openedx) (*corev1.Secret, error) {
+	legacy, err := r.hasLegacyMysqlData(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	rootPassword, password := legacyMysqlRootPassword, legacyMysqlPassword
+	if legacy {
+		r.event(instance, corev1.EventTypeWarning, "LegacyCredentials",
+			"MySQL keeps the credentials its data was initialized with")
+	} else {
+		if rootPassword, err = randomString(16); err != nil {
+			return nil, err
+		}
+		if password, err = randomString(16); err != nil {
+			return nil, err
+		}
+	}
+
+	secret := newSecret(mysqlAuthName(instance), instance)
+	secret.StringData = map[string]string{
+		mysqlRootPasswordKey: rootPassword,
+		mysqlUsernameKey:     "openedx",
+		mysqlPasswordKey:     password,
 	}
 	controllerutil.SetControllerReference(instance, secret, r.Scheme)
-	return secret
+	return secret, nil
 }
 
-func (r *OpenedxReconciler) mysqlDeployment(instance *cachev1.Openedx) *appsv1.Deployment {
+func (r *OpenedxReconciler) mysqlStatefulSet(instance *cachev1.Openedx) *appsv1.StatefulSet {
 	labels := labels(instance, "mysql")
-	size := instance.Spec.Size
+	size := getOpenedxDatastoreReplicas(getOpenedxComponents(instance).MySQL)
 
-	deployment := &appsv1.Deployment{
+	template := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      mysqlDeploymentName(instance),
-			Namespace: instance.Namespace,
-			Labels:    labels,
+			Labels: labels,
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &size,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Args: []string{
+					"mysqld",
+					"--character-set-server=utf8",
+					"--collation-server=utf8_general_ci",
+					"--ignore-db-dir=lost+found",
 				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						{
-							Name: "data",
-							VolumeSource: corev1.VolumeSource{
-								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-									ClaimName: "mysql",
-								},
-							},
-						}, {
-							Name: "mysql-initdb",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "mysql-initdb-config",
-									},
-								},
-							},
-						},
+				Image: getOpenedxMySQLImage(instance),
+				Name:  "mysql-server",
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: sqlPort,
+					Name:          "mysql",
+				}},
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      datastoreClaimName,
+					MountPath: "/var/lib/mysql",
+				}},
+				Env: []corev1.EnvVar{
+					secretEnvVar("MYSQL_ROOT_PASSWORD", mysqlAuthName(instance), mysqlRootPasswordKey),
+					secretEnvVar("MYSQL_USER", mysqlAuthName(instance), mysqlUsernameKey),
+					secretEnvVar("MYSQL_PASSWORD", mysqlAuthName(instance), mysqlPasswordKey),
+					{
+						Name:  "MYSQL_DATABASE",
+						Value: "openedx",
 					},
-
-					Containers: []corev1.Container{{
-						Args: []string{
-							"mysqld",
-							"--character-set-server=utf8",
-							"--collation-server=utf8_general_ci",
-							"--ignore-db-dir=lost+found",
-						},
-						Image: sqlImage,
-						Name:  "mysql-server",
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: sqlPort,
-							Name:          "mysql",
-						}},
-						VolumeMounts: []corev1.VolumeMount{
-							{
-								Name:      "data",
-								MountPath: "/var/lib/mysql",
-							},
-							{
-								Name:      "mysql-initdb",
-								MountPath: "/docker-entrypoint-initdb.d",
-							},
-						},
-						Env: []corev1.EnvVar{
-							{
-								Name:  "MYSQL_ROOT_PASSWORD",
-								Value: "mQh8ZJz4",
-							},
-						},
-					}},
 				},
-			},
+			}},
 		},
 	}
 
-	controllerutil.SetControllerReference(instance, deployment, r.Scheme)
-	return deployment
+	statefulSet := datastoreStatefulSet(instance, mysqlStatefulSetName(instance), mysqlServiceName(instance), size, "mysql", template)
+	controllerutil.SetControllerReference(instance, statefulSet, r.Scheme)
+	return statefulSet
 }
 
 func (r *OpenedxReconciler) mysqlService(instance *cachev1.Openedx) *corev1.Service {
@@ -129,7 +202,7 @@ func (r *OpenedxReconciler) mysqlService(instance *cachev1.Openedx) *corev1.Serv
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      mysqlServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -146,21 +219,143 @@ func (r *OpenedxReconciler) mysqlService(instance *cachev1.Openedx) *corev1.Serv
 	return service
 }
 
-// Returns whether or not the MySQL deployment is running
+// mysqlPreflightScript connects to the database and creates and drops a table,
+// which the migrations need to be allowed to do.
+const mysqlPreflightScript = `set -e
+mysql --connect-timeout=10 --host="$MYSQL_HOST" --port="$MYSQL_PORT" --user="$MYSQL_USER" "$MYSQL_DATABASE" --execute="
+SHOW GRANTS;
+DROP TABLE IF EXISTS openedx_operator_preflight;
+CREATE TABLE openedx_operator_preflight (id INT);
+ALTER TABLE openedx_operator_preflight ADD COLUMN name VARCHAR(16);
+DROP TABLE openedx_operator_preflight;
+"
+`
+
+// mysqlPreflightJob checks that the external database is reachable with the
+// given credentials before the migrations run against it. It is named after a
+// hash of its pod template, which holds the coordinates of the database and
+// the checksum of its credentials, so changing any of them checks it again.
+func (r *OpenedxReconciler) mysqlPreflightJob(instance *cachev1.Openedx) (*batchv1.Job, error) {
+	labels := labels(instance, "mysql-preflight")
+	backoffLimit := int32(4)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Command: []string{"sh", "-c", mysqlPreflightScript},
+						Image:   getOpenedxMySQLImage(instance),
+						Name:    "mysql-preflight",
+						Env: []corev1.EnvVar{
+							{Name: "MYSQL_HOST", Value: getOpenedxMySQLHost(instance)},
+							{Name: "MYSQL_PORT", Value: strconv.Itoa(int(getOpenedxMySQLPort(instance)))},
+							{Name: "MYSQL_DATABASE", Value: getOpenedxMySQLDatabase(instance)},
+							secretEnvVar("MYSQL_USER", mysqlAuthName(instance), mysqlUsernameKey),
+							secretEnvVar("MYSQL_PWD", mysqlAuthName(instance), mysqlPasswordKey),
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	if err := r.stampConfigChecksum(job.Namespace, &job.Spec.Template, nil); err != nil {
+		return nil, err
+	}
+	hash, err := podTemplateHash(&job.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	job.Name = mysqlPreflightJobPrefix(instance) + "-" + hash
+
+	controllerutil.SetControllerReference(instance, job, r.Scheme)
+	return job, nil
+}
+
+// mysqlPreflightRetryDelay is how long a failed preflight Job is kept, with
+// the logs of its pods, before it is deleted to check the database again.
+const mysqlPreflightRetryDelay = 5 * time.Minute
+
+// mysqlPreflightState returns whether the named preflight Job succeeded, and
+// when it failed after exhausting its retries.
+func (r *OpenedxReconciler) mysqlPreflightState(instance *cachev1.Openedx, name string) (bool, *metav1.Time) {
+	job := &batchv1.Job{}
+
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: getOpenedxNamespace(instance),
+	}, job)
+
+	if err != nil {
+		log.Error(err, "mysql preflight job not found")
+		return false, nil
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return false, &c.LastTransitionTime
+		}
+	}
+	return job.Status.Succeeded > 0, nil
+}
+
+// retryMysqlPreflight deletes the named preflight Job once it has been kept
+// for mysqlPreflightRetryDelay after failing, so the next reconcile checks the
+// database again.
+func (r *OpenedxReconciler) retryMysqlPreflight(instance *cachev1.Openedx, name string, failedAt *metav1.Time) error {
+	if time.Since(failedAt.Time) < mysqlPreflightRetryDelay {
+		return nil
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: getOpenedxNamespace(instance),
+		},
+	}
+	err := r.Client.Delete(context.TODO(), job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Returns whether or not MySQL is running, which for an external database
+// means the preflight check passed
 func (r *OpenedxReconciler) isMysqlUp(instance *cachev1.Openedx) bool {
-	deployment := &appsv1.Deployment{}
+	if getOpenedxExternalDatabase(instance) != nil {
+		job, err := r.mysqlPreflightJob(instance)
+		if err != nil {
+			log.Error(err, "Failed to build the MySQL preflight Job")
+			return false
+		}
+		succeeded, _ := r.mysqlPreflightState(instance, job.Name)
+		return succeeded
+	}
+
+	statefulSet := &appsv1.StatefulSet{}
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
-		Name:      mysqlDeploymentName(instance),
-		Namespace: instance.Namespace,
-	}, deployment)
+		Name:      mysqlStatefulSetName(instance),
+		Namespace: getOpenedxNamespace(instance),
+	}, statefulSet)
 
 	if err != nil {
-		log.Error(err, "Deployment mysql not found")
+		log.Error(err, "StatefulSet mysql not found")
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if statefulSet.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMysqlAuthSecret(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := cachev1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	instance := &cachev1.Openedx{
+		ObjectMeta: metav1.ObjectMeta{Name: "openedx", Namespace: "openedx", UID: "uid"},
+	}
+	owned := func(name string) metav1.ObjectMeta {
+		meta := metav1.ObjectMeta{Name: name, Namespace: "openedx"}
+		ctrl.SetControllerReference(instance, &meta, s)
+		return meta
+	}
+
+	tests := []struct {
+		name   string
+		objs   []runtime.Object
+		legacy bool
+	}{
+		{"new platform", nil, false},
+		{"legacy Deployment", []runtime.Object{
+			&appsv1.Deployment{ObjectMeta: owned(mysqlStatefulSetName(instance))},
+		}, true},
+		{"legacy claim", []runtime.Object{
+			&corev1.PersistentVolumeClaim{ObjectMeta: owned("mysql")},
+		}, true},
+		{"claim of another platform", []runtime.Object{
+			&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "openedx"}},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		r := &OpenedxReconciler{Client: fake.NewFakeClientWithScheme(s, tt.objs...), Log: ctrl.Log, Scheme: s}
+		secret, err := r.mysqlAuthSecret(instance)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		data := secret.StringData
+		if data[mysqlUsernameKey] != "openedx" {
+			t.Errorf("%s: user %q, want openedx", tt.name, data[mysqlUsernameKey])
+		}
+		isLegacy := data[mysqlRootPasswordKey] == legacyMysqlRootPassword && data[mysqlPasswordKey] == legacyMysqlPassword
+		if isLegacy != tt.legacy {
+			t.Errorf("%s: legacy credentials %v, want %v", tt.name, isLegacy, tt.legacy)
+		}
+		if !tt.legacy && (len(data[mysqlRootPasswordKey]) != 16 || len(data[mysqlPasswordKey]) != 16) {
+			t.Errorf("%s: passwords not generated: %v", tt.name, data)
+		}
+	}
+}
+
+func TestMysqlPreflightJob(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := cachev1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	instance := &cachev1.Openedx{
+		ObjectMeta: metav1.ObjectMeta{Name: "openedx", Namespace: "openedx", UID: "uid"},
+		Spec: cachev1.OpenedxSpec{Database: &cachev1.DatabaseSpec{External: &cachev1.ExternalDatabaseSpec{
+			Host:              "db.example.com",
+			CredentialsSecret: "db-credentials",
+		}}},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-credentials", Namespace: "openedx"},
+		Data:       map[string][]byte{mysqlUsernameKey: []byte("openedx"), mysqlPasswordKey: []byte("secret")},
+	}
+	legacy := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: mysqlPreflightJobPrefix(instance), Namespace: "openedx"}}
+	ctrl.SetControllerReference(instance, legacy, s)
+	r := &OpenedxReconciler{Client: fake.NewFakeClientWithScheme(s, secret, legacy), Log: ctrl.Log, Scheme: s}
+
+	jobName := func() string {
+		job, err := r.mysqlPreflightJob(instance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job.Name
+	}
+
+	first := jobName()
+	if first != jobName() {
+		t.Errorf("the name of the Job is not stable")
+	}
+
+	// Each change of the database or of its credentials makes a new Job
+	names := map[string]bool{first: true}
+	for _, change := range []struct {
+		name   string
+		update func()
+	}{
+		{"host", func() { instance.Spec.Database.External.Host = "db2.example.com" }},
+		{"port", func() { instance.Spec.Database.External.Port = 3307 }},
+		{"database", func() { instance.Spec.Database.External.Database = "edxapp" }},
+		{"credentials", func() {
+			secret.Data[mysqlPasswordKey] = []byte("rotated")
+			if err := r.Client.Update(context.TODO(), secret); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	} {
+		change.update()
+		name := jobName()
+		if names[name] {
+			t.Errorf("%s: the Job is not run again", change.name)
+		}
+		names[name] = true
+	}
+
+	// The checks of the previous database are removed
+	current := jobName()
+	for name := range names {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openedx"}}
+		ctrl.SetControllerReference(instance, job, s)
+		if err := r.Client.Create(context.TODO(), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.deleteStaleJobs(instance, mysqlPreflightJobPrefix(instance), current); err != nil {
+		t.Fatal(err)
+	}
+	jobs := &batchv1.JobList{}
+	if err := r.Client.List(context.TODO(), jobs, client.InNamespace("openedx")); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs.Items) != 1 || jobs.Items[0].Name != current {
+		remaining := []string{}
+		for _, job := range jobs.Items {
+			remaining = append(remaining, job.Name)
+		}
+		t.Errorf("kept Jobs %v, want %s", remaining, current)
+	}
+}
@@ -6,15 +6,14 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-//newConfigMap returns a new ConfigMap instance for the given OpenedX.
+//newNamespace returns the target Namespace for the given OpenedX.
 func newNamespace(instance *cachev1.Openedx) *corev1.Namespace {
 	labels := labels(instance, "namespace")
 
 	return &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "openedx",
-			Namespace: "openedx",
-			Labels:    labels,
+			Name:   getOpenedxNamespace(instance),
+			Labels: labels,
 		},
 	}
 }
@@ -26,12 +26,12 @@ func nginxServiceName(instance *cachev1.Openedx) string {
 
 func (r *OpenedxReconciler) nginxDeployment(instance *cachev1.Openedx) *appsv1.Deployment {
 	labels := labels(instance, "nginx")
-	size := instance.Spec.Size
+	size := getOpenedxReplicas(instance, getOpenedxComponents(instance).Nginx)
 
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      nginxDeploymentName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
@@ -45,8 +45,9 @@ func (r *OpenedxReconciler) nginxDeployment(instance *cachev1.Openedx) *appsv1.D
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{{
-						Image: nginxImage,
-						Name:  "nginx",
+						Image:     nginxImage,
+						Name:      "nginx",
+						Resources: getOpenedxResources(getOpenedxComponents(instance).Nginx),
 						Ports: []corev1.ContainerPort{
 							{
 								ContainerPort: nginxPort,
@@ -91,7 +92,7 @@ func (r *OpenedxReconciler) nginxService(instance *cachev1.Openedx) *corev1.Serv
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      nginxServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -116,7 +117,7 @@ func (r *OpenedxReconciler) isNginxUp(instance *cachev1.Openedx) bool {
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
 		Name:      nginxDeploymentName(instance),
-		Namespace: instance.Namespace,
+		Namespace: getOpenedxNamespace(instance),
 	}, deployment)
 
 	if err != nil {
@@ -124,7 +125,7 @@ func (r *OpenedxReconciler) isNginxUp(instance *cachev1.Openedx) bool {
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if deployment.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
@@ -19,16 +19,24 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -42,13 +50,27 @@ var _ reconcile.Reconciler = &OpenedxReconciler{}
 // OpenedxReconciler reconciles a Openedx object
 // comment
 type OpenedxReconciler struct {
-	Client client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Client   client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=cache.operatortrain.me,resources=openedxes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cache.operatortrain.me,resources=openedxes/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=cache.operatortrain.me,resources=openedxes/finalizers,verbs=update
+// +kubebuilder:rbac:groups=cache.operatortrain.me,resources=openedxrestores,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=services;configmaps;secrets;persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=persistentvolumes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=extensions,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 // comment
 
 func (r *OpenedxReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
@@ -70,341 +92,504 @@ func (r *OpenedxReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
-	r.Log.Info("This operator only works with openedx namespace")
 
-	namespaceName := openedx.Name
-	if namespaceName == "openedx" {
-		r.Log.Info("Using openedx namespace")
-	} else {
-		r.Log.Info("Using ", namespaceName, " namespace")
+	if openedx.DeletionTimestamp != nil {
+		return r.finalizeOpenedx(openedx)
 	}
 
-	var result *reconcile.Result
-
-	// == namespace ======================
-
-	result, err = r.ensureNamespace(req, openedx, r.namespace(openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	// == Persistent Volume Claim ========
-
-	result, err = r.ensurePVC(req, openedx, r.persistencevolumeclaim("elasticsearch", "2Gi", openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	result, err = r.ensurePVC(req, openedx, r.persistencevolumeclaim("caddy", "1Gi", openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	result, err = r.ensurePVC(req, openedx, r.persistencevolumeclaim("mongodb", "5Gi", openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	result, err = r.ensurePVC(req, openedx, r.persistencevolumeclaim("mysql", "5Gi", openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	result, err = r.ensurePVC(req, openedx, r.persistencevolumeclaim("redis", "1Gi", openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	result, err = r.ensurePVC(req, openedx, r.persistencevolumeclaim("demo", "1Gi", openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	// == ConfigMap ========
-
-	result, err = r.ensureConfigMap(req, openedx, r.openedxConfig(openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	result, err = r.ensureConfigMap(req, openedx, r.openedxSettingsCmsConfig(openedx))
-	if result != nil {
-		return *result, err
+	// Teardown follows the deletion policy, see finalizeOpenedx
+	if err = r.ensureFinalizer(openedx); err != nil {
+		return reconcile.Result{}, err
 	}
 
-	result, err = r.ensureConfigMap(req, openedx, r.openedxSettingsLmsConfig(openedx))
-	if result != nil {
-		return *result, err
-	}
+	res, err := r.reconcileOpenedx(req, openedx)
 
-	result, err = r.ensureConfigMap(req, openedx, r.nginxConfig(openedx))
-	if result != nil {
-		return *result, err
+	// Report what was observed, even when reconciling stopped early
+	if statusErr := r.updateStatus(openedx, err); statusErr != nil && err == nil {
+		return reconcile.Result{}, statusErr
 	}
 
-	result, err = r.ensureConfigMap(req, openedx, r.mysqlInitdbConfig(openedx))
-	if result != nil {
-		return *result, err
+	// An invalid spec is reported in the status; retrying will not fix it
+	if isSpecError(err) {
+		r.Log.Error(err, "Invalid Openedx spec")
+		r.event(openedx, corev1.EventTypeWarning, "InvalidSpec", err.Error())
+		return reconcile.Result{}, nil
 	}
-
-	result, err = r.ensureConfigMap(req, openedx, r.caddyConfig(openedx))
-	if result != nil {
-		return *result, err
+	if err != nil {
+		r.event(openedx, corev1.EventTypeWarning, "ReconcileError", err.Error())
 	}
 
-	result, err = r.ensureConfigMap(req, openedx, r.redisConfig(openedx))
-	if result != nil {
-		return *result, err
-	}
+	return res, err
+}
 
-	// == SERVICE ========
+// reconcileOpenedx makes sure every component of the platform exists, along
+// the graph of their dependencies, see runSteps.
+func (r *OpenedxReconciler) reconcileOpenedx(req ctrl.Request, openedx *cachev1.Openedx) (ctrl.Result, error) {
+	var err error
 
-	result, err = r.ensureService(req, openedx, r.cmsService(openedx))
-	if result != nil {
-		return *result, err
-	}
+	r.Log.Info("Using " + getOpenedxNamespace(openedx) + " namespace")
 
-	result, err = r.ensureService(req, openedx, r.elasticsearchService(openedx))
-	if result != nil {
-		return *result, err
+	if err = validateOpenedx(openedx); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	result, err = r.ensureService(req, openedx, r.forumService(openedx))
-	if result != nil {
-		return *result, err
-	}
+	// == namespace ======================
 
-	result, err = r.ensureService(req, openedx, r.lmsService(openedx))
-	if result != nil {
-		return *result, err
+	namespace := func() (*reconcile.Result, error) {
+		if openedx.Spec.Namespace != nil && openedx.Spec.Namespace.Create {
+			return r.ensureNamespace(req, openedx, r.namespace(openedx))
+		}
+		return nil, nil
 	}
 
-	result, err = r.ensureService(req, openedx, r.redisService(openedx))
-	if result != nil {
-		return *result, err
-	}
+	// == Persistent Volume Claim ========
 
-	result, err = r.ensureService(req, openedx, r.mongodbService(openedx))
-	if result != nil {
-		return *result, err
+	volumes := func() (*reconcile.Result, error) {
+		for _, name := range getOpenedxStandaloneVolumes(openedx) {
+			if len(getOpenedxVolume(openedx, name).ExistingClaim) > 0 {
+				continue
+			}
+			result, err := r.ensurePVC(req, openedx, r.persistencevolumeclaim(name, openedx))
+			if result != nil {
+				return result, err
+			}
+		}
+		return nil, nil
 	}
 
-	result, err = r.ensureService(req, openedx, r.mysqlService(openedx))
-	if result != nil {
-		return *result, err
-	}
+	// == Secret ========
 
-	result, err = r.ensureService(req, openedx, r.nginxService(openedx))
-	if result != nil {
-		return *result, err
-	}
+	secrets := func() (*reconcile.Result, error) {
+		result, err := r.ensureSecret(req, openedx, mysqlAuthName(openedx), r.mysqlAuthSecret)
+		if result != nil {
+			return result, err
+		}
 
-	result, err = r.ensureService(req, openedx, r.caddyService(openedx))
-	if result != nil {
-		return *result, err
-	}
+		result, err = r.ensureSecret(req, openedx, openedxAuthName(openedx), r.openedxAuthSecret)
+		if result != nil {
+			return result, err
+		}
 
-	result, err = r.ensureService(req, openedx, r.smtpService(openedx))
-	if result != nil {
-		return *result, err
-	}
+		result, err = r.ensureSecret(req, openedx, forumAuthName(openedx), r.forumAuthSecret)
+		if result != nil {
+			return result, err
+		}
 
-	// == CADDY ========
-	result, err = r.ensureDeployment(req, openedx, r.caddyDeployment(openedx))
-	if result != nil {
-		return *result, err
-	}
+		if name := getOpenedxMongoDBAuthName(openedx); len(name) > 0 {
+			result, err = r.ensureSecret(req, openedx, name, nil)
+			if result != nil {
+				return result, err
+			}
+			// The credentials are part of the connection URI of the forum and the backups
+			path := field.NewPath("spec", "mongodb", "external", "credentialsSecret")
+			if err = r.validateURICredentials(openedx, path, name, mongodbUsernameKey, mongodbPasswordKey); err != nil {
+				return &reconcile.Result{}, err
+			}
+		}
 
-	// == CMS WORKER ==========
-	result, err = r.ensureDeployment(req, openedx, r.cmsworkerDeployment(openedx))
-	if result != nil {
-		return *result, err
-	}
+		switch getOpenedxBrokerType(openedx) {
+		case cachev1.BrokerRabbitMQ:
+			result, err = r.ensureSecret(req, openedx, rabbitmqAuthName(openedx), r.rabbitmqAuthSecret)
+			if result != nil {
+				return result, err
+			}
+		case cachev1.BrokerExternal:
+			result, err = r.ensureSecret(req, openedx, getOpenedxExternalBroker(openedx).URLSecret, nil)
+			if result != nil {
+				return result, err
+			}
+		}
 
-	// == CMS  ==========
-	result, err = r.ensureDeployment(req, openedx, r.cmsDeployment(openedx))
-	if result != nil {
-		return *result, err
-	}
+		for _, name := range getOpenedxSearchSecrets(openedx) {
+			result, err = r.ensureSecret(req, openedx, name, nil)
+			if result != nil {
+				return result, err
+			}
+		}
+		if search := getOpenedxExternalSearch(openedx); search != nil && len(search.BasicAuthSecret) > 0 {
+			// The credentials are part of the search URL of the forum
+			path := field.NewPath("spec", "search", "external", "basicAuthSecret")
+			if err = r.validateURICredentials(openedx, path, search.BasicAuthSecret, searchUsernameKey, searchPasswordKey); err != nil {
+				return &reconcile.Result{}, err
+			}
+		}
 
-	// == ELASTICSEARCH ========
-	result, err = r.ensureDeployment(req, openedx, r.elasticsearchDeployment(openedx))
-	if result != nil {
-		return *result, err
+		if s3 := getOpenedxBackupS3(openedx); s3 != nil {
+			result, err = r.ensureSecret(req, openedx, s3.CredentialsSecret, nil)
+			if result != nil {
+				return result, err
+			}
+		}
+		return nil, nil
 	}
 
-	// == FORUM ========
-	result, err = r.ensureDeployment(req, openedx, r.forumDeployment(openedx))
-	if result != nil {
-		return *result, err
-	}
+	// == ConfigMap ========
 
-	// == LMS WORKER ==========
-	result, err = r.ensureDeployment(req, openedx, r.lmsworkerDeployment(openedx))
-	if result != nil {
-		return *result, err
+	// The rendered ConfigMaps are only read by the steps depending on config,
+	// which run in a later wave
+	configMaps := []func(*cachev1.Openedx) (*corev1.ConfigMap, error){
+		r.openedxConfig,
+		r.openedxSettingsCmsConfig,
+		r.openedxSettingsLmsConfig,
+		r.nginxConfig,
+		r.caddyConfig,
+		r.redisConfig,
+	}
+	rendered := make(map[string]*corev1.ConfigMap, len(configMaps))
+	config := func() (*reconcile.Result, error) {
+		for _, configMap := range configMaps {
+			cm, err := configMap(openedx)
+			if err != nil {
+				return &reconcile.Result{}, err
+			}
+			rendered[cm.Name] = cm.DeepCopy()
+			result, err := r.ensureConfigMap(req, openedx, cm)
+			if result != nil {
+				return result, err
+			}
+		}
+		return nil, nil
 	}
-	// == LMS  ==========
 
-	result, err = r.ensureDeployment(req, openedx, r.lmsDeployment(openedx))
-	if result != nil {
-		return *result, err
-	}
+	// == SERVICE ========
 
-	// == REDIS ========
-	result, err = r.ensureDeployment(req, openedx, r.redisDeployment(openedx))
-	if result != nil {
-		return *result, err
-	}
+	services := func() (*reconcile.Result, error) {
+		desired := []*corev1.Service{
+			r.cmsService(openedx),
+			r.forumService(openedx),
+			r.lmsService(openedx),
+			r.redisService(openedx),
+			r.nginxService(openedx),
+			r.caddyService(openedx),
+			r.smtpService(openedx),
+		}
+		if getOpenedxExternalSearch(openedx) == nil {
+			desired = append(desired, r.elasticsearchService(openedx))
+		}
+		if getOpenedxBrokerType(openedx) == cachev1.BrokerRabbitMQ {
+			desired = append(desired, r.rabbitmqService(openedx))
+		}
+		if getOpenedxExternalMongoDB(openedx) == nil {
+			desired = append(desired, r.mongodbService(openedx))
+		}
+		if getOpenedxExternalDatabase(openedx) == nil {
+			desired = append(desired, r.mysqlService(openedx))
+		}
+		for _, ds := range r.getOpenedxDatastores(openedx) {
+			desired = append(desired, r.datastoreHeadlessService(openedx, ds.name, ds.serviceName, ds.port))
+		}
 
-	// == MONGODB ========
-	result, err = r.ensureDeployment(req, openedx, r.mongodbDeployment(openedx))
-	if result != nil {
-		return *result, err
-	}
+		for _, service := range desired {
+			result, err := r.ensureService(req, openedx, service)
+			if result != nil {
+				return result, err
+			}
+		}
+		return nil, nil
+	}
+
+	// == StatefulSet ========
+
+	// Ready once the pods of every datastore are, which the StatefulSet watch reports
+	datastores := func() (*reconcile.Result, error) {
+		for _, ds := range r.getOpenedxDatastores(openedx) {
+			sts := ds.statefulSet(openedx)
+
+			adopted, err := r.adoptLegacyClaim(openedx, sts, ds.name)
+			if err != nil {
+				return &reconcile.Result{}, err
+			}
+			if adopted {
+				adopted, err = r.replaceClaimTemplates(openedx, sts)
+				if err != nil {
+					return &reconcile.Result{}, err
+				}
+			}
+			if !adopted {
+				// Moving the data of the Deployment the datastore ran as, or to a new claim
+				delay := time.Second * time.Duration(5)
+
+				r.Log.Info(fmt.Sprintf("Adopting pvc %s for StatefulSet %s, waiting for %s", ds.name, sts.Name, delay))
+				return &reconcile.Result{RequeueAfter: delay}, nil
+			}
+
+			if err = r.stampConfigChecksum(sts.Namespace, &sts.Spec.Template, rendered); err != nil {
+				return &reconcile.Result{}, err
+			}
+			result, err := r.ensureStatefulSet(req, openedx, sts)
+			if result != nil {
+				return result, err
+			}
+		}
 
-	// == MYSQL ========
-	result, err = r.ensureDeployment(req, openedx, r.mysqlDeployment(openedx))
-	if result != nil {
-		return *result, err
-	}
+		// Claims are resized in place, the StatefulSet keeps the size it was created with
+		for _, vol := range r.getOpenedxVolumes(openedx) {
+			if err := r.reconcileVolume(openedx, vol); err != nil {
+				return &reconcile.Result{}, err
+			}
+		}
 
-	// == NGINX ========
-	result, err = r.ensureDeployment(req, openedx, r.nginxDeployment(openedx))
-	if result != nil {
-		return *result, err
+		for _, ds := range r.getOpenedxDatastores(openedx) {
+			if !ds.isUp(openedx) {
+				r.Log.Info(fmt.Sprintf("Datastore %s isn't ready, waiting for its StatefulSet", ds.name))
+				return &reconcile.Result{}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	// == Deployment ========
+
+	// Each pod template carries the checksum of the configuration it consumes,
+	// so a changed ConfigMap or Secret rolls exactly the Deployments using it.
+	held := isUpgradeHolding(openedx) || r.isRestoring(openedx)
+	maintenance := len(r.maintenanceReason(openedx)) > 0
+	// An upgrade or an OpenedxRestore stops whatever uses the databases while
+	// it changes them, a maintenance stops the workers
+	stopped := func(name string) bool {
+		return (held && isDatabaseDeployment(openedx, name)) || (maintenance && isWorkerDeployment(openedx, name))
+	}
+	deployments := func(desired ...*appsv1.Deployment) func() (*reconcile.Result, error) {
+		return func() (*reconcile.Result, error) {
+			for _, dep := range desired {
+				if stopped(dep.Name) {
+					replicas := int32(0)
+					dep.Spec.Replicas = &replicas
+				} else if isAutoscaled(openedx, dep.Name) && !r.isScaledDown(dep) {
+					// The HorizontalPodAutoscaler owns the replica count of an autoscaled
+					// Deployment, once it runs again, as it never scales up from zero
+					dep.Spec.Replicas = nil
+				}
+				if err := r.stampConfigChecksum(dep.Namespace, &dep.Spec.Template, rendered); err != nil {
+					return &reconcile.Result{}, err
+				}
+				result, err := r.ensureDeployment(req, openedx, dep)
+				if result != nil {
+					return result, err
+				}
+			}
+			return nil, nil
+		}
 	}
 
-	// == SMTP ========
-	result, err = r.ensureDeployment(req, openedx, r.smtpDeployment(openedx))
-	if result != nil {
-		return *result, err
+	// == HorizontalPodAutoscaler ========
+
+	autoscalers := func() (*reconcile.Result, error) {
+		for _, d := range getOpenedxAutoscaledDeployments(openedx) {
+			if d.autoscaler == nil || stopped(d.name) {
+				if err := r.deleteHPA(openedx, d.name); err != nil {
+					return &reconcile.Result{}, err
+				}
+				continue
+			}
+			result, err := r.ensureHPA(req, openedx, r.horizontalPodAutoscaler(openedx, d.name, d.autoscaler))
+			if result != nil {
+				return result, err
+			}
+		}
+		return nil, nil
 	}
 
 	// == JOB =======
 
-	//== LMS Job ========
-	result, err = r.ensureJob(req, openedx, r.lmsJob(openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	lmsjobComplete := r.isLmsJobDone(openedx)
-
-	if !lmsjobComplete {
-		// If lmsJob isn't complete, requeue the reconcile
-		// to run again after a delay
-		delay := time.Second * time.Duration(15)
-
-		r.Log.Info(fmt.Sprintf("Lms Job isn't Complete, waiting for %s", delay))
-		return reconcile.Result{RequeueAfter: delay}, nil
-	}
-
-	//== CMS Job ========
-	result, err = r.ensureJob(req, openedx, r.cmsJob(openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	cmsjobComplete := r.isCmsJobDone(openedx)
+	//== MySQL preflight Job ========
+	mysqlPreflight := func() (*reconcile.Result, error) {
+		if getOpenedxExternalDatabase(openedx) == nil {
+			return nil, nil
+		}
 
-	if !cmsjobComplete {
-		// If cmsJob isn't complete, requeue the reconcile
-		// to run again after a delay
-		delay := time.Second * time.Duration(15)
+		// A new database or new credentials make a new Job, the previous
+		// checks are removed
+		job, err := r.mysqlPreflightJob(openedx)
+		if err != nil {
+			return &reconcile.Result{}, err
+		}
+		if err = r.deleteStaleJobs(openedx, mysqlPreflightJobPrefix(openedx), job.Name); err != nil {
+			return &reconcile.Result{}, err
+		}
 
-		r.Log.Info(fmt.Sprintf("Cms Job isn't Complete, waiting for %s", delay))
-		return reconcile.Result{RequeueAfter: delay}, nil
-	}
+		result, err := r.ensureJob(req, openedx, job)
+		if result != nil {
+			return result, err
+		}
 
-	//== Forum Job ======
-	result, err = r.ensureJob(req, openedx, r.forumJob(openedx))
-	if result != nil {
-		return *result, err
+		succeeded, failedAt := r.mysqlPreflightState(openedx, job.Name)
+		if failedAt != nil {
+			// Keep the failed Job around for its logs, then check again
+			if err = r.retryMysqlPreflight(openedx, job.Name, failedAt); err != nil {
+				return &reconcile.Result{}, err
+			}
+			return &reconcile.Result{}, fmt.Errorf("preflight check of the external MySQL database failed, see the logs of Job %s",
+				job.Name)
+		}
+		if !succeeded {
+			r.Log.Info("MySQL preflight Job isn't Complete, waiting for it")
+			return &reconcile.Result{}, nil
+		}
+		return nil, nil
+	}
+
+	//== Migration Jobs ========
+	// Run again whenever the image or the settings they migrate to change.
+	// The status records their outcome, which the migrations write in parallel.
+	var migrationsMu sync.Mutex
+	migrations := make(map[string]step)
+	for _, m := range r.migrations(openedx) {
+		m := m
+		migrations[m.component] = step{
+			name: "migration-" + m.component,
+			run: func() (*reconcile.Result, error) {
+				migrationsMu.Lock()
+				defer migrationsMu.Unlock()
+				return r.reconcileMigration(req, openedx, m, rendered)
+			},
+		}
 	}
 
-	forumjobComplete := r.isForumJobDone(openedx)
+	// == CronJob ========
 
-	if !forumjobComplete {
-		// If forumJob isn't complete, requeue the reconcile
-		// to run again after a delay
-		delay := time.Second * time.Duration(15)
+	backup := func() (*reconcile.Result, error) {
+		if getOpenedxBackup(openedx) == nil {
+			if err := r.deleteBackupCronJob(openedx); err != nil {
+				return &reconcile.Result{}, err
+			}
+			return nil, nil
+		}
 
-		r.Log.Info(fmt.Sprintf("Forum Job isn't Complete, waiting for %s", delay))
-		return reconcile.Result{RequeueAfter: delay}, nil
+		cronJob := r.backupCronJob(openedx)
+		if held {
+			// A backup would catch the databases half restored or migrated
+			suspend := true
+			cronJob.Spec.Suspend = &suspend
+		}
+		return r.ensureCronJob(req, openedx, cronJob)
 	}
 
 	// == INGRESS ==========
 
-	result, err = r.ensureIngress(req, openedx, r.ingress("web", openedx))
-	if result != nil {
-		return *result, err
+	ingress := func() (*reconcile.Result, error) {
+		return r.ensureIngress(req, openedx, r.ingress("web", openedx))
 	}
 
 	//== Demo Job ========
-	result, err = r.ensureJob(req, openedx, r.demoJob(openedx))
-	if result != nil {
-		return *result, err
-	}
-
-	demojobComplete := r.isDemoJobDone(openedx)
-
-	if !demojobComplete {
-		// If demoJob isn't complete, requeue the reconcile
-		// to run again after a delay
-		delay := time.Second * time.Duration(15)
-
-		r.Log.Info(fmt.Sprintf("Demo Job isn't Complete, waiting for %s", delay))
-		return reconcile.Result{RequeueAfter: delay}, nil
-	}
+	demoCourse := func() (*reconcile.Result, error) {
+		result, err := r.ensureJob(req, openedx, r.demoJob(openedx))
+		if result != nil {
+			return result, err
+		}
 
-	// == Finish ==========
-	// Everything went fine, don't requeue
-	return ctrl.Result{}, nil
+		if !r.isDemoJobDone(openedx) {
+			r.Log.Info("Demo Job isn't Complete, waiting for it")
+			return &reconcile.Result{}, nil
+		}
+		return nil, nil
+	}
+
+	// == Upgrade ==========
+
+	upgrade := func() (*reconcile.Result, error) {
+		return r.reconcileUpgrade(req, openedx)
+	}
+
+	// == Graph ==========
+
+	// Jobs are watched, so a step waiting for one runs again once it completes
+	lmsMigration, cmsMigration, forumMigration := migrations["lms"], migrations["cms"], migrations["forum"]
+	lmsMigration.dependsOn = []string{"datastores", "mysql-preflight"}
+	cmsMigration.dependsOn = []string{lmsMigration.name}
+	forumMigration.dependsOn = []string{"datastores"}
+
+	steps := []step{
+		{name: "namespace", run: namespace},
+		{name: "volumes", dependsOn: []string{"namespace"}, run: volumes},
+		{name: "secrets", dependsOn: []string{"namespace"}, run: secrets},
+		{name: "config", dependsOn: []string{"namespace"}, run: config},
+		{name: "services", dependsOn: []string{"namespace"}, run: services},
+		{name: "datastores", dependsOn: []string{"volumes", "secrets", "config", "services"}, run: datastores},
+		{name: "mysql-preflight", dependsOn: []string{"secrets"}, run: mysqlPreflight},
+		lmsMigration,
+		cmsMigration,
+		forumMigration,
+		{name: "proxy", dependsOn: []string{"volumes", "config", "services"}, run: deployments(
+			r.caddyDeployment(openedx),
+			r.nginxDeployment(openedx),
+			r.smtpDeployment(openedx),
+		)},
+		{name: "openedx", dependsOn: []string{"volumes", cmsMigration.name}, run: deployments(
+			r.cmsworkerDeployment(openedx),
+			r.cmsDeployment(openedx),
+			r.lmsworkerDeployment(openedx),
+			r.lmsDeployment(openedx),
+		)},
+		{name: "forum", dependsOn: []string{forumMigration.name}, run: deployments(
+			r.forumDeployment(openedx),
+		)},
+		{name: "autoscalers", dependsOn: []string{"proxy", "openedx", "forum"}, run: autoscalers},
+		// Backups start once the migrations have created the databases
+		{name: "backup", dependsOn: []string{cmsMigration.name, forumMigration.name}, run: backup},
+		{name: "ingress", dependsOn: []string{"proxy"}, run: ingress},
+		{name: "demo-course", dependsOn: []string{"openedx", "ingress"}, run: demoCourse},
+	}
+
+	// A new release is only rolled out to a platform that is fully up
+	all := make([]string, 0, len(steps))
+	for _, s := range steps {
+		all = append(all, s.name)
+	}
+	steps = append(steps, step{name: "upgrade", dependsOn: all, run: upgrade})
+
+	return r.runSteps(steps)
 }
 
-// add comment
-
+// SetupWithManager watches the Openedx resources and every kind of object the
+// operator creates for them, so that an edit or a deletion is undone and the
+// completion of a Job lets the steps waiting for it go on, without polling.
 func (r *OpenedxReconciler) SetupWithManager(mgr ctrl.Manager) error {
-
-	// Create a new controller
-	c, err := controller.New("openedx-controller", mgr, controller.Options{Reconciler: r})
-	if err != nil {
-		return err
-	}
-
-	// Watch for changes to primary resource Openedx
-	err = c.Watch(&source.Kind{Type: &cachev1.Openedx{}}, &handler.EnqueueRequestForObject{})
-	if err != nil {
-		return err
-	}
-
-	// Watch for changes to Deployment
-	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForOwner{
-		IsController: true,
-		OwnerType:    &cachev1.Openedx{},
-	})
-	if err != nil {
-		return err
-	}
-
-	// Watch for changes to Service
-	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestForOwner{
-		IsController: true,
-		OwnerType:    &cachev1.Openedx{},
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("openedx-controller").
+		For(&cachev1.Openedx{}, builder.WithPredicates(ignoreStatusChurn))
+
+	// Owned objects are mapped to their Openedx through their controller
+	// reference, or their owner annotation when they live in spec.namespace
+	owned := []runtime.Object{
+		&corev1.Namespace{},
+		&corev1.PersistentVolumeClaim{},
+		&corev1.Secret{},
+		&corev1.ConfigMap{},
+		&corev1.Service{},
+		&appsv1.StatefulSet{},
+		&appsv1.Deployment{},
+		&autoscalingv2beta2.HorizontalPodAutoscaler{},
+		&batchv1.Job{},
+		&batchv1beta1.CronJob{},
+		&extv1beta1.Ingress{},
+	}
+	for _, obj := range owned {
+		b = b.Watches(&source.Kind{Type: obj}, enqueueOwner, builder.WithPredicates(ignoreStatusChurn))
+	}
+
+	// The backup Jobs are mapped to their Openedx, which reports their outcome
+	b = b.Watches(&source.Kind{Type: &batchv1.Job{}}, r.enqueueMatching(isBackupJob),
+		builder.WithPredicates(ignoreStatusChurn))
+
+	// The ConfigMaps and Secrets the user provides are mapped to the Openedx
+	// objects referencing them, so that their changes roll the pods
+	b = b.Watches(&source.Kind{Type: &corev1.ConfigMap{}}, r.enqueueReferencing(isUserConfigMap)).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, r.enqueueReferencing(isUserSecret))
+
+	// Watch for changes to OpenedxRestore, which scales the platform down and up
+	b = b.Watches(&source.Kind{Type: &cachev1.OpenedxRestore{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			restore, ok := obj.Object.(*cachev1.OpenedxRestore)
+			if !ok {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{
+				Name:      restore.Spec.OpenedxName,
+				Namespace: restore.Namespace,
+			}}}
+		}),
 	})
-	if err != nil {
-		return err
-	}
-
-	// Watch for change to pods
-	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestForOwner{
-		IsController: true,
-		OwnerType:    &cachev1.Openedx{},
-	})
-	if err != nil {
-		return err
-	}
 
-	return nil
+	return b.Complete(r)
 }
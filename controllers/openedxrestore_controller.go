@@ -0,0 +1,269 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+)
+
+// blank assignment to verify that OpenedxRestore implements reconcile.Reconciler
+var _ reconcile.Reconciler = &OpenedxRestoreReconciler{}
+
+// OpenedxRestoreReconciler reconciles a OpenedxRestore object
+type OpenedxRestoreReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// openedx returns an OpenedxReconciler sharing the client, to build and
+// ensure the objects of the platform the way its own controller does.
+func (r *OpenedxRestoreReconciler) openedx() *OpenedxReconciler {
+	return &OpenedxReconciler{
+		Client: r.Client,
+		Log:    r.Log,
+		Scheme: r.Scheme,
+	}
+}
+
+// +kubebuilder:rbac:groups=cache.operatortrain.me,resources=openedxrestores,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cache.operatortrain.me,resources=openedxrestores/status,verbs=get;update;patch
+
+// Reconcile steps a restore through its phases. The Openedx controller scales
+// the platform down as soon as the restore leaves Pending, and up again once
+// the indexes are rebuilt, so this controller only waits for it to do so.
+func (r *OpenedxRestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := r.Log.WithValues("Request.Namespace", req.Namespace, "Request.Name", req.Name)
+	reqLogger.Info("Reconciling OpenedxRestore")
+
+	restore := &cachev1.OpenedxRestore{}
+	err := r.Client.Get(context.TODO(), req.NamespacedName, restore)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, could have been deleted after reconcile request.
+			// Its Jobs are garbage collected, and the platform scales up again.
+			reqLogger.Info("OpenedxRestore resource not found. Ignoring since object must be deleted.")
+			return ctrl.Result{}, nil
+		}
+		reqLogger.Error(err, "Failed to get OpenedxRestore.")
+		return ctrl.Result{}, err
+	}
+
+	if restore.Status.Phase == cachev1.RestoreCompleted || restore.Status.Phase == cachev1.RestoreFailed {
+		return ctrl.Result{}, nil
+	}
+
+	openedx := &cachev1.Openedx{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      restore.Spec.OpenedxName,
+		Namespace: restore.Namespace,
+	}, openedx)
+	if errors.IsNotFound(err) {
+		return ctrl.Result{}, r.fail(restore, fmt.Sprintf("Openedx %s not found", restore.Spec.OpenedxName))
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	switch restore.Status.Phase {
+	case "", cachev1.RestorePending:
+		return r.start(restore, openedx)
+	case cachev1.RestoreScalingDown:
+		return r.waitForScaleDown(restore, openedx)
+	case cachev1.RestoreRestoringDatabases:
+		return r.restoreDatabases(req, restore, openedx)
+	case cachev1.RestoreRebuildingIndexes:
+		return r.rebuildIndexes(req, restore, openedx)
+	case cachev1.RestoreScalingUp:
+		return r.waitForScaleUp(restore, openedx)
+	}
+	return ctrl.Result{}, nil
+}
+
+// start checks the restore can run, then lets the platform scale down.
+func (r *OpenedxRestoreReconciler) start(restore *cachev1.OpenedxRestore, openedx *cachev1.Openedx) (ctrl.Result, error) {
+	if openedx.DeletionTimestamp != nil {
+		return ctrl.Result{}, r.fail(restore, fmt.Sprintf("Openedx %s is being deleted", openedx.Name))
+	}
+	if isUpgrading(openedx) {
+		return ctrl.Result{}, r.fail(restore, fmt.Sprintf("Openedx %s is being upgraded to %s", openedx.Name, openedx.Status.Upgrade.To))
+	}
+	if getOpenedxBackup(openedx) == nil {
+		return ctrl.Result{}, r.fail(restore, fmt.Sprintf("Openedx %s has no backup configured", openedx.Name))
+	}
+
+	active, err := getOpenedxRestore(r.Client, openedx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if active != nil && active.Name != restore.Name {
+		return ctrl.Result{}, r.fail(restore, fmt.Sprintf("Openedx %s is held by OpenedxRestore %s", openedx.Name, active.Name))
+	}
+
+	now := metav1.Now()
+	restore.Status.StartTime = &now
+	return ctrl.Result{}, r.setPhase(restore, cachev1.RestoreScalingDown, "Waiting for the platform to stop")
+}
+
+// waitForScaleDown waits until no pod of the Deployments using the databases runs.
+func (r *OpenedxRestoreReconciler) waitForScaleDown(restore *cachev1.OpenedxRestore, openedx *cachev1.Openedx) (ctrl.Result, error) {
+	running, err := runningDeployments(r.Client, openedx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if len(running) > 0 {
+		delay := time.Second * time.Duration(5)
+
+		r.Log.Info(fmt.Sprintf("Deployments %s are still running, waiting for %s", strings.Join(running, ", "), delay))
+		return reconcile.Result{RequeueAfter: delay}, nil
+	}
+
+	return ctrl.Result{}, r.setPhase(restore, cachev1.RestoreRestoringDatabases,
+		fmt.Sprintf("Restoring the databases from backup %s", restore.Spec.Backup))
+}
+
+// restoreDatabases runs the Job loading the archives, and waits for it.
+func (r *OpenedxRestoreReconciler) restoreDatabases(req ctrl.Request,
+	restore *cachev1.OpenedxRestore,
+	openedx *cachev1.Openedx,
+) (ctrl.Result, error) {
+	job := restoreJob(restore, openedx)
+	setRestoreOwner(restore, job, r.Scheme)
+
+	done, failed, err := r.runJob(req, openedx, job)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(failed) > 0 {
+		return ctrl.Result{}, r.fail(restore, failed+", the platform stays scaled down until the OpenedxRestore is deleted")
+	}
+	if !done {
+		delay := time.Second * time.Duration(10)
+
+		r.Log.Info(fmt.Sprintf("Restore Job isn't Complete, waiting for %s", delay))
+		return reconcile.Result{RequeueAfter: delay}, nil
+	}
+
+	return ctrl.Result{}, r.setPhase(restore, cachev1.RestoreRebuildingIndexes, "Rebuilding the course and forum search indexes")
+}
+
+// rebuildIndexes runs the Jobs indexing the restored courses and forum, and waits for them.
+func (r *OpenedxRestoreReconciler) rebuildIndexes(req ctrl.Request,
+	restore *cachev1.OpenedxRestore,
+	openedx *cachev1.Openedx,
+) (ctrl.Result, error) {
+	complete := true
+	for _, job := range []*batchv1.Job{reindexCoursesJob(restore, openedx), reindexForumJob(restore, openedx)} {
+		setRestoreOwner(restore, job, r.Scheme)
+
+		done, failed, err := r.runJob(req, openedx, job)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if len(failed) > 0 {
+			return ctrl.Result{}, r.fail(restore, failed)
+		}
+		complete = complete && done
+	}
+
+	if !complete {
+		delay := time.Second * time.Duration(10)
+
+		r.Log.Info(fmt.Sprintf("Reindex Jobs aren't Complete, waiting for %s", delay))
+		return reconcile.Result{RequeueAfter: delay}, nil
+	}
+
+	return ctrl.Result{}, r.setPhase(restore, cachev1.RestoreScalingUp, "Waiting for the platform to start")
+}
+
+// waitForScaleUp waits until the LMS, CMS and forum serve again.
+func (r *OpenedxRestoreReconciler) waitForScaleUp(restore *cachev1.OpenedxRestore, openedx *cachev1.Openedx) (ctrl.Result, error) {
+	platform := r.openedx()
+	if !platform.isLmsUp(openedx) || !platform.isCmsUp(openedx) || !platform.isforumUp(openedx) {
+		delay := time.Second * time.Duration(10)
+
+		r.Log.Info(fmt.Sprintf("Platform isn't up, waiting for %s", delay))
+		return reconcile.Result{RequeueAfter: delay}, nil
+	}
+
+	now := metav1.Now()
+	restore.Status.CompletionTime = &now
+	return ctrl.Result{}, r.setPhase(restore, cachev1.RestoreCompleted,
+		fmt.Sprintf("Restored backup %s", restore.Spec.Backup))
+}
+
+// runJob ensures the Job exists, and returns whether it succeeded, or why it failed.
+func (r *OpenedxRestoreReconciler) runJob(req ctrl.Request,
+	openedx *cachev1.Openedx,
+	job *batchv1.Job,
+) (bool, string, error) {
+	result, err := r.openedx().ensureJob(req, openedx, job)
+	if result != nil {
+		return false, "", err
+	}
+
+	return r.openedx().jobState(job.Name, job.Namespace)
+}
+
+// setPhase moves the restore to the next phase.
+func (r *OpenedxRestoreReconciler) setPhase(restore *cachev1.OpenedxRestore, phase cachev1.RestorePhase, message string) error {
+	r.Log.Info("OpenedxRestore phase : " + string(phase))
+
+	restore.Status.Phase = phase
+	restore.Status.Message = message
+	return r.Client.Status().Update(context.TODO(), restore)
+}
+
+// fail records the phase the restore failed in, and why.
+func (r *OpenedxRestoreReconciler) fail(restore *cachev1.OpenedxRestore, message string) error {
+	failedPhase := restore.Status.Phase
+	if len(failedPhase) == 0 {
+		failedPhase = cachev1.RestorePending
+	}
+	r.Log.Info(fmt.Sprintf("OpenedxRestore failed in phase %s: %s", failedPhase, message))
+
+	now := metav1.Now()
+	restore.Status.FailedPhase = failedPhase
+	restore.Status.CompletionTime = &now
+	return r.setPhase(restore, cachev1.RestoreFailed, message)
+}
+
+// SetupWithManager watches the OpenedxRestore resources and their Jobs. Each
+// phase moves to the next through the update of the status of the restore,
+// so status changes are not filtered out.
+func (r *OpenedxRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("openedxrestore-controller").
+		For(&cachev1.OpenedxRestore{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
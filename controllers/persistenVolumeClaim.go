@@ -3,33 +3,25 @@ package controllers
 import (
 	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-func (r *OpenedxReconciler) persistencevolumeclaim(name string, size string, instance *cachev1.Openedx) *corev1.PersistentVolumeClaim {
+func (r *OpenedxReconciler) persistencevolumeclaim(name string, instance *cachev1.Openedx) *corev1.PersistentVolumeClaim {
 	labels := labels(instance, "pvc")
 
 	pvc := &corev1.PersistentVolumeClaim{
 
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
-		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{
-				"ReadWriteOnce",
-			},
-			Resources: corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse(size),
-				},
-			},
-		},
+		Spec: volumeClaimSpec(instance, name),
 	}
 
-	controllerutil.SetControllerReference(instance, pvc, r.Scheme)
+	if !getOpenedxVolume(instance, name).RetainOnDelete {
+		controllerutil.SetControllerReference(instance, pvc, r.Scheme)
+	}
 	return pvc
 }
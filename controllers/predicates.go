@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// readiness returns the part of the status of an object the steps of the
+// reconcile wait on, or nil for the kinds they do not wait on.
+func readiness(obj runtime.Object) interface{} {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return [3]int32{o.Status.Replicas, o.Status.ReadyReplicas, o.Status.AvailableReplicas}
+	case *appsv1.StatefulSet:
+		// The upgrade of the datastores waits for their rollout
+		return struct {
+			replicas, ready, updated int32
+			revision                 string
+		}{o.Status.Replicas, o.Status.ReadyReplicas, o.Status.UpdatedReplicas, o.Status.CurrentRevision}
+	case *batchv1.Job:
+		return [3]int32{o.Status.Succeeded, o.Status.Failed, int32(len(o.Status.Conditions))}
+	case *batchv1beta1.CronJob:
+		// The backup status reports when it last ran
+		return struct {
+			lastSchedule *metav1.Time
+			active       int
+		}{o.Status.LastScheduleTime, len(o.Status.Active)}
+	case *corev1.PersistentVolumeClaim:
+		// Reported while the claim is resized
+		return struct {
+			phase      corev1.PersistentVolumeClaimPhase
+			capacity   string
+			conditions int
+		}{o.Status.Phase, o.Status.Capacity.Storage().String(), len(o.Status.Conditions)}
+	}
+	return nil
+}
+
+// withoutStatus returns the content of an object but for its status and the
+// fields the API server changes on every write.
+func withoutStatus(obj runtime.Object) map[string]interface{} {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil
+	}
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "resourceVersion")
+		delete(metadata, "managedFields")
+	}
+	return content
+}
+
+// ignoreStatusChurn drops the updates that only change the status of an
+// object, such as those the operator makes to the status of an Openedx or
+// the HorizontalPodAutoscalers make to theirs, unless the reconcile waits
+// on the part of the status that changed.
+var ignoreStatusChurn = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return !reflect.DeepEqual(readiness(e.ObjectOld), readiness(e.ObjectNew)) ||
+			!reflect.DeepEqual(withoutStatus(e.ObjectOld), withoutStatus(e.ObjectNew))
+	},
+}
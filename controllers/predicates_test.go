@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"testing"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestIgnoreStatusChurn(t *testing.T) {
+	objectMeta := metav1.ObjectMeta{Name: "lms", Namespace: "openedx", ResourceVersion: "1"}
+	now := metav1.Now()
+	replicas := int32(2)
+
+	tests := []struct {
+		name   string
+		old    runtime.Object
+		update func(runtime.Object)
+		want   bool
+	}{
+		{"deployment spec", &appsv1.Deployment{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*appsv1.Deployment).Spec.Replicas = &replicas
+		}, true},
+		{"deployment status", &appsv1.Deployment{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*appsv1.Deployment).Status.ObservedGeneration = 2
+		}, false},
+		{"deployment readiness", &appsv1.Deployment{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*appsv1.Deployment).Status.AvailableReplicas = 1
+		}, true},
+
+		{"statefulset spec", &appsv1.StatefulSet{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*appsv1.StatefulSet).Spec.Replicas = &replicas
+		}, true},
+		{"statefulset status", &appsv1.StatefulSet{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*appsv1.StatefulSet).Status.ObservedGeneration = 2
+		}, false},
+		{"statefulset readiness", &appsv1.StatefulSet{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*appsv1.StatefulSet).Status.ReadyReplicas = 1
+		}, true},
+		{"statefulset rollout", &appsv1.StatefulSet{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*appsv1.StatefulSet).Status.CurrentRevision = "lms-1"
+		}, true},
+
+		{"job spec", &batchv1.Job{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*batchv1.Job).Spec.Parallelism = &replicas
+		}, true},
+		{"job status", &batchv1.Job{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*batchv1.Job).Status.StartTime = &now
+		}, false},
+		{"job readiness", &batchv1.Job{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*batchv1.Job).Status.Succeeded = 1
+		}, true},
+
+		{"cronjob spec", &batchv1beta1.CronJob{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*batchv1beta1.CronJob).Spec.Schedule = "0 2 * * *"
+		}, true},
+		{"cronjob readiness", &batchv1beta1.CronJob{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*batchv1beta1.CronJob).Status.LastScheduleTime = &now
+		}, true},
+		{"cronjob active", &batchv1beta1.CronJob{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*batchv1beta1.CronJob).Status.Active = []corev1.ObjectReference{{Name: "lms-1"}}
+		}, true},
+
+		{"pvc spec", &corev1.PersistentVolumeClaim{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*corev1.PersistentVolumeClaim).Spec.VolumeName = "pv"
+		}, true},
+		{"pvc status", &corev1.PersistentVolumeClaim{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*corev1.PersistentVolumeClaim).Status.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+		}, false},
+		{"pvc readiness", &corev1.PersistentVolumeClaim{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*corev1.PersistentVolumeClaim).Status.Capacity = corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse("10Gi"),
+			}
+		}, true},
+
+		{"hpa spec", &autoscalingv2beta2.HorizontalPodAutoscaler{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*autoscalingv2beta2.HorizontalPodAutoscaler).Spec.MaxReplicas = 4
+		}, true},
+		{"hpa status", &autoscalingv2beta2.HorizontalPodAutoscaler{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*autoscalingv2beta2.HorizontalPodAutoscaler).Status.CurrentReplicas = 3
+		}, false},
+
+		{"openedx spec", &cachev1.Openedx{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*cachev1.Openedx).Spec.Version = "lilac"
+		}, true},
+		{"openedx status", &cachev1.Openedx{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*cachev1.Openedx).Status.Phase = cachev1.PhaseReady
+		}, false},
+		{"openedx labels", &cachev1.Openedx{ObjectMeta: objectMeta}, func(o runtime.Object) {
+			o.(*cachev1.Openedx).Labels = map[string]string{"team": "learning"}
+		}, true},
+	}
+
+	for _, tt := range tests {
+		updated := tt.old.DeepCopyObject()
+		tt.update(updated)
+		// The API server bumps the resource version on every write
+		accessor, err := meta.Accessor(updated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessor.SetResourceVersion("2")
+
+		e := event.UpdateEvent{ObjectOld: tt.old, ObjectNew: updated}
+		if got := ignoreStatusChurn.Update(e); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
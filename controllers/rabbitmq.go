@@ -16,7 +16,7 @@ import (
 const rabbitmqPort = 5672
 const rabbitmqImage = "docker.io/rabbitmq:3.6.10-management-alpine"
 
-func rabbitmqDeploymentName(instance *cachev1.Openedx) string {
+func rabbitmqStatefulSetName(instance *cachev1.Openedx) string {
 	return instance.Name + "-rabbitmq"
 }
 
@@ -24,53 +24,66 @@ func rabbitmqServiceName(instance *cachev1.Openedx) string {
 	return "rabbitmq"
 }
 
-func (r *OpenedxReconciler) rabbitmqDeployment(instance *cachev1.Openedx) *appsv1.Deployment {
+// Keys of the RabbitMQ Secret.
+const (
+	rabbitmqUsernameKey = "username"
+	rabbitmqPasswordKey = "password"
+)
+
+func rabbitmqAuthName(instance *cachev1.Openedx) string {
+	if instance.Spec.Secrets != nil && len(instance.Spec.Secrets.RabbitMQ) > 0 {
+		return instance.Spec.Secrets.RabbitMQ
+	}
+	return "rabbitmq-auth"
+}
+
+// rabbitmqAuthSecret generates the credentials of the Celery broker user.
+func (r *OpenedxReconciler) rabbitmqAuthSecret(instance *cachev1.Openedx) (*corev1.Secret, error) {
+	password, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := newSecret(rabbitmqAuthName(instance), instance)
+	secret.StringData = map[string]string{
+		rabbitmqUsernameKey: "openedx",
+		rabbitmqPasswordKey: password,
+	}
+	controllerutil.SetControllerReference(instance, secret, r.Scheme)
+	return secret, nil
+}
+
+func (r *OpenedxReconciler) rabbitmqStatefulSet(instance *cachev1.Openedx) *appsv1.StatefulSet {
 	labels := labels(instance, "rabbitmq")
-	size := instance.Spec.Size
+	size := getOpenedxDatastoreReplicas(getOpenedxComponents(instance).RabbitMQ)
 
-	deployment := &appsv1.Deployment{
+	template := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      rabbitmqDeploymentName(instance),
-			Namespace: instance.Namespace,
-			Labels:    labels,
+			Labels: labels,
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &size,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{{
-						Name: "rabbitmq-data",
-						VolumeSource: corev1.VolumeSource{
-							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-								ClaimName: "rabbitmq",
-							},
-						},
-					}},
-					Containers: []corev1.Container{{
-						Image: rabbitmqImage,
-						Name:  "rabbitmq-server",
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: rabbitmqPort,
-							Name:          "rabbitmq",
-						}},
-						VolumeMounts: []corev1.VolumeMount{{
-							Name:      "rabbitmq-data",
-							MountPath: "/var/lib/rabbitmq",
-						}},
-					}},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image: rabbitmqImage,
+				Name:  "rabbitmq-server",
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: rabbitmqPort,
+					Name:          "rabbitmq",
+				}},
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      datastoreClaimName,
+					MountPath: "/var/lib/rabbitmq",
+				}},
+				Env: []corev1.EnvVar{
+					secretEnvVar("RABBITMQ_DEFAULT_USER", rabbitmqAuthName(instance), rabbitmqUsernameKey),
+					secretEnvVar("RABBITMQ_DEFAULT_PASS", rabbitmqAuthName(instance), rabbitmqPasswordKey),
 				},
-			},
+			}},
 		},
 	}
 
-	controllerutil.SetControllerReference(instance, deployment, r.Scheme)
-	return deployment
+	statefulSet := datastoreStatefulSet(instance, rabbitmqStatefulSetName(instance), rabbitmqServiceName(instance), size, "rabbitmq", template)
+	controllerutil.SetControllerReference(instance, statefulSet, r.Scheme)
+	return statefulSet
 }
 
 func (r *OpenedxReconciler) rabbitmqService(instance *cachev1.Openedx) *corev1.Service {
@@ -79,7 +92,7 @@ func (r *OpenedxReconciler) rabbitmqService(instance *cachev1.Openedx) *corev1.S
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      rabbitmqServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -89,7 +102,6 @@ func (r *OpenedxReconciler) rabbitmqService(instance *cachev1.Openedx) *corev1.S
 				Protocol:   corev1.ProtocolTCP,
 				Port:       rabbitmqPort,
 				TargetPort: intstr.FromInt(rabbitmqPort),
-				NodePort:   30090,
 			}},
 		},
 	}
@@ -98,21 +110,21 @@ func (r *OpenedxReconciler) rabbitmqService(instance *cachev1.Openedx) *corev1.S
 	return service
 }
 
-// Returns whether or not the rabbitmq deployment is running
+// Returns whether or not the rabbitmq StatefulSet is running
 func (r *OpenedxReconciler) israbbitmqUp(instance *cachev1.Openedx) bool {
-	deployment := &appsv1.Deployment{}
+	statefulSet := &appsv1.StatefulSet{}
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
-		Name:      rabbitmqDeploymentName(instance),
-		Namespace: instance.Namespace,
-	}, deployment)
+		Name:      rabbitmqStatefulSetName(instance),
+		Namespace: getOpenedxNamespace(instance),
+	}, statefulSet)
 
 	if err != nil {
-		log.Error(err, "Deployment rabbitmq not found\n")
+		log.Error(err, "StatefulSet rabbitmq not found")
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if statefulSet.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
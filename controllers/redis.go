@@ -13,10 +13,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-const redisImage = "docker.io/redis:6.0.9"
 const redisPort = 6379
 
-func redisDeploymentName(instance *cachev1.Openedx) string {
+func redisStatefulSetName(instance *cachev1.Openedx) string {
 	return instance.Name + "-redis"
 }
 
@@ -24,75 +23,61 @@ func redisServiceName(instance *cachev1.Openedx) string {
 	return "redis"
 }
 
-func (r *OpenedxReconciler) redisDeployment(instance *cachev1.Openedx) *appsv1.Deployment {
+// getOpenedxRedisImage will return the image of the in-cluster Redis.
+func getOpenedxRedisImage(cr *cachev1.Openedx) string {
+	return getOpenedxDatastoreRelease(cr).redisImage
+}
+
+func (r *OpenedxReconciler) redisStatefulSet(instance *cachev1.Openedx) *appsv1.StatefulSet {
 	labels := labels(instance, "redis")
-	size := instance.Spec.Size
+	size := getOpenedxDatastoreReplicas(getOpenedxComponents(instance).Redis)
 
-	deployment := &appsv1.Deployment{
+	template := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      redisDeploymentName(instance),
-			Namespace: instance.Namespace,
-			Labels:    labels,
+			Labels: labels,
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &size,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						{
-							Name: "data",
-							VolumeSource: corev1.VolumeSource{
-								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-									ClaimName: "redis",
-								},
-							},
-						}, {
-							Name: "redis-config",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "redis-config",
-									},
-								},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{
+					Name: "redis-config",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "redis-config",
 							},
 						},
 					},
-					Containers: []corev1.Container{{
-						Args: []string{
-							"redis-server",
-							"/openedx/redis/config/redis.conf",
-						},
-						WorkingDir: "/openedx/redis/data",
-						Image:      redisImage,
-						Name:       redisServiceName(instance),
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: redisPort,
-							Name:          "redis",
-						}},
-						VolumeMounts: []corev1.VolumeMount{
-							{
-								Name:      "redis-config",
-								MountPath: "/openedx/redis/config/",
-							},
-							{
-								Name:      "data",
-								MountPath: "/openedx/redis/data",
-							},
-						},
-					}},
 				},
 			},
+			Containers: []corev1.Container{{
+				Args: []string{
+					"redis-server",
+					"/openedx/redis/config/redis.conf",
+				},
+				WorkingDir: "/openedx/redis/data",
+				Image:      getOpenedxRedisImage(instance),
+				Name:       redisServiceName(instance),
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: redisPort,
+					Name:          "redis",
+				}},
+				VolumeMounts: []corev1.VolumeMount{
+					{
+						Name:      "redis-config",
+						MountPath: "/openedx/redis/config/",
+					},
+					{
+						Name:      datastoreClaimName,
+						MountPath: "/openedx/redis/data",
+					},
+				},
+			}},
 		},
 	}
 
-	controllerutil.SetControllerReference(instance, deployment, r.Scheme)
-	return deployment
+	statefulSet := datastoreStatefulSet(instance, redisStatefulSetName(instance), redisServiceName(instance), size, "redis", template)
+	controllerutil.SetControllerReference(instance, statefulSet, r.Scheme)
+	return statefulSet
 }
 
 func (r *OpenedxReconciler) redisService(instance *cachev1.Openedx) *corev1.Service {
@@ -101,7 +86,7 @@ func (r *OpenedxReconciler) redisService(instance *cachev1.Openedx) *corev1.Serv
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      redisServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -119,22 +104,22 @@ func (r *OpenedxReconciler) redisService(instance *cachev1.Openedx) *corev1.Serv
 	return service
 }
 
-// Returns whether or not the Memcached deployment is running
+// Returns whether or not the Redis StatefulSet is running
 func (r *OpenedxReconciler) isRedisdUp(instance *cachev1.Openedx) bool {
 
-	deployment := &appsv1.Deployment{}
+	statefulSet := &appsv1.StatefulSet{}
 
 	err := r.Client.Get(context.TODO(), types.NamespacedName{
-		Name:      redisDeploymentName(instance),
-		Namespace: instance.Namespace,
-	}, deployment)
+		Name:      redisStatefulSetName(instance),
+		Namespace: getOpenedxNamespace(instance),
+	}, statefulSet)
 
 	if err != nil {
-		log.Error(err, "Deployment Redis not found")
+		log.Error(err, "StatefulSet Redis not found")
 		return false
 	}
 
-	if deployment.Status.ReadyReplicas == 1 {
+	if statefulSet.Status.ReadyReplicas >= 1 {
 		return true
 	}
 
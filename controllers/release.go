@@ -0,0 +1,542 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/log"
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// release is an Open edX release the operator deploys.
+type release struct {
+	name string
+	// openedxImage runs the LMS, the CMS, their workers and their Jobs.
+	openedxImage string
+	forumImage   string
+	// Images of the datastores run in the cluster, and of the backup and
+	// restore Jobs using their clients.
+	mysqlImage         string
+	mongodbImage       string
+	elasticsearchImage string
+	redisImage         string
+	// mongodbFeatureVersion is the featureCompatibilityVersion MongoDB is set
+	// to once it runs mongodbImage. The MongoDB of the next release only
+	// starts on data of the previous feature version.
+	mongodbFeatureVersion string
+	// searchDataDir is the directory of the data volume the in-cluster
+	// Elasticsearch keeps its indices in. A release whose Elasticsearch cannot
+	// read the indices of the previous one starts from a new directory, and
+	// the courses are indexed again.
+	searchDataDir string
+	// settings names the settings templates of the release, see render.Config.Release.
+	settings string
+}
+
+// releases is the catalog of the supported releases, oldest first. Open edX
+// only migrates from one release to the next, so upgrades walk this list.
+var releases = []release{
+	{
+		name:         "koa",
+		openedxImage: "docker.io/overhangio/openedx:11.2.3",
+		forumImage:   "docker.io/overhangio/openedx-forum:11.2.3",
+
+		mysqlImage:            "docker.io/mysql:5.7.32",
+		mongodbImage:          "docker.io/mongo:3.6.18",
+		elasticsearchImage:    "docker.io/elasticsearch:1.5.2",
+		redisImage:            "docker.io/redis:6.0.9",
+		mongodbFeatureVersion: "3.6",
+
+		settings: "koa",
+	},
+	{
+		name:         "lilac",
+		openedxImage: "docker.io/overhangio/openedx:12.2.0",
+		forumImage:   "docker.io/overhangio/openedx-forum:12.0.0",
+
+		mysqlImage:            "docker.io/mysql:5.7.34",
+		mongodbImage:          "docker.io/mongo:4.0.25",
+		elasticsearchImage:    "docker.io/elasticsearch:7.10.1",
+		redisImage:            "docker.io/redis:6.2.1",
+		mongodbFeatureVersion: "4.0",
+		// Elasticsearch 7 refuses the indices of Elasticsearch 1
+		searchDataDir: "7",
+
+		settings: "lilac",
+	},
+	{
+		name:         "maple",
+		openedxImage: "docker.io/overhangio/openedx:13.3.1",
+		forumImage:   "docker.io/overhangio/openedx-forum:13.0.0",
+
+		mysqlImage:            "docker.io/mysql:5.7.35",
+		mongodbImage:          "docker.io/mongo:4.2.17",
+		elasticsearchImage:    "docker.io/elasticsearch:7.10.1",
+		redisImage:            "docker.io/redis:6.2.6",
+		mongodbFeatureVersion: "4.2",
+		searchDataDir:         "7",
+
+		settings: "maple",
+	},
+}
+
+// defaultRelease is the release of platforms that do not set spec.version,
+// and the one the operator deployed before releases could be chosen.
+const defaultRelease = "koa"
+
+// releaseIndex returns the position of the named release in the catalog, or -1.
+func releaseIndex(name string) int {
+	for i, rel := range releases {
+		if rel.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// getRelease returns the named release of the catalog.
+func getRelease(name string) release {
+	if i := releaseIndex(name); i >= 0 {
+		return releases[i]
+	}
+	return releases[releaseIndex(defaultRelease)]
+}
+
+// getOpenedxVersion will return the release the platform should run.
+func getOpenedxVersion(cr *cachev1.Openedx) string {
+	if len(cr.Spec.Version) > 0 {
+		return cr.Spec.Version
+	}
+	return defaultRelease
+}
+
+// getOpenedxInstalledVersion will return the release the platform was last
+// fully upgraded to. A platform deployed before the release was recorded
+// runs the default release, a new one starts on the release of its spec.
+func getOpenedxInstalledVersion(cr *cachev1.Openedx) string {
+	if len(cr.Status.Version) > 0 {
+		return cr.Status.Version
+	}
+	if len(cr.Status.Phase) > 0 {
+		return defaultRelease
+	}
+	return getOpenedxVersion(cr)
+}
+
+// isUpgrading reports whether an upgrade is in progress.
+func isUpgrading(cr *cachev1.Openedx) bool {
+	return cr.Status.Upgrade != nil && cr.Status.Upgrade.Step != cachev1.UpgradeCompleted
+}
+
+// getOpenedxRelease will return the release deployed now. During an upgrade
+// the previous release keeps running until its components are stopped, and
+// the migrations run on the new one.
+func getOpenedxRelease(cr *cachev1.Openedx) release {
+	if isUpgrading(cr) {
+		switch cr.Status.Upgrade.Step {
+		case cachev1.UpgradeMigrating, cachev1.UpgradeRollingOut:
+			return getRelease(cr.Status.Upgrade.To)
+		default:
+			return getRelease(cr.Status.Upgrade.From)
+		}
+	}
+	return getRelease(getOpenedxInstalledVersion(cr))
+}
+
+// getOpenedxDatastoreRelease will return the release of the datastores run
+// in the cluster. During an upgrade they move to the new release once the
+// components using them are stopped, before the migrations.
+func getOpenedxDatastoreRelease(cr *cachev1.Openedx) release {
+	if isUpgrading(cr) {
+		switch cr.Status.Upgrade.Step {
+		case cachev1.UpgradeDatastores, cachev1.UpgradeMigrating, cachev1.UpgradeRollingOut:
+			return getRelease(cr.Status.Upgrade.To)
+		default:
+			return getRelease(cr.Status.Upgrade.From)
+		}
+	}
+	return getRelease(getOpenedxInstalledVersion(cr))
+}
+
+// getOpenedxImage will return the image of the LMS, the CMS, their workers and their Jobs.
+func getOpenedxImage(cr *cachev1.Openedx) string {
+	return getOpenedxRelease(cr).openedxImage
+}
+
+// getOpenedxForumImage will return the image of the forum and its Job.
+func getOpenedxForumImage(cr *cachev1.Openedx) string {
+	return getOpenedxRelease(cr).forumImage
+}
+
+// isUpgradeHolding reports whether the upgrade keeps the components using the
+// databases stopped: from when the previous release is stopped until the
+// datastores are upgraded and the migrations of the new one have run.
+func isUpgradeHolding(cr *cachev1.Openedx) bool {
+	if !isUpgrading(cr) {
+		return false
+	}
+	step := cr.Status.Upgrade.Step
+	return step == cachev1.UpgradeScalingDown || step == cachev1.UpgradeDatastores || step == cachev1.UpgradeMigrating
+}
+
+func upgradeBackupJobName(instance *cachev1.Openedx, to string) string {
+	return backupCronJobName(instance) + "-" + to
+}
+
+// upgradeBackupJob runs the backup CronJob once, before upgrading to the
+// release to.
+func (r *OpenedxReconciler) upgradeBackupJob(instance *cachev1.Openedx, to string) *batchv1.Job {
+	template := r.backupCronJob(instance).Spec.JobTemplate
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upgradeBackupJobName(instance, to),
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    template.Labels,
+		},
+		Spec: template.Spec,
+	}
+
+	controllerutil.SetControllerReference(instance, job, r.Scheme)
+	return job
+}
+
+func mongodbUpgradeJobName(instance *cachev1.Openedx, to string) string {
+	return mongodbStatefulSetName(instance) + "-upgrade-" + to
+}
+
+// mongodbUpgradeJob sets the feature compatibility version of the in-cluster
+// MongoDB to the one of the release to, once MongoDB runs its image.
+func (r *OpenedxReconciler) mongodbUpgradeJob(instance *cachev1.Openedx, to release) *batchv1.Job {
+	labels := labels(instance, "mongodb-upgrade")
+	command := fmt.Sprintf("assert.commandWorked(db.adminCommand({setFeatureCompatibilityVersion: %q}))",
+		to.mongodbFeatureVersion)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mongodbUpgradeJobName(instance, to.name),
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyOnFailure,
+					Containers: []corev1.Container{{
+						Command: []string{"mongo", "--host", getOpenedxMongoDBHosts(instance)[0], "--eval", command},
+						Image:   to.mongodbImage,
+						Name:    "mongodb-upgrade",
+					}},
+				},
+			},
+		},
+	}
+
+	controllerutil.SetControllerReference(instance, job, r.Scheme)
+	return job
+}
+
+func reindexJobName(instance *cachev1.Openedx, to string) string {
+	return instance.Name + "-reindex-" + to
+}
+
+// reindexJob indexes every course again, in the indices the in-cluster
+// search of the release to starts empty.
+func (r *OpenedxReconciler) reindexJob(instance *cachev1.Openedx, to string) *batchv1.Job {
+	job := r.cmsJob(instance)
+	job.Name = reindexJobName(instance, to)
+	job.Spec.Template.Spec.Containers[0].Args = []string{
+		"./manage.py",
+		"cms",
+		"reindex_course",
+		"--all",
+		"--setup",
+	}
+	return job
+}
+
+// upgradingDatastores returns the in-cluster datastores whose StatefulSet
+// does not run its desired images on every replica yet.
+func (r *OpenedxReconciler) upgradingDatastores(instance *cachev1.Openedx) ([]string, error) {
+	var upgrading []string
+	for _, ds := range r.getOpenedxDatastores(instance) {
+		desired := ds.statefulSet(instance)
+		found := &appsv1.StatefulSet{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{
+			Name:      desired.Name,
+			Namespace: desired.Namespace,
+		}, found)
+		if errors.IsNotFound(err) {
+			upgrading = append(upgrading, ds.name)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !isRolledOut(found, desired) {
+			upgrading = append(upgrading, ds.name)
+		}
+	}
+	return upgrading, nil
+}
+
+// isRolledOut reports whether every replica of found runs the images of desired.
+func isRolledOut(found, desired *appsv1.StatefulSet) bool {
+	containers := found.Spec.Template.Spec.Containers
+	for i, c := range desired.Spec.Template.Spec.Containers {
+		if i >= len(containers) || containers[i].Image != c.Image {
+			return false
+		}
+	}
+
+	replicas := int32(1)
+	if found.Spec.Replicas != nil {
+		replicas = *found.Spec.Replicas
+	}
+	status := found.Status
+	return status.ObservedGeneration >= found.Generation &&
+		status.CurrentRevision == status.UpdateRevision &&
+		status.UpdatedReplicas == replicas &&
+		status.ReadyReplicas == replicas
+}
+
+// jobState returns whether the named Job succeeded, and why it failed.
+func (r *OpenedxReconciler) jobState(name, namespace string) (bool, string, error) {
+	job := &batchv1.Job{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: namespace,
+	}, job)
+	if errors.IsNotFound(err) {
+		return false, "", nil
+	} else if err != nil {
+		return false, "", err
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return false, fmt.Sprintf("Job %s failed: %s", job.Name, c.Message), nil
+		}
+	}
+	return job.Status.Succeeded > 0, "", nil
+}
+
+// deleteJob removes a Job of the platform and its pods. Jobs the operator
+// does not own are left alone.
+func (r *OpenedxReconciler) deleteJob(instance *cachev1.Openedx, name string) error {
+	job := &batchv1.Job{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: getOpenedxNamespace(instance),
+	}, job)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !isOwnedBy(instance, job) {
+		return nil
+	}
+
+	log.Info("Deleting Job : ", job.Name)
+	err = r.Client.Delete(context.TODO(), job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// setUpgradeStep moves the upgrade to the next step.
+func (r *OpenedxReconciler) setUpgradeStep(instance *cachev1.Openedx, step cachev1.UpgradeStep, message string) {
+	r.Log.Info(fmt.Sprintf("Upgrade to %s : %s", instance.Status.Upgrade.To, step))
+
+	reason := "Upgrading"
+	if step == cachev1.UpgradeCompleted {
+		reason = "Upgraded"
+	}
+	r.event(instance, corev1.EventTypeNormal, reason,
+		fmt.Sprintf("Upgrade to %s: %s", instance.Status.Upgrade.To, message))
+
+	instance.Status.Upgrade.Step = step
+	instance.Status.Upgrade.Message = message
+}
+
+// reconcileUpgrade moves the platform to the release of its spec, one release
+// at a time. An upgrade optionally backs the databases up, stops the
+// components using them, moves the in-cluster datastores to the images of the
+// new release, runs the migrations of the new release and starts the
+// components on it. The datastores, the migrations and the rollout themselves
+// are done by reconcileOpenedx, which deploys getOpenedxDatastoreRelease and
+// getOpenedxRelease; the upgrade is recorded in the status, which
+// updateStatus persists. The Jobs, StatefulSets and Deployments it waits for
+// are watched.
+func (r *OpenedxReconciler) reconcileUpgrade(req reconcile.Request, instance *cachev1.Openedx) (*reconcile.Result, error) {
+	target := getOpenedxVersion(instance)
+
+	if !isUpgrading(instance) {
+		installed := getOpenedxInstalledVersion(instance)
+		if target == installed {
+			return nil, nil
+		}
+		if r.isRestoring(instance) {
+			// Upgraded once the restore lets the platform go
+			return nil, nil
+		}
+
+		now := metav1.Now()
+		instance.Status.Upgrade = &cachev1.UpgradeStatus{
+			From:      installed,
+			To:        releases[releaseIndex(installed)+1].name,
+			StartTime: &now,
+		}
+		if instance.Spec.Upgrade != nil && instance.Spec.Upgrade.Backup {
+			r.setUpgradeStep(instance, cachev1.UpgradeBackingUp, "Backing up the databases")
+		} else {
+			r.setUpgradeStep(instance, cachev1.UpgradeScalingDown, "Stopping the platform")
+		}
+		return &reconcile.Result{Requeue: true}, nil
+	}
+
+	upgrade := instance.Status.Upgrade
+
+	// Nothing changed yet, going back to the previous release cancels the upgrade
+	if target == upgrade.From &&
+		(upgrade.Step == cachev1.UpgradeBackingUp || upgrade.Step == cachev1.UpgradeScalingDown) {
+		r.Log.Info("Upgrade to " + upgrade.To + " cancelled")
+		r.event(instance, corev1.EventTypeNormal, "UpgradeCancelled", "Upgrade to "+upgrade.To+" cancelled")
+		if err := r.deleteJob(instance, upgradeBackupJobName(instance, upgrade.To)); err != nil {
+			return &reconcile.Result{}, err
+		}
+		instance.Status.Upgrade = nil
+		return &reconcile.Result{Requeue: true}, nil
+	}
+
+	switch upgrade.Step {
+	case cachev1.UpgradeBackingUp:
+		job := r.upgradeBackupJob(instance, upgrade.To)
+		result, err := r.ensureJob(req, instance, job)
+		if result != nil {
+			return result, err
+		}
+
+		done, failed, err := r.jobState(job.Name, job.Namespace)
+		if err != nil {
+			return &reconcile.Result{}, err
+		}
+		if len(failed) > 0 {
+			r.event(instance, corev1.EventTypeWarning, "UpgradeBackupFailed", failed)
+			upgrade.Message = failed + ", delete it to retry or set the previous version to cancel the upgrade"
+			return &reconcile.Result{}, nil
+		}
+		if !done {
+			r.Log.Info("Upgrade backup Job isn't Complete, waiting for it")
+			return &reconcile.Result{}, nil
+		}
+		r.setUpgradeStep(instance, cachev1.UpgradeScalingDown, "Stopping the platform")
+		return &reconcile.Result{Requeue: true}, nil
+
+	case cachev1.UpgradeScalingDown:
+		running, err := runningDeployments(r.Client, instance)
+		if err != nil {
+			return &reconcile.Result{}, err
+		}
+		if len(running) > 0 {
+			r.Log.Info(fmt.Sprintf("Deployments %s are still running, waiting for them", strings.Join(running, ", ")))
+			return &reconcile.Result{}, nil
+		}
+		r.setUpgradeStep(instance, cachev1.UpgradeDatastores, "Upgrading the datastores to "+upgrade.To)
+		return &reconcile.Result{Requeue: true}, nil
+
+	case cachev1.UpgradeDatastores:
+		// reconcileOpenedx rolls the datastores to the images of the new release
+		upgrading, err := r.upgradingDatastores(instance)
+		if err != nil {
+			return &reconcile.Result{}, err
+		}
+		if len(upgrading) > 0 {
+			r.Log.Info(fmt.Sprintf("Datastores %s aren't upgraded, waiting for their StatefulSets", strings.Join(upgrading, ", ")))
+			return &reconcile.Result{}, nil
+		}
+
+		from, to := getRelease(upgrade.From), getRelease(upgrade.To)
+		if getOpenedxExternalMongoDB(instance) == nil && from.mongodbFeatureVersion != to.mongodbFeatureVersion {
+			job := r.mongodbUpgradeJob(instance, to)
+			result, err := r.ensureJob(req, instance, job)
+			if result != nil {
+				return result, err
+			}
+
+			done, failed, err := r.jobState(job.Name, job.Namespace)
+			if err != nil {
+				return &reconcile.Result{}, err
+			}
+			if len(failed) > 0 {
+				r.event(instance, corev1.EventTypeWarning, "UpgradeDatastoresFailed", failed)
+				upgrade.Message = failed + ", delete it to retry"
+				return &reconcile.Result{}, nil
+			}
+			if !done {
+				r.Log.Info("MongoDB upgrade Job isn't Complete, waiting for it")
+				return &reconcile.Result{}, nil
+			}
+		}
+		r.setUpgradeStep(instance, cachev1.UpgradeMigrating, "Running the migrations of "+upgrade.To)
+		return &reconcile.Result{Requeue: true}, nil
+
+	case cachev1.UpgradeMigrating:
+		// reconcileOpenedx only gets here once the migration Jobs are complete
+		r.setUpgradeStep(instance, cachev1.UpgradeRollingOut, "Starting the platform on "+upgrade.To)
+		return &reconcile.Result{Requeue: true}, nil
+
+	case cachev1.UpgradeRollingOut:
+		if !r.isLmsUp(instance) || !r.isCmsUp(instance) || !r.isforumUp(instance) {
+			r.Log.Info(fmt.Sprintf("Platform isn't up on %s, waiting for its Deployments", upgrade.To))
+			return &reconcile.Result{}, nil
+		}
+
+		if getOpenedxExternalSearch(instance) == nil &&
+			getSearchDataDir(instance, getRelease(upgrade.From)) != getSearchDataDir(instance, getRelease(upgrade.To)) {
+			job := r.reindexJob(instance, upgrade.To)
+			result, err := r.ensureJob(req, instance, job)
+			if result != nil {
+				return result, err
+			}
+
+			done, failed, err := r.jobState(job.Name, job.Namespace)
+			if err != nil {
+				return &reconcile.Result{}, err
+			}
+			if len(failed) > 0 {
+				r.event(instance, corev1.EventTypeWarning, "UpgradeReindexFailed", failed)
+				upgrade.Message = failed + ", delete it to retry"
+				return &reconcile.Result{}, nil
+			}
+			if !done {
+				r.Log.Info("Reindex Job isn't Complete, waiting for it")
+				return &reconcile.Result{}, nil
+			}
+		}
+
+		now := metav1.Now()
+		upgrade.CompletionTime = &now
+		instance.Status.Version = upgrade.To
+		r.setUpgradeStep(instance, cachev1.UpgradeCompleted, "Upgraded from "+upgrade.From)
+		if target != upgrade.To {
+			// On to the next release
+			return &reconcile.Result{Requeue: true}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,379 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// upgradingOpenedx returns an Openedx upgrading from one release to the next.
+func upgradingOpenedx(from, to string, step cachev1.UpgradeStep) *cachev1.Openedx {
+	return &cachev1.Openedx{
+		Spec: cachev1.OpenedxSpec{Version: to},
+		Status: cachev1.OpenedxStatus{
+			Phase:   cachev1.PhaseUpgrading,
+			Version: from,
+			Upgrade: &cachev1.UpgradeStatus{From: from, To: to, Step: step},
+		},
+	}
+}
+
+func TestGetOpenedxInstalledVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		cr   *cachev1.Openedx
+		want string
+	}{
+		{"new platform", &cachev1.Openedx{}, "koa"},
+		{"new platform on a release", &cachev1.Openedx{Spec: cachev1.OpenedxSpec{Version: "maple"}}, "maple"},
+		{"legacy platform", &cachev1.Openedx{
+			Spec:   cachev1.OpenedxSpec{Version: "maple"},
+			Status: cachev1.OpenedxStatus{Phase: cachev1.PhaseReady},
+		}, "koa"},
+		{"recorded release", &cachev1.Openedx{
+			Spec:   cachev1.OpenedxSpec{Version: "maple"},
+			Status: cachev1.OpenedxStatus{Phase: cachev1.PhaseReady, Version: "lilac"},
+		}, "lilac"},
+	}
+
+	for _, tt := range tests {
+		if got := getOpenedxInstalledVersion(tt.cr); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetOpenedxRelease(t *testing.T) {
+	tests := []struct {
+		step       cachev1.UpgradeStep
+		release    string
+		datastores string
+		holding    bool
+	}{
+		{cachev1.UpgradeBackingUp, "koa", "koa", false},
+		{cachev1.UpgradeScalingDown, "koa", "koa", true},
+		{cachev1.UpgradeDatastores, "koa", "lilac", true},
+		{cachev1.UpgradeMigrating, "lilac", "lilac", true},
+		{cachev1.UpgradeRollingOut, "lilac", "lilac", false},
+	}
+
+	for _, tt := range tests {
+		cr := upgradingOpenedx("koa", "lilac", tt.step)
+		if got := getOpenedxRelease(cr).name; got != tt.release {
+			t.Errorf("%s: deploys %s, want %s", tt.step, got, tt.release)
+		}
+		if got := getOpenedxDatastoreRelease(cr).name; got != tt.datastores {
+			t.Errorf("%s: deploys the datastores of %s, want %s", tt.step, got, tt.datastores)
+		}
+		if got := isUpgradeHolding(cr); got != tt.holding {
+			t.Errorf("%s: holding %v, want %v", tt.step, got, tt.holding)
+		}
+	}
+
+	// Once completed, the recorded release is deployed
+	cr := upgradingOpenedx("koa", "lilac", cachev1.UpgradeCompleted)
+	cr.Status.Version = "lilac"
+	if got := getOpenedxRelease(cr).name; got != "lilac" || isUpgradeHolding(cr) {
+		t.Errorf("completed: deploys %s, holding %v", got, isUpgradeHolding(cr))
+	}
+
+	legacy := &cachev1.Openedx{Status: cachev1.OpenedxStatus{Phase: cachev1.PhaseReady}}
+	if got := getOpenedxRelease(legacy).name; got != defaultRelease {
+		t.Errorf("legacy: deploys %s, want %s", got, defaultRelease)
+	}
+}
+
+func TestDatastoreImages(t *testing.T) {
+	r := upgradeReconciler(t, &cachev1.Openedx{})
+
+	tests := []struct {
+		release       string
+		mongodb       string
+		elasticsearch string
+		smallfiles    bool
+		searchDataDir string
+	}{
+		{"koa", "docker.io/mongo:3.6.18", "docker.io/elasticsearch:1.5.2", true, ""},
+		{"lilac", "docker.io/mongo:4.0.25", "docker.io/elasticsearch:7.10.1", true, "7"},
+		{"maple", "docker.io/mongo:4.2.17", "docker.io/elasticsearch:7.10.1", false, "7"},
+	}
+
+	for _, tt := range tests {
+		cr := &cachev1.Openedx{Spec: cachev1.OpenedxSpec{Version: tt.release}}
+
+		mongodb := r.mongodbStatefulSet(cr).Spec.Template.Spec.Containers[0]
+		if mongodb.Image != tt.mongodb {
+			t.Errorf("%s: MongoDB runs %s, want %s", tt.release, mongodb.Image, tt.mongodb)
+		}
+		if got := strings.Contains(strings.Join(mongodb.Args, " "), "--smallfiles"); got != tt.smallfiles {
+			t.Errorf("%s: MongoDB is started with --smallfiles %v, want %v", tt.release, got, tt.smallfiles)
+		}
+
+		pod := r.elasticsearchStatefulSet(cr).Spec.Template.Spec
+		search := pod.Containers[0]
+		if search.Image != tt.elasticsearch {
+			t.Errorf("%s: Elasticsearch runs %s, want %s", tt.release, search.Image, tt.elasticsearch)
+		}
+		if got := search.VolumeMounts[0].SubPath; got != tt.searchDataDir {
+			t.Errorf("%s: Elasticsearch keeps its indices in %q, want %q", tt.release, got, tt.searchDataDir)
+		}
+		if got := len(pod.InitContainers) > 0; got != (len(tt.searchDataDir) > 0) {
+			t.Errorf("%s: Elasticsearch has init containers %v", tt.release, pod.InitContainers)
+		}
+
+		if got := mysqlBackupContainer(cr).Image; got != getRelease(tt.release).mysqlImage {
+			t.Errorf("%s: MySQL is backed up with %s", tt.release, got)
+		}
+	}
+
+	// An image set by the spec keeps its indices
+	cr := &cachev1.Openedx{Spec: cachev1.OpenedxSpec{
+		Version: "maple",
+		Search: &cachev1.SearchSpec{InCluster: &cachev1.InClusterSearchSpec{
+			Image: "docker.io/opensearchproject/opensearch:1.2.4",
+		}},
+	}}
+	search := r.elasticsearchStatefulSet(cr).Spec.Template.Spec.Containers[0]
+	if search.Image != "docker.io/opensearchproject/opensearch:1.2.4" || len(search.VolumeMounts[0].SubPath) > 0 {
+		t.Errorf("image of the spec: runs %s with its indices in %q", search.Image, search.VolumeMounts[0].SubPath)
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	ready := func(spec, installed string) *cachev1.Openedx {
+		return &cachev1.Openedx{
+			Spec:   cachev1.OpenedxSpec{Version: spec},
+			Status: cachev1.OpenedxStatus{Phase: cachev1.PhaseReady, Version: installed},
+		}
+	}
+
+	tests := []struct {
+		name string
+		cr   *cachev1.Openedx
+		err  string
+	}{
+		{"same release", ready("lilac", "lilac"), ""},
+		{"upgrade", ready("maple", "koa"), ""},
+		{"unknown release", ready("juniper", "koa"), "Unsupported value"},
+		{"downgrade", ready("koa", "lilac"), "downgrades are not supported"},
+		{"legacy platform on the default release", ready("", ""), ""},
+		{"cancel before migrating", upgradingOpenedx("koa", "lilac", cachev1.UpgradeScalingDown), ""},
+		{"downgrade once migrated", func() *cachev1.Openedx {
+			cr := upgradingOpenedx("koa", "lilac", cachev1.UpgradeMigrating)
+			cr.Spec.Version = "koa"
+			return cr
+		}(), "downgrades are not supported"},
+		{"backup without backups", func() *cachev1.Openedx {
+			cr := ready("lilac", "koa")
+			cr.Spec.Upgrade = &cachev1.UpgradeSpec{Backup: true}
+			return cr
+		}(), "requires spec.backup"},
+	}
+
+	for _, tt := range tests {
+		errs := validateVersion(tt.cr)
+		if tt.err == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: unexpected errors %v", tt.name, errs)
+			}
+			continue
+		}
+		if len(errs) == 0 || !strings.Contains(errs.ToAggregate().Error(), tt.err) {
+			t.Errorf("%s: got %v, want an error about %q", tt.name, errs, tt.err)
+		}
+	}
+}
+
+// upgradeReconciler returns a reconciler of a fake cluster running the
+// Deployments of the platform.
+func upgradeReconciler(t *testing.T, cr *cachev1.Openedx) *OpenedxReconciler {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := cachev1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+
+	objs := []runtime.Object{}
+	for _, name := range getOpenedxDatabaseDeployments(cr) {
+		objs = append(objs, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cr.Namespace},
+			Status:     appsv1.DeploymentStatus{Replicas: 1, ReadyReplicas: 1},
+		})
+	}
+	return &OpenedxReconciler{Client: fake.NewFakeClientWithScheme(s, objs...), Log: ctrl.Log, Scheme: s}
+}
+
+// rollDatastores runs the desired StatefulSets of the datastores, as
+// reconcileOpenedx and the StatefulSet controller would.
+func rollDatastores(t *testing.T, r *OpenedxReconciler, cr *cachev1.Openedx) {
+	for _, ds := range r.getOpenedxDatastores(cr) {
+		sts := ds.statefulSet(cr)
+		sts.Status = appsv1.StatefulSetStatus{
+			Replicas:        *sts.Spec.Replicas,
+			ReadyReplicas:   *sts.Spec.Replicas,
+			UpdatedReplicas: *sts.Spec.Replicas,
+			CurrentRevision: sts.Name + "-" + getOpenedxDatastoreRelease(cr).name,
+			UpdateRevision:  sts.Name + "-" + getOpenedxDatastoreRelease(cr).name,
+		}
+
+		found := &appsv1.StatefulSet{}
+		err := r.Client.Get(context.TODO(), client.ObjectKey{Name: sts.Name, Namespace: sts.Namespace}, found)
+		if err == nil {
+			sts.ResourceVersion = found.ResourceVersion
+			err = r.Client.Update(context.TODO(), sts)
+		} else if errors.IsNotFound(err) {
+			err = r.Client.Create(context.TODO(), sts)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// completeJobs marks every Job of the platform succeeded.
+func completeJobs(t *testing.T, c client.Client, cr *cachev1.Openedx) {
+	jobs := &batchv1.JobList{}
+	if err := c.List(context.TODO(), jobs, client.InNamespace(cr.Namespace)); err != nil {
+		t.Fatal(err)
+	}
+	for i := range jobs.Items {
+		jobs.Items[i].Status.Succeeded = 1
+		if err := c.Update(context.TODO(), &jobs.Items[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// scaleDeployments sets the pods the Deployments of the platform run.
+func scaleDeployments(t *testing.T, c client.Client, cr *cachev1.Openedx, replicas int32) {
+	for _, name := range getOpenedxDatabaseDeployments(cr) {
+		deployment := &appsv1.Deployment{}
+		if err := c.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: cr.Namespace}, deployment); err != nil {
+			t.Fatal(err)
+		}
+		deployment.Status.Replicas = replicas
+		deployment.Status.ReadyReplicas = replicas
+		if err := c.Update(context.TODO(), deployment); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReconcileUpgrade(t *testing.T) {
+	cr := &cachev1.Openedx{
+		ObjectMeta: metav1.ObjectMeta{Name: "openedx", Namespace: "openedx"},
+		Spec:       cachev1.OpenedxSpec{Version: "maple"},
+		Status:     cachev1.OpenedxStatus{Phase: cachev1.PhaseReady, Version: "koa"},
+	}
+	r := upgradeReconciler(t, cr)
+	req := reconcile.Request{}
+
+	want := []string{
+		"lilac ScalingDown", "lilac UpgradingDatastores", "lilac Migrating", "lilac RollingOut", "lilac Completed",
+		"maple ScalingDown", "maple UpgradingDatastores", "maple Migrating", "maple RollingOut", "maple Completed",
+	}
+	steps := make([]string, 0)
+	for i := 0; i < 40 && len(steps) < len(want); i++ {
+		result, err := r.reconcileUpgrade(req, cr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		upgrade := cr.Status.Upgrade
+		if upgrade == nil {
+			t.Fatal("no upgrade in progress")
+		}
+		step := upgrade.To + " " + string(upgrade.Step)
+		if len(steps) == 0 || steps[len(steps)-1] != step {
+			steps = append(steps, step)
+			continue
+		}
+
+		// The step waits for the Deployments, StatefulSets or Jobs, which the
+		// watch reconciles on
+		if result == nil || result.Requeue {
+			t.Fatalf("%s: expected to wait, got %+v", step, result)
+		}
+		switch upgrade.Step {
+		case cachev1.UpgradeScalingDown:
+			scaleDeployments(t, r.Client, cr, 0)
+		case cachev1.UpgradeDatastores:
+			rollDatastores(t, r, cr)
+			completeJobs(t, r.Client, cr)
+		case cachev1.UpgradeRollingOut:
+			scaleDeployments(t, r.Client, cr, 1)
+			completeJobs(t, r.Client, cr)
+		}
+	}
+
+	if strings.Join(steps, ", ") != strings.Join(want, ", ") {
+		t.Errorf("upgrade went through\n%v\nwant\n%v", steps, want)
+	}
+	if cr.Status.Version != "maple" || cr.Status.Upgrade.From != "lilac" {
+		t.Errorf("upgraded to %s from %s, want maple from lilac", cr.Status.Version, cr.Status.Upgrade.From)
+	}
+	if result, err := r.reconcileUpgrade(req, cr); result != nil || err != nil {
+		t.Errorf("upgraded platform: got %+v, %v", result, err)
+	}
+
+	// MongoDB moved to the feature version of each release, and the courses
+	// were indexed again when Elasticsearch started on empty indices
+	jobs := &batchv1.JobList{}
+	if err := r.Client.List(context.TODO(), jobs, client.InNamespace(cr.Namespace)); err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(jobs.Items))
+	for _, job := range jobs.Items {
+		names = append(names, job.Name)
+	}
+	sort.Strings(names)
+	wantJobs := []string{"openedx-mongodb-upgrade-lilac", "openedx-mongodb-upgrade-maple", "openedx-reindex-lilac"}
+	if strings.Join(names, ", ") != strings.Join(wantJobs, ", ") {
+		t.Errorf("upgrade ran Jobs %v, want %v", names, wantJobs)
+	}
+}
+
+func TestCancelUpgrade(t *testing.T) {
+	cr := &cachev1.Openedx{
+		ObjectMeta: metav1.ObjectMeta{Name: "openedx", Namespace: "openedx"},
+		Spec:       cachev1.OpenedxSpec{Version: "lilac"},
+		Status:     cachev1.OpenedxStatus{Phase: cachev1.PhaseReady, Version: "koa"},
+	}
+	r := upgradeReconciler(t, cr)
+
+	if _, err := r.reconcileUpgrade(reconcile.Request{}, cr); err != nil {
+		t.Fatal(err)
+	}
+	if !isUpgrading(cr) || cr.Status.Upgrade.Step != cachev1.UpgradeScalingDown {
+		t.Fatalf("expected the upgrade to scale down, got %+v", cr.Status.Upgrade)
+	}
+
+	// Going back to the previous release while scaling down cancels the upgrade
+	cr.Spec.Version = "koa"
+	if errs := validateVersion(cr); len(errs) > 0 {
+		t.Fatalf("cancelling: unexpected errors %v", errs)
+	}
+	if _, err := r.reconcileUpgrade(reconcile.Request{}, cr); err != nil {
+		t.Fatal(err)
+	}
+	if cr.Status.Upgrade != nil || getOpenedxRelease(cr).name != "koa" {
+		t.Errorf("expected the upgrade to be cancelled, got %+v running %s", cr.Status.Upgrade, getOpenedxRelease(cr).name)
+	}
+	if result, err := r.reconcileUpgrade(reconcile.Request{}, cr); result != nil || err != nil {
+		t.Errorf("cancelled upgrade: got %+v, %v", result, err)
+	}
+}
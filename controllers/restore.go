@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"strings"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func restoreJobName(restore *cachev1.OpenedxRestore) string {
+	return restore.Name + "-restore"
+}
+
+func reindexCoursesJobName(restore *cachev1.OpenedxRestore) string {
+	return restore.Name + "-reindex-courses"
+}
+
+func reindexForumJobName(restore *cachev1.OpenedxRestore) string {
+	return restore.Name + "-reindex-forum"
+}
+
+// getOpenedxDatabaseDeployments will return the Deployments reading or
+// writing the databases, which are scaled down while a restore or an upgrade
+// changes their data.
+func getOpenedxDatabaseDeployments(cr *cachev1.Openedx) []string {
+	return []string{
+		lmsDeploymentName(cr),
+		cmsDeploymentName(cr),
+		lmsworkerDeploymentName(cr),
+		cmsworkerDeploymentName(cr),
+		forumDeploymentName(cr),
+	}
+}
+
+// isDatabaseDeployment reports whether the named Deployment reads or writes the databases.
+func isDatabaseDeployment(cr *cachev1.Openedx, deploymentName string) bool {
+	for _, name := range getOpenedxDatabaseDeployments(cr) {
+		if name == deploymentName {
+			return true
+		}
+	}
+	return false
+}
+
+// runningDeployments returns the Deployments reading or writing the
+// databases that still run pods.
+func runningDeployments(c client.Client, cr *cachev1.Openedx) ([]string, error) {
+	running := make([]string, 0)
+	for _, name := range getOpenedxDatabaseDeployments(cr) {
+		deployment := &appsv1.Deployment{}
+		err := c.Get(context.TODO(), types.NamespacedName{
+			Name:      name,
+			Namespace: getOpenedxNamespace(cr),
+		}, deployment)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if deployment.Status.Replicas > 0 {
+			running = append(running, name)
+		}
+	}
+	return running, nil
+}
+
+// restoreHoldsPlatform reports whether the restore keeps the platform scaled
+// down: from when it starts until the indexes are rebuilt, and for good when
+// loading the databases failed, since their data may then be incomplete.
+func restoreHoldsPlatform(restore *cachev1.OpenedxRestore) bool {
+	switch restore.Status.Phase {
+	case cachev1.RestoreScalingDown, cachev1.RestoreRestoringDatabases, cachev1.RestoreRebuildingIndexes:
+		return true
+	case cachev1.RestoreFailed:
+		return restore.Status.FailedPhase == cachev1.RestoreRestoringDatabases
+	}
+	return false
+}
+
+// getOpenedxRestore will return the restore holding the platform, or nil.
+func getOpenedxRestore(c client.Client, cr *cachev1.Openedx) (*cachev1.OpenedxRestore, error) {
+	restores := &cachev1.OpenedxRestoreList{}
+	if err := c.List(context.TODO(), restores, client.InNamespace(cr.Namespace)); err != nil {
+		return nil, err
+	}
+	for i := range restores.Items {
+		restore := &restores.Items[i]
+		if restore.Spec.OpenedxName == cr.Name && restore.DeletionTimestamp == nil && restoreHoldsPlatform(restore) {
+			return restore, nil
+		}
+	}
+	return nil, nil
+}
+
+// isRestoring reports whether a restore holds the platform. It errs on the
+// side of running the platform when the restores cannot be listed.
+func (r *OpenedxReconciler) isRestoring(cr *cachev1.Openedx) bool {
+	restore, err := getOpenedxRestore(r.Client, cr)
+	if err != nil {
+		r.Log.Error(err, "Failed to list OpenedxRestores")
+		return false
+	}
+	return restore != nil
+}
+
+// isScaledDown reports whether the Deployment exists and is scaled to zero.
+func (r *OpenedxReconciler) isScaledDown(dep *appsv1.Deployment) bool {
+	found := &appsv1.Deployment{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      dep.Name,
+		Namespace: dep.Namespace,
+	}, found)
+	if err != nil {
+		return false
+	}
+	return found.Spec.Replicas != nil && *found.Spec.Replicas == 0
+}
+
+// mysqlRestoreScript empties the database of the LMS and CMS, then loads the
+// archive. The tables are dropped one by one, which the database user is
+// allowed to do even when it may not drop the database.
+const mysqlRestoreScript = `set -eo pipefail
+archive="/backup/mysql/$MYSQL_DATABASE-$BACKUP.sql.gz"
+test -f "$archive" || { echo "$archive not found" >&2; exit 1; }
+mysql --host="$MYSQL_HOST" --port="$MYSQL_PORT" --user="$MYSQL_USER" --skip-column-names "$MYSQL_DATABASE" --execute="
+SELECT CONCAT('DROP TABLE IF EXISTS ', CHAR(96), table_name, CHAR(96), ';')
+FROM information_schema.tables
+WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE';
+" > /tmp/drop.sql
+{ echo "SET FOREIGN_KEY_CHECKS=0;"; cat /tmp/drop.sql; } \
+  | mysql --host="$MYSQL_HOST" --port="$MYSQL_PORT" --user="$MYSQL_USER" "$MYSQL_DATABASE"
+gunzip -c "$archive" | mysql --host="$MYSQL_HOST" --port="$MYSQL_PORT" --user="$MYSQL_USER" "$MYSQL_DATABASE"
+`
+
+// mongodbRestoreScript replaces the collections of the modulestore and the
+// forum databases with those of their archives.
+const mongodbRestoreScript = `set -e
+for db in $MONGODB_DATABASES; do
+  archive="/backup/mongodb/$db-$BACKUP.archive.gz"
+  test -f "$archive" || { echo "$archive not found" >&2; exit 1; }
+  mongorestore --uri="$MONGODB_URI" --gzip --archive="$archive" --drop --nsInclude="$db.*"
+done
+`
+
+// s3DownloadScript fetches the archives of the backup run from the bucket.
+const s3DownloadScript = `set -e
+mc --quiet alias set backup "$S3_ENDPOINT" "$S3_ACCESS_KEY_ID" "$S3_SECRET_ACCESS_KEY" > /dev/null
+mkdir -p /backup/mysql /backup/mongodb
+mc --quiet cp "backup/$S3_TARGET/mysql/$MYSQL_DATABASE-$BACKUP.sql.gz" /backup/mysql/
+for db in $MONGODB_DATABASES; do
+  mc --quiet cp "backup/$S3_TARGET/mongodb/$db-$BACKUP.archive.gz" /backup/mongodb/
+done
+`
+
+// restoreJob loads the MySQL and MongoDB archives of a backup run, read from
+// the backup volume of the Openedx or downloaded from its bucket first.
+func restoreJob(restore *cachev1.OpenedxRestore, instance *cachev1.Openedx) *batchv1.Job {
+	labels := labels(instance, "restore")
+	backoffLimit := int32(2)
+
+	env := append(backupEnv(instance), corev1.EnvVar{Name: "BACKUP", Value: restore.Spec.Backup})
+	mounts := []corev1.VolumeMount{{
+		Name:      "backup",
+		MountPath: backupMountPath,
+	}}
+
+	mysqlEnv := append(append([]corev1.EnvVar{}, env...),
+		corev1.EnvVar{Name: "MYSQL_HOST", Value: getOpenedxMySQLHost(instance)},
+		corev1.EnvVar{Name: "MYSQL_PORT", Value: strconv.Itoa(int(getOpenedxMySQLPort(instance)))},
+		secretEnvVar("MYSQL_USER", mysqlAuthName(instance), mysqlUsernameKey),
+		secretEnvVar("MYSQL_PWD", mysqlAuthName(instance), mysqlPasswordKey),
+	)
+
+	mongodbEnv := append([]corev1.EnvVar{}, env...)
+	if name := getOpenedxMongoDBAuthName(instance); len(name) > 0 {
+		mongodbEnv = append(mongodbEnv,
+			secretEnvVar("MONGODB_USERNAME", name, mongodbUsernameKey),
+			secretEnvVar("MONGODB_PASSWORD", name, mongodbPasswordKey),
+		)
+	}
+	mongodbEnv = append(mongodbEnv, corev1.EnvVar{Name: "MONGODB_URI", Value: getMongoDBURI(instance, "")})
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		Containers: []corev1.Container{{
+			Name:         "mysql",
+			Image:        getOpenedxMySQLImage(instance),
+			Command:      []string{"bash", "-c", mysqlRestoreScript},
+			Env:          mysqlEnv,
+			VolumeMounts: mounts,
+		}, {
+			Name:         "mongorestore",
+			Image:        getOpenedxMongoDBImage(instance),
+			Command:      []string{"bash", "-c", mongodbRestoreScript},
+			Env:          mongodbEnv,
+			VolumeMounts: mounts,
+		}},
+	}
+	if s3 := getOpenedxBackupS3(instance); s3 != nil {
+		podSpec.InitContainers = []corev1.Container{{
+			Name:    "download",
+			Image:   mcImage,
+			Command: []string{"sh", "-c", s3DownloadScript},
+			Env: append(append([]corev1.EnvVar{}, env...),
+				corev1.EnvVar{Name: "S3_ENDPOINT", Value: s3.Endpoint},
+				corev1.EnvVar{Name: "S3_TARGET", Value: path.Join(s3.Bucket, strings.Trim(s3.Prefix, "/"))},
+				secretEnvVar("S3_ACCESS_KEY_ID", s3.CredentialsSecret, s3AccessKeyIDKey),
+				secretEnvVar("S3_SECRET_ACCESS_KEY", s3.CredentialsSecret, s3SecretAccessKeyKey),
+			),
+			VolumeMounts: mounts,
+		}}
+		podSpec.Volumes = []corev1.Volume{{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		}}
+	} else {
+		podSpec.Volumes = []corev1.Volume{{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: getOpenedxVolumeClaimName(instance, "backup"),
+					ReadOnly:  true,
+				},
+			},
+		}}
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restoreJobName(restore),
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// reindexCoursesJob rebuilds the courseware search index from the restored modulestore.
+func reindexCoursesJob(restore *cachev1.OpenedxRestore, instance *cachev1.Openedx) *batchv1.Job {
+	labels := labels(instance, "reindex")
+
+	podSpec := newCmsPodSpec(instance)
+	podSpec.Containers[0].Name = "reindex-courses"
+	podSpec.Containers[0].Args = []string{"./manage.py", "cms", "reindex_course", "--all", "--setup"}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      reindexCoursesJobName(restore),
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// reindexForumJob rebuilds the forum search index from the restored forum database.
+func reindexForumJob(restore *cachev1.OpenedxRestore, instance *cachev1.Openedx) *batchv1.Job {
+	labels := labels(instance, "reindex")
+
+	podSpec := newPodSpec(instance)
+	podSpec.Containers[0].Name = "reindex-forum"
+	podSpec.Containers[0].Args = forumArgs("bundle exec rake search:rebuild_index")
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      reindexForumJobName(restore),
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// setRestoreOwner makes the restore own a Job it creates, so deleting the
+// restore deletes its Jobs. Owner references cannot cross namespaces, so a
+// Job in another namespace is only tracked by the Openedx.
+func setRestoreOwner(restore *cachev1.OpenedxRestore, job *batchv1.Job, scheme *runtime.Scheme) {
+	if job.Namespace == restore.Namespace {
+		controllerutil.SetControllerReference(restore, job, scheme)
+	}
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Keys of the platform Secret.
+const (
+	secretKeyKey     = "secret-key"
+	jwtPrivateJwkKey = "jwt-private-jwk"
+	jwtPublicJwksKey = "jwt-public-jwks"
+)
+
+// uriReservedChars may not appear in credentials written into a connection
+// URI, which Kubernetes expands from the environment without escaping them.
+const uriReservedChars = ":/?#[]@%"
+
+const passwordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func openedxAuthName(instance *cachev1.Openedx) string {
+	if instance.Spec.Secrets != nil && len(instance.Spec.Secrets.Platform) > 0 {
+		return instance.Spec.Secrets.Platform
+	}
+	return "openedx-auth"
+}
+
+// isUserSecret reports whether the named Secret is provided by the user
+// instead of generated by the operator.
+func isUserSecret(instance *cachev1.Openedx, name string) bool {
+	if db := getOpenedxExternalDatabase(instance); db != nil && name == db.CredentialsSecret {
+		return true
+	}
+	if mongoAuth := getOpenedxMongoDBAuthName(instance); len(mongoAuth) > 0 && name == mongoAuth {
+		return true
+	}
+	if broker := getOpenedxExternalBroker(instance); broker != nil && name == broker.URLSecret {
+		return true
+	}
+	for _, searchSecret := range getOpenedxSearchSecrets(instance) {
+		if name == searchSecret {
+			return true
+		}
+	}
+	if s3 := getOpenedxBackupS3(instance); s3 != nil && name == s3.CredentialsSecret {
+		return true
+	}
+	s := instance.Spec.Secrets
+	if s == nil {
+		return false
+	}
+	return name == s.MySQL || name == s.Platform || name == s.Forum || name == s.RabbitMQ
+}
+
+// validateURICredentials checks that the keys of a user provided Secret,
+// written into a connection URI, hold no character reserved in URIs. The
+// values themselves are left out of the error, which lands in the status.
+func (r *OpenedxReconciler) validateURICredentials(instance *cachev1.Openedx,
+	path *field.Path,
+	name string,
+	keys ...string,
+) error {
+	s := &corev1.Secret{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: getOpenedxNamespace(instance),
+	}, s)
+	if err != nil {
+		return err
+	}
+
+	allErrs := field.ErrorList{}
+	for _, key := range keys {
+		if strings.ContainsAny(string(s.Data[key]), uriReservedChars) {
+			allErrs = append(allErrs, field.Invalid(path, name,
+				fmt.Sprintf("key %s of the Secret contains one of the characters %s, which are reserved in URIs", key, uriReservedChars)))
+		}
+	}
+	if len(allErrs) > 0 {
+		return &specError{errs: allErrs}
+	}
+	return nil
+}
+
+// randomString returns a random alphanumeric string of length n.
+func randomString(n int) (string, error) {
+	max := big.NewInt(int64(len(passwordChars)))
+	b := make([]byte, n)
+	for i := range b {
+		c, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = passwordChars[c.Int64()]
+	}
+	return string(b), nil
+}
+
+func base64URLUint(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+// jwtSigningKeys generates the RSA key pair used to sign JWTs, returned as a
+// private JWK and a public JWK set in the format expected by edx-platform.
+func jwtSigningKeys() (string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+
+	e := base64URLUint(big.NewInt(int64(key.PublicKey.E)))
+	n := base64URLUint(key.PublicKey.N)
+
+	private, err := json.Marshal(map[string]string{
+		"kid": "openedx",
+		"kty": "RSA",
+		"e":   e,
+		"d":   base64URLUint(key.D),
+		"n":   n,
+		"p":   base64URLUint(key.Primes[0]),
+		"q":   base64URLUint(key.Primes[1]),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	public, err := json.Marshal(map[string][]map[string]string{
+		"keys": {{
+			"kid": "openedx",
+			"kty": "RSA",
+			"e":   e,
+			"n":   n,
+		}},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(private), string(public), nil
+}
+
+// newSecret returns a new Secret instance for the given OpenedX.
+func newSecret(name string, instance *cachev1.Openedx) *corev1.Secret {
+	labels := labels(instance, "secret")
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+}
+
+// openedxAuthSecret generates the Django secret key and JWT signing keys shared by the LMS and CMS.
+func (r *OpenedxReconciler) openedxAuthSecret(instance *cachev1.Openedx) (*corev1.Secret, error) {
+	private, public, err := jwtSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	secretKey, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := newSecret(openedxAuthName(instance), instance)
+	secret.StringData = map[string]string{
+		secretKeyKey:     secretKey,
+		jwtPrivateJwkKey: private,
+		jwtPublicJwksKey: public,
+	}
+
+	controllerutil.SetControllerReference(instance, secret, r.Scheme)
+	return secret, nil
+}
+
+func secretEnvVar(name, secretName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  key,
+			},
+		},
+	}
+}
+
+// getOpenedxSecretEnv returns the credentials read by the LMS and CMS settings.
+func getOpenedxSecretEnv(cr *cachev1.Openedx) []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		secretEnvVar("OPENEDX_SECRET_KEY", openedxAuthName(cr), secretKeyKey),
+		secretEnvVar("OPENEDX_JWT_PRIVATE_JWK", openedxAuthName(cr), jwtPrivateJwkKey),
+		secretEnvVar("OPENEDX_JWT_PUBLIC_JWKS", openedxAuthName(cr), jwtPublicJwksKey),
+		secretEnvVar("OPENEDX_MYSQL_USERNAME", mysqlAuthName(cr), mysqlUsernameKey),
+		secretEnvVar("OPENEDX_MYSQL_PASSWORD", mysqlAuthName(cr), mysqlPasswordKey),
+		secretEnvVar("OPENEDX_FORUM_API_KEY", forumAuthName(cr), forumAPIKeyKey),
+	}
+	if name := getOpenedxMongoDBAuthName(cr); len(name) > 0 {
+		env = append(env,
+			secretEnvVar("OPENEDX_MONGODB_USERNAME", name, mongodbUsernameKey),
+			secretEnvVar("OPENEDX_MONGODB_PASSWORD", name, mongodbPasswordKey),
+		)
+	}
+	env = append(env, getOpenedxBrokerEnv(cr)...)
+	return append(env, getOpenedxSearchEnv(cr)...)
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	"github.com/rocrisp/openedx-operator/render"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Keys read from the ConfigMap referenced by DjangoSettings.ConfigMapRef.
+const (
+	settingsEnvKey    = "env.json"
+	settingsPythonKey = "production.py"
+)
+
+// decodeJSON decodes a JSON document, keeping numbers as written.
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// decodeEnvOverrides converts the env overrides of the spec into JSON values.
+func decodeEnvOverrides(env map[string]apiextensionsv1.JSON) (map[string]interface{}, error) {
+	overrides := make(map[string]interface{}, len(env))
+	for key, value := range env {
+		var v interface{}
+		if err := decodeJSON(value.Raw, &v); err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		overrides[key] = v
+	}
+	return overrides, nil
+}
+
+// settingsLayers returns the user settings of a service in the order they are
+// applied, with the field path each one was set at.
+func settingsLayers(cr *cachev1.Openedx, service string) ([]*cachev1.DjangoSettings, []*field.Path) {
+	if cr.Spec.Settings == nil {
+		return nil, nil
+	}
+	path := field.NewPath("spec", "settings")
+
+	layers := []*cachev1.DjangoSettings{cr.Spec.Settings.Common}
+	paths := []*field.Path{path.Child("common")}
+	switch service {
+	case "lms":
+		layers = append(layers, cr.Spec.Settings.Lms)
+		paths = append(paths, path.Child("lms"))
+	case "cms":
+		layers = append(layers, cr.Spec.Settings.Cms)
+		paths = append(paths, path.Child("cms"))
+	}
+	return layers, paths
+}
+
+// validateSettings checks that the env overrides of the spec are valid and
+// leave the settings managed by the operator alone.
+func validateSettings(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if cr.Spec.Settings == nil {
+		return allErrs
+	}
+	path := field.NewPath("spec", "settings")
+
+	names := []string{"common", "lms", "cms"}
+	for i, settings := range []*cachev1.DjangoSettings{
+		cr.Spec.Settings.Common,
+		cr.Spec.Settings.Lms,
+		cr.Spec.Settings.Cms,
+	} {
+		if settings == nil || len(settings.Env) == 0 {
+			continue
+		}
+		envPath := path.Child(names[i], "env")
+		overrides, err := decodeEnvOverrides(settings.Env)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(envPath, "", err.Error()))
+			continue
+		}
+		if err := render.CheckEnvOverrides(overrides); err != nil {
+			allErrs = append(allErrs, field.Forbidden(envPath, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// isUserConfigMap reports whether the named ConfigMap holds user settings of
+// the platform.
+func isUserConfigMap(instance *cachev1.Openedx, name string) bool {
+	s := instance.Spec.Settings
+	if s == nil {
+		return false
+	}
+	for _, settings := range []*cachev1.DjangoSettings{s.Common, s.Lms, s.Cms} {
+		if settings != nil && settings.ConfigMapRef != nil && settings.ConfigMapRef.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// djangoCustomization gathers the user settings of the LMS or CMS from the
+// spec and the ConfigMaps it references.
+func (r *OpenedxReconciler) djangoCustomization(cr *cachev1.Openedx, service string) (render.Customization, error) {
+	custom := render.Customization{}
+	layers, paths := settingsLayers(cr, service)
+
+	for i, settings := range layers {
+		if settings == nil {
+			continue
+		}
+
+		if settings.ConfigMapRef != nil {
+			refPath := paths[i].Child("configMapRef")
+			cm := &corev1.ConfigMap{}
+			err := r.Client.Get(context.TODO(), types.NamespacedName{
+				Name:      settings.ConfigMapRef.Name,
+				Namespace: getOpenedxNamespace(cr),
+			}, cm)
+			if err != nil {
+				return custom, fmt.Errorf("reading settings ConfigMap %s: %v", settings.ConfigMapRef.Name, err)
+			}
+
+			if data, ok := cm.Data[settingsEnvKey]; ok {
+				overrides := map[string]interface{}{}
+				if err := decodeJSON([]byte(data), &overrides); err != nil {
+					return custom, &specError{errs: field.ErrorList{
+						field.Invalid(refPath, settings.ConfigMapRef.Name, settingsEnvKey+": "+err.Error()),
+					}}
+				}
+				if err := render.CheckEnvOverrides(overrides); err != nil {
+					return custom, &specError{errs: field.ErrorList{
+						field.Forbidden(refPath, settingsEnvKey+": "+err.Error()),
+					}}
+				}
+				custom.Env = append(custom.Env, overrides)
+			}
+			if data, ok := cm.Data[settingsPythonKey]; ok {
+				custom.Python = append(custom.Python, data)
+			}
+		}
+
+		if len(settings.Env) > 0 {
+			overrides, err := decodeEnvOverrides(settings.Env)
+			if err != nil {
+				return custom, err
+			}
+			custom.Env = append(custom.Env, overrides)
+		}
+		if len(settings.Python) > 0 {
+			custom.Python = append(custom.Python, settings.Python)
+		}
+	}
+	return custom, nil
+}
@@ -27,7 +27,7 @@ func (r *OpenedxReconciler) smtpDeployment(instance *cachev1.Openedx) *appsv1.De
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      smtpDeploymentName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
@@ -63,7 +63,7 @@ func (r *OpenedxReconciler) smtpService(instance *cachev1.Openedx) *corev1.Servi
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      smtpServiceName(instance),
-			Namespace: instance.Namespace,
+			Namespace: getOpenedxNamespace(instance),
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
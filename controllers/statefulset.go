@@ -0,0 +1,407 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/prometheus/common/log"
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// datastoreClaimName is the name of the volume claim template of every
+// datastore, and of the volume its pod mounts.
+const datastoreClaimName = "data"
+
+// reclaimPolicyAnnotation records the reclaim policy of a volume while it is
+// moved from a legacy claim to the claim of a StatefulSet, during which it is
+// retained.
+const reclaimPolicyAnnotation = "cache.operatortrain.me/reclaim-policy"
+
+// datastore is a stateful backend run as a single pod StatefulSet.
+type datastore struct {
+	// name is the app label of the datastore, and the name of the standalone
+	// claim it used when it ran as a Deployment.
+	name        string
+	serviceName string
+	port        int32
+	statefulSet func(*cachev1.Openedx) *appsv1.StatefulSet
+	isUp        func(*cachev1.Openedx) bool
+}
+
+// getOpenedxDatastores will return the datastores deployed in the cluster,
+// leaving out those replaced by external services.
+func (r *OpenedxReconciler) getOpenedxDatastores(cr *cachev1.Openedx) []datastore {
+	datastores := []datastore{
+		{"redis", redisServiceName(cr), redisPort, r.redisStatefulSet, r.isRedisdUp},
+	}
+	if getOpenedxExternalDatabase(cr) == nil {
+		datastores = append(datastores, datastore{"mysql", mysqlServiceName(cr), sqlPort, r.mysqlStatefulSet, r.isMysqlUp})
+	}
+	if getOpenedxExternalMongoDB(cr) == nil {
+		datastores = append(datastores, datastore{"mongodb", mongodbServiceName(cr), mongodbPort, r.mongodbStatefulSet, r.isMongodbUp})
+	}
+	if getOpenedxExternalSearch(cr) == nil {
+		datastores = append(datastores, datastore{"elasticsearch", elasticsearchServiceName(cr), elasticsearchPort, r.elasticsearchStatefulSet, r.iselasticsearchUp})
+	}
+	if getOpenedxBrokerType(cr) == cachev1.BrokerRabbitMQ {
+		datastores = append(datastores, datastore{"rabbitmq", rabbitmqServiceName(cr), rabbitmqPort, r.rabbitmqStatefulSet, r.israbbitmqUp})
+	}
+	return datastores
+}
+
+// datastoreHeadlessServiceName returns the headless Service governing the
+// StatefulSet of a datastore. Clients keep using the regular Service.
+func datastoreHeadlessServiceName(serviceName string) string {
+	return serviceName + "-headless"
+}
+
+// statefulSetClaimName returns the name of the claim created from the volume
+// claim template for the single pod of a datastore.
+func statefulSetClaimName(sts *appsv1.StatefulSet) string {
+	return datastoreClaimName + "-" + sts.Name + "-0"
+}
+
+// datastoreStatefulSet returns a StatefulSet running the single pod of a
+// datastore, whose data volume is created from a volume claim template set
+// by spec.storage, or is the existing claim it names.
+func datastoreStatefulSet(instance *cachev1.Openedx,
+	name, serviceName string,
+	replicas int32,
+	volumeName string,
+	template corev1.PodTemplateSpec,
+) *appsv1.StatefulSet {
+	labels := template.ObjectMeta.Labels
+
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:            &replicas,
+			ServiceName:         datastoreHeadlessServiceName(serviceName),
+			PodManagementPolicy: appsv1.OrderedReadyPodManagement,
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			},
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: template,
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   datastoreClaimName,
+					Labels: labels,
+				},
+				Spec: volumeClaimSpec(instance, volumeName),
+			}},
+		},
+	}
+
+	if claim := getOpenedxVolume(instance, volumeName).ExistingClaim; len(claim) > 0 {
+		statefulSet.Spec.VolumeClaimTemplates = nil
+		statefulSet.Spec.Template.Spec.Volumes = append(statefulSet.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: datastoreClaimName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: claim,
+				},
+			},
+		})
+	}
+	return statefulSet
+}
+
+// datastoreHeadlessService returns the headless Service governing the
+// StatefulSet of a datastore, which gives its pod a stable DNS name.
+func (r *OpenedxReconciler) datastoreHeadlessService(instance *cachev1.Openedx,
+	app, serviceName string,
+	port int32,
+) *corev1.Service {
+	labels := labels(instance, app)
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      datastoreHeadlessServiceName(serviceName),
+			Namespace: getOpenedxNamespace(instance),
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector:                 labels,
+			ClusterIP:                corev1.ClusterIPNone,
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{{
+				Name:     app,
+				Protocol: corev1.ProtocolTCP,
+				Port:     port,
+			}},
+		},
+	}
+
+	controllerutil.SetControllerReference(instance, service, r.Scheme)
+	return service
+}
+
+// adoptLegacyClaim moves the data of a datastore that ran as a Deployment on a
+// standalone claim, named after the datastore, onto the claim of its
+// StatefulSet. The legacy Deployment is deleted, the volume is retained while
+// the legacy claim is deleted, then bound to a claim pre-created under the
+// name the StatefulSet expects, and its reclaim policy is restored. It reports
+// whether the StatefulSet can be reconciled; every step is resumed from the
+// state of the cluster, so the move survives restarts of the operator.
+func (r *OpenedxReconciler) adoptLegacyClaim(instance *cachev1.Openedx,
+	sts *appsv1.StatefulSet,
+	legacyClaim string,
+) (bool, error) {
+	if len(sts.Spec.VolumeClaimTemplates) == 0 {
+		// The datastore runs on an existing claim, only the Deployment has to go
+		return r.stopLegacyDeployment(instance, sts)
+	}
+
+	ns := sts.Namespace
+
+	legacy := &corev1.PersistentVolumeClaim{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: legacyClaim, Namespace: ns}, legacy)
+	if errors.IsNotFound(err) {
+		legacy = nil
+	} else if err != nil {
+		return false, err
+	} else if !isOwnedBy(instance, legacy) {
+		legacy = nil
+	}
+
+	claim := &corev1.PersistentVolumeClaim{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: statefulSetClaimName(sts), Namespace: ns}, claim)
+	if errors.IsNotFound(err) {
+		claim = nil
+	} else if err != nil {
+		return false, err
+	}
+
+	switch {
+	case claim == nil && legacy == nil:
+		// Nothing to move, the StatefulSet creates its claim
+		return true, nil
+
+	case claim == nil:
+		stopped, err := r.deleteLegacyDeployment(instance, sts)
+		if err != nil || !stopped {
+			return false, err
+		}
+		if len(legacy.Spec.VolumeName) == 0 {
+			// Never bound, so there is no data to keep
+			return false, r.deleteLegacyClaim(legacy)
+		}
+		if err := r.retainVolume(legacy.Spec.VolumeName); err != nil {
+			return false, err
+		}
+		return false, r.createAdoptingClaim(instance, sts, legacy)
+
+	case legacy != nil:
+		if claim.Spec.VolumeName != legacy.Spec.VolumeName {
+			// The StatefulSet already has its own data, leave the legacy claim alone
+			return true, nil
+		}
+		return false, r.deleteLegacyClaim(legacy)
+
+	case claim.Status.Phase != corev1.ClaimBound && len(claim.Spec.VolumeName) > 0:
+		return false, r.bindVolume(claim)
+
+	case claim.Status.Phase == corev1.ClaimBound:
+		return true, r.restoreReclaimPolicy(claim.Spec.VolumeName)
+	}
+	return true, nil
+}
+
+// stopLegacyDeployment deletes the Deployment a datastore ran as before its
+// StatefulSet is created, and reports whether the StatefulSet can be reconciled.
+func (r *OpenedxReconciler) stopLegacyDeployment(instance *cachev1.Openedx, sts *appsv1.StatefulSet) (bool, error) {
+	found := &appsv1.StatefulSet{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, found)
+	if err == nil {
+		return true, nil
+	} else if !errors.IsNotFound(err) {
+		return false, err
+	}
+	return r.deleteLegacyDeployment(instance, sts)
+}
+
+// replaceClaimTemplates deletes the StatefulSet of a datastore, leaving its
+// pod running, when it moves between a volume claim template and an existing
+// claim. The volume claim templates of a StatefulSet are immutable, so it is
+// created again from sts and adopts the pod. It reports whether the
+// StatefulSet can be reconciled.
+func (r *OpenedxReconciler) replaceClaimTemplates(instance *cachev1.Openedx, sts *appsv1.StatefulSet) (bool, error) {
+	found := &appsv1.StatefulSet{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, found)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if len(found.Spec.VolumeClaimTemplates) == len(sts.Spec.VolumeClaimTemplates) || !isOwnedBy(instance, found) {
+		return true, nil
+	}
+	if found.DeletionTimestamp != nil {
+		return false, nil
+	}
+
+	log.Info("Replacing the volume claim templates of StatefulSet")
+	log.Info("StatefulSet Namespace : ", found.Namespace)
+	log.Info("StatefulSet Name : ", found.Name)
+
+	err = r.Client.Delete(context.TODO(), found, client.PropagationPolicy(metav1.DeletePropagationOrphan))
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	return false, nil
+}
+
+// deleteLegacyDeployment deletes the Deployment a datastore ran as, and
+// reports whether its pods are gone and no longer hold the volume.
+func (r *OpenedxReconciler) deleteLegacyDeployment(instance *cachev1.Openedx, sts *appsv1.StatefulSet) (bool, error) {
+	found := &appsv1.Deployment{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	if err == nil && isOwnedBy(instance, found) {
+		log.Info("Deleting legacy Deployment")
+		log.Info("Deployment Namespace : ", found.Namespace)
+		log.Info("Deployment Name : ", found.Name)
+
+		err = r.Client.Delete(context.TODO(), found, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+	}
+
+	// The StatefulSet does not exist yet, so these are the pods of the Deployment
+	pods := &corev1.PodList{}
+	err = r.Client.List(context.TODO(), pods,
+		client.InNamespace(sts.Namespace),
+		client.MatchingLabels(sts.Spec.Selector.MatchLabels))
+	if err != nil {
+		return false, err
+	}
+	return len(pods.Items) == 0, nil
+}
+
+func (r *OpenedxReconciler) deleteLegacyClaim(legacy *corev1.PersistentVolumeClaim) error {
+	if legacy.DeletionTimestamp != nil {
+		return nil
+	}
+
+	log.Info("Deleting legacy pvc")
+	log.Info("pvc Namespace : ", legacy.Namespace)
+	log.Info("pvc Name : ", legacy.Name)
+
+	err := r.Client.Delete(context.TODO(), legacy)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// retainVolume keeps the volume when its claim is deleted, recording the
+// reclaim policy to restore once it is bound again.
+func (r *OpenedxReconciler) retainVolume(name string) error {
+	pv := &corev1.PersistentVolume{}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name}, pv); err != nil {
+		return err
+	}
+	if pv.Spec.PersistentVolumeReclaimPolicy == corev1.PersistentVolumeReclaimRetain {
+		return nil
+	}
+
+	if pv.Annotations == nil {
+		pv.Annotations = make(map[string]string)
+	}
+	pv.Annotations[reclaimPolicyAnnotation] = string(pv.Spec.PersistentVolumeReclaimPolicy)
+	pv.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+
+	log.Info("Retaining PersistentVolume : ", pv.Name)
+	return r.Client.Update(context.TODO(), pv)
+}
+
+// createAdoptingClaim creates the claim of the StatefulSet, bound in advance
+// to the volume of the legacy claim. It stays pending until the volume is
+// released by the legacy claim.
+func (r *OpenedxReconciler) createAdoptingClaim(instance *cachev1.Openedx,
+	sts *appsv1.StatefulSet,
+	legacy *corev1.PersistentVolumeClaim,
+) error {
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      statefulSetClaimName(sts),
+			Namespace: sts.Namespace,
+			Labels:    sts.Spec.VolumeClaimTemplates[0].Labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      legacy.Spec.AccessModes,
+			Resources:        legacy.Spec.Resources,
+			StorageClassName: legacy.Spec.StorageClassName,
+			VolumeMode:       legacy.Spec.VolumeMode,
+			VolumeName:       legacy.Spec.VolumeName,
+		},
+	}
+
+	log.Info("Creating a new pvc")
+	log.Info("pvc Namespace : ", claim.Namespace)
+	log.Info("pvc Name : ", claim.Name)
+	trackOwner(instance, claim)
+
+	err := r.Client.Create(context.TODO(), claim)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// bindVolume points a volume released by its legacy claim at the claim that
+// adopts it, so the binder matches them.
+func (r *OpenedxReconciler) bindVolume(claim *corev1.PersistentVolumeClaim) error {
+	pv := &corev1.PersistentVolume{}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Name: claim.Spec.VolumeName}, pv); err != nil {
+		return err
+	}
+	if pv.Spec.ClaimRef != nil && pv.Spec.ClaimRef.UID == claim.UID {
+		return nil
+	}
+
+	pv.Spec.ClaimRef = &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "PersistentVolumeClaim",
+		Namespace:  claim.Namespace,
+		Name:       claim.Name,
+		UID:        claim.UID,
+	}
+
+	log.Info("Binding PersistentVolume : ", pv.Name, " to pvc : ", claim.Name)
+	return r.Client.Update(context.TODO(), pv)
+}
+
+// restoreReclaimPolicy puts back the reclaim policy recorded by retainVolume.
+func (r *OpenedxReconciler) restoreReclaimPolicy(name string) error {
+	pv := &corev1.PersistentVolume{}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name}, pv); err != nil {
+		return err
+	}
+	policy, ok := pv.Annotations[reclaimPolicyAnnotation]
+	if !ok {
+		return nil
+	}
+
+	pv.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimPolicy(policy)
+	delete(pv.Annotations, reclaimPolicyAnnotation)
+
+	log.Info("Restoring the reclaim policy of PersistentVolume : ", pv.Name)
+	return r.Client.Update(context.TODO(), pv)
+}
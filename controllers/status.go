@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Components whose readiness is reported in the status, grouped by role.
+var (
+	datastoreComponents = []string{"mysql", "mongodb", "redis", "elasticsearch", "rabbitmq"}
+	webComponents       = []string{"lms", "cms", "forum", "nginx", "caddy"}
+)
+
+// componentStatus returns the readiness of every component of the platform.
+func (r *OpenedxReconciler) componentStatus(instance *cachev1.Openedx) map[string]cachev1.ComponentState {
+	checks := map[string]func(*cachev1.Openedx) bool{
+		"mysql":         r.isMysqlUp,
+		"mongodb":       r.isMongodbUp,
+		"redis":         r.isRedisdUp,
+		"elasticsearch": r.iselasticsearchUp,
+		"lms":           r.isLmsUp,
+		"cms":           r.isCmsUp,
+		"forum":         r.isforumUp,
+		"nginx":         r.isNginxUp,
+		"caddy":         r.isCaddyUp,
+	}
+	// RabbitMQ is only deployed when it is the Celery broker.
+	if getOpenedxBrokerType(instance) == cachev1.BrokerRabbitMQ {
+		checks["rabbitmq"] = r.israbbitmqUp
+	}
+
+	components := make(map[string]cachev1.ComponentState, len(checks))
+	for name, isUp := range checks {
+		if isUp(instance) {
+			components[name] = cachev1.ComponentReady
+		} else {
+			components[name] = cachev1.ComponentNotReady
+		}
+	}
+	return components
+}
+
+// notReady returns the sorted names of the given components that are not ready.
+func notReady(components map[string]cachev1.ComponentState, names ...string) []string {
+	down := make([]string, 0)
+	for _, name := range names {
+		if state, ok := components[name]; ok && state != cachev1.ComponentReady {
+			down = append(down, name)
+		}
+	}
+	sort.Strings(down)
+	return down
+}
+
+// findCondition returns the condition of the given type, or nil.
+func findCondition(conditions []cachev1.OpenedxCondition, condType string) *cachev1.OpenedxCondition {
+	for i := range conditions {
+		if conditions[i].Type == condType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// setCondition adds or updates a condition, moving its transition time only when the status changes.
+func setCondition(status *cachev1.OpenedxStatus, generation int64, condType string,
+	condStatus corev1.ConditionStatus, reason, message string) {
+
+	cond := findCondition(status.Conditions, condType)
+	if cond == nil {
+		status.Conditions = append(status.Conditions, cachev1.OpenedxCondition{Type: condType})
+		cond = &status.Conditions[len(status.Conditions)-1]
+	}
+
+	if cond.Status != condStatus {
+		cond.LastTransitionTime = metav1.Now()
+	}
+	cond.Status = condStatus
+	cond.ObservedGeneration = generation
+	cond.Reason = reason
+	cond.Message = message
+}
+
+// setBoolCondition sets a condition from a boolean, picking the matching reason.
+func setBoolCondition(status *cachev1.OpenedxStatus, generation int64, condType string,
+	value bool, trueReason, falseReason, message string) {
+
+	if value {
+		setCondition(status, generation, condType, corev1.ConditionTrue, trueReason, message)
+	} else {
+		setCondition(status, generation, condType, corev1.ConditionFalse, falseReason, message)
+	}
+}
+
+// computePhase derives the lifecycle phase from what was observed in the cluster.
+func computePhase(previous cachev1.OpenedxPhase, available, databasesReady, migrationsDone bool, reconcileErr error) cachev1.OpenedxPhase {
+	wasReady := previous == cachev1.PhaseReady || previous == cachev1.PhaseDegraded
+
+	switch {
+	case available && reconcileErr == nil:
+		return cachev1.PhaseReady
+	case available || wasReady:
+		return cachev1.PhaseDegraded
+	case databasesReady && !migrationsDone:
+		return cachev1.PhaseMigrating
+	default:
+		return cachev1.PhaseProvisioning
+	}
+}
+
+// updateStatus records the observed state of the platform in the Openedx status.
+func (r *OpenedxReconciler) updateStatus(instance *cachev1.Openedx, reconcileErr error) error {
+	status := instance.Status.DeepCopy()
+	generation := instance.Generation
+
+	status.ObservedGeneration = generation
+	status.Components = r.componentStatus(instance)
+	status.LmsReplicas, status.LmsSelector = r.lmsReplicas(instance)
+	status.Volumes = r.volumeStatus(instance)
+	status.Backup = r.backupStatus(instance)
+	status.Version = getOpenedxInstalledVersion(instance)
+	status.Maintenance = maintenanceStatus(instance.Status.Maintenance, r.maintenanceReason(instance))
+
+	databasesDown := notReady(status.Components, datastoreComponents...)
+	allDown := notReady(status.Components, append(datastoreComponents, webComponents...)...)
+	databasesReady := len(databasesDown) == 0
+	migrationsDone := r.isMigrated(instance)
+	demoDone := r.isDemoJobDone(instance)
+	available := len(allDown) == 0 && migrationsDone
+
+	status.Phase = computePhase(instance.Status.Phase, available, databasesReady, migrationsDone, reconcileErr)
+	if isUpgrading(instance) {
+		status.Phase = cachev1.PhaseUpgrading
+	}
+	if r.isRestoring(instance) {
+		status.Phase = cachev1.PhaseRestoring
+	}
+
+	databasesMessage := ""
+	if !databasesReady {
+		databasesMessage = "Not ready: " + strings.Join(databasesDown, ", ")
+	}
+	setBoolCondition(status, generation, cachev1.ConditionDatabasesReady, databasesReady,
+		"DatabasesReady", "DatabasesNotReady", databasesMessage)
+
+	if failure := migrationFailure(instance); len(failure) > 0 {
+		setCondition(status, generation, cachev1.ConditionMigrationsComplete, corev1.ConditionFalse,
+			"MigrationFailed", failure)
+	} else {
+		setBoolCondition(status, generation, cachev1.ConditionMigrationsComplete, migrationsDone,
+			"MigrationsComplete", "MigrationsPending", "")
+	}
+
+	setBoolCondition(status, generation, cachev1.ConditionDemoCourseImported, demoDone,
+		"DemoCourseImported", "DemoCourseImportPending", "")
+
+	resizing := resizingVolumes(status.Volumes)
+	setBoolCondition(status, generation, cachev1.ConditionVolumesResized, len(resizing) == 0,
+		"VolumesResized", "VolumesResizePending", strings.Join(resizing, ", "))
+
+	availableMessage := ""
+	if len(allDown) > 0 {
+		availableMessage = "Not ready: " + strings.Join(allDown, ", ")
+	} else if !migrationsDone {
+		availableMessage = "Waiting for migrations to complete"
+	}
+	setBoolCondition(status, generation, cachev1.ConditionAvailable, available,
+		"AllComponentsReady", "ComponentsNotReady", availableMessage)
+
+	progressing := status.Phase == cachev1.PhaseProvisioning ||
+		status.Phase == cachev1.PhaseMigrating ||
+		status.Phase == cachev1.PhaseUpgrading ||
+		status.Phase == cachev1.PhaseRestoring
+	setBoolCondition(status, generation, cachev1.ConditionProgressing, progressing,
+		string(status.Phase), "ReconcileComplete", "")
+
+	switch {
+	case isSpecError(reconcileErr):
+		setCondition(status, generation, cachev1.ConditionDegraded, corev1.ConditionTrue, "InvalidSpec", reconcileErr.Error())
+	case reconcileErr != nil:
+		setCondition(status, generation, cachev1.ConditionDegraded, corev1.ConditionTrue, "ReconcileError", reconcileErr.Error())
+	case status.Phase == cachev1.PhaseDegraded:
+		setCondition(status, generation, cachev1.ConditionDegraded, corev1.ConditionTrue, "ComponentsNotReady", availableMessage)
+	default:
+		setCondition(status, generation, cachev1.ConditionDegraded, corev1.ConditionFalse, "AsExpected", "")
+	}
+
+	if equality.Semantic.DeepEqual(&instance.Status, status) {
+		return nil
+	}
+	r.recordTransitions(instance, &instance.Status, status)
+
+	instance.Status = *status
+	return r.Client.Status().Update(context.TODO(), instance)
+}
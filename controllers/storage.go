@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/common/log"
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// volume is a persistent volume claim of the platform, named in spec.storage.
+type volume struct {
+	name      string
+	claimName string
+	// existing is set when the claim is provided by the user and never
+	// modified by the operator.
+	existing bool
+}
+
+// getOpenedxVolume will return the storage settings of the named volume.
+func getOpenedxVolume(cr *cachev1.Openedx, name string) *cachev1.VolumeSpec {
+	var spec *cachev1.VolumeSpec
+	if storage := cr.Spec.Storage; storage != nil {
+		switch name {
+		case "mysql":
+			spec = storage.MySQL
+		case "mongodb":
+			spec = storage.MongoDB
+		case "elasticsearch":
+			spec = storage.Elasticsearch
+		case "redis":
+			spec = storage.Redis
+		case "rabbitmq":
+			spec = storage.RabbitMQ
+		case "caddy":
+			spec = storage.Caddy
+		case "demo":
+			spec = storage.Demo
+		}
+	}
+	if backup := getOpenedxBackup(cr); name == "backup" && backup != nil {
+		spec = backup.Volume
+	}
+	if spec == nil {
+		return &cachev1.VolumeSpec{}
+	}
+	return spec
+}
+
+// getOpenedxVolumeSize will return the size requested for the named volume.
+func getOpenedxVolumeSize(cr *cachev1.Openedx, name string) resource.Quantity {
+	if size := getOpenedxVolume(cr, name).Size; size != nil {
+		return *size
+	}
+	switch name {
+	case "mysql", "mongodb":
+		return resource.MustParse("5Gi")
+	case "elasticsearch":
+		return resource.MustParse(getOpenedxSearchStorage(cr))
+	case "backup":
+		return resource.MustParse("10Gi")
+	default:
+		return resource.MustParse("1Gi")
+	}
+}
+
+// getOpenedxVolumeClaimName will return the claim a Deployment mounts for the
+// named volume.
+func getOpenedxVolumeClaimName(cr *cachev1.Openedx, name string) string {
+	if claim := getOpenedxVolume(cr, name).ExistingClaim; len(claim) > 0 {
+		return claim
+	}
+	return name
+}
+
+// volumeClaimSpec returns the spec of the claim the operator creates for the
+// named volume.
+func volumeClaimSpec(cr *cachev1.Openedx, name string) corev1.PersistentVolumeClaimSpec {
+	spec := getOpenedxVolume(cr, name)
+
+	accessModes := spec.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+
+	return corev1.PersistentVolumeClaimSpec{
+		AccessModes:      accessModes,
+		StorageClassName: spec.StorageClassName,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceStorage: getOpenedxVolumeSize(cr, name),
+			},
+		},
+	}
+}
+
+// getOpenedxStandaloneVolumes will return the volumes whose claim is not
+// created by a StatefulSet.
+func getOpenedxStandaloneVolumes(cr *cachev1.Openedx) []string {
+	volumes := []string{"caddy", "demo"}
+	if isBackupVolume(cr) {
+		volumes = append(volumes, "backup")
+	}
+	return volumes
+}
+
+// getOpenedxVolumes will return the persistent volume claims of the platform.
+func (r *OpenedxReconciler) getOpenedxVolumes(cr *cachev1.Openedx) []volume {
+	volumes := make([]volume, 0)
+	for _, ds := range r.getOpenedxDatastores(cr) {
+		if claim := getOpenedxVolume(cr, ds.name).ExistingClaim; len(claim) > 0 {
+			volumes = append(volumes, volume{ds.name, claim, true})
+		} else {
+			volumes = append(volumes, volume{ds.name, statefulSetClaimName(ds.statefulSet(cr)), false})
+		}
+	}
+	for _, name := range getOpenedxStandaloneVolumes(cr) {
+		existing := len(getOpenedxVolume(cr, name).ExistingClaim) > 0
+		volumes = append(volumes, volume{name, getOpenedxVolumeClaimName(cr, name), existing})
+	}
+	return volumes
+}
+
+// reconcileVolume brings a claim created by the operator in line with the
+// spec: its ownership follows retainOnDelete, and its storage request is
+// raised when the size grows and its StorageClass allows volume expansion.
+func (r *OpenedxReconciler) reconcileVolume(instance *cachev1.Openedx, vol volume) error {
+	if vol.existing {
+		return nil
+	}
+
+	claim := &corev1.PersistentVolumeClaim{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{
+		Name:      vol.claimName,
+		Namespace: getOpenedxNamespace(instance),
+	}, claim)
+	if errors.IsNotFound(err) {
+		// Created with its StatefulSet
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(claim.DeepCopy())
+
+	changed, err := r.syncClaimOwner(instance, claim, getOpenedxVolume(instance, vol.name).RetainOnDelete)
+	if err != nil {
+		return err
+	}
+
+	size := getOpenedxVolumeSize(instance, vol.name)
+	request := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	if size.Cmp(request) > 0 {
+		expandable, err := r.isClaimExpandable(claim)
+		if err != nil {
+			return err
+		}
+		if expandable {
+			log.Info("Expanding pvc : ", claim.Name, " from ", request.String(), " to ", size.String())
+			claim.Spec.Resources.Requests[corev1.ResourceStorage] = size
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	log.Info("Patching pvc")
+	log.Info("pvc Namespace : ", claim.Namespace)
+	log.Info("pvc Name : ", claim.Name)
+	return r.Client.Patch(context.TODO(), claim, patch)
+}
+
+// syncClaimOwner makes the claim owned by instance, so it is deleted with it,
+// unless it is retained on delete. It reports whether the claim changed.
+func (r *OpenedxReconciler) syncClaimOwner(instance *cachev1.Openedx,
+	claim *corev1.PersistentVolumeClaim,
+	retain bool,
+) (bool, error) {
+	owned := isOwnedBy(instance, claim)
+
+	switch {
+	case retain && owned:
+		refs := make([]metav1.OwnerReference, 0, len(claim.OwnerReferences))
+		for _, ref := range claim.OwnerReferences {
+			if ref.UID != instance.UID {
+				refs = append(refs, ref)
+			}
+		}
+		claim.OwnerReferences = refs
+		delete(claim.Annotations, ownerAnnotation)
+		return true, nil
+
+	case !retain && !owned:
+		if claim.Namespace != instance.Namespace {
+			trackOwner(instance, claim)
+			return true, nil
+		}
+		if err := controllerutil.SetControllerReference(instance, claim, r.Scheme); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// isClaimExpandable reports whether the StorageClass of the claim allows
+// volume expansion.
+func (r *OpenedxReconciler) isClaimExpandable(claim *corev1.PersistentVolumeClaim) (bool, error) {
+	if claim.Spec.StorageClassName == nil || len(*claim.Spec.StorageClassName) == 0 {
+		return false, nil
+	}
+
+	class := &storagev1.StorageClass{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: *claim.Spec.StorageClassName}, class)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return class.AllowVolumeExpansion != nil && *class.AllowVolumeExpansion, nil
+}
+
+// hasClaimCondition reports whether the claim has the given condition set.
+func hasClaimCondition(claim *corev1.PersistentVolumeClaim, condType corev1.PersistentVolumeClaimConditionType) bool {
+	for _, cond := range claim.Status.Conditions {
+		if cond.Type == condType && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// volumeStatus returns the state of every persistent volume claim of the platform.
+func (r *OpenedxReconciler) volumeStatus(instance *cachev1.Openedx) []cachev1.VolumeStatus {
+	volumes := make([]cachev1.VolumeStatus, 0)
+	for _, vol := range r.getOpenedxVolumes(instance) {
+		status := cachev1.VolumeStatus{
+			Name:      vol.name,
+			ClaimName: vol.claimName,
+		}
+		if !vol.existing {
+			size := getOpenedxVolumeSize(instance, vol.name)
+			status.Requested = &size
+		}
+
+		claim := &corev1.PersistentVolumeClaim{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{
+			Name:      vol.claimName,
+			Namespace: getOpenedxNamespace(instance),
+		}, claim)
+		if err != nil {
+			status.State = cachev1.VolumePending
+			if errors.IsNotFound(err) {
+				status.Message = "Claim not found"
+			} else {
+				status.Message = err.Error()
+			}
+			volumes = append(volumes, status)
+			continue
+		}
+
+		capacity, bound := claim.Status.Capacity[corev1.ResourceStorage]
+		if bound {
+			status.Capacity = &capacity
+		}
+
+		switch {
+		case claim.Status.Phase != corev1.ClaimBound:
+			status.State = cachev1.VolumePending
+		case hasClaimCondition(claim, corev1.PersistentVolumeClaimFileSystemResizePending):
+			status.State = cachev1.VolumeFileSystemResizePending
+			status.Message = "The file system is grown when the pod using the claim restarts"
+		case hasClaimCondition(claim, corev1.PersistentVolumeClaimResizing):
+			status.State = cachev1.VolumeResizing
+		case status.Requested != nil && bound && status.Requested.Cmp(capacity) > 0:
+			if expandable, err := r.isClaimExpandable(claim); err == nil && !expandable {
+				status.State = cachev1.VolumeExpansionUnsupported
+				status.Message = "The StorageClass of the claim does not allow volume expansion"
+			} else {
+				status.State = cachev1.VolumeResizing
+			}
+		default:
+			status.State = cachev1.VolumeBound
+		}
+		volumes = append(volumes, status)
+	}
+	return volumes
+}
+
+// resizingVolumes returns a description of the volumes whose size does not
+// match the spec yet.
+func resizingVolumes(volumes []cachev1.VolumeStatus) []string {
+	resizing := make([]string, 0)
+	for _, vol := range volumes {
+		switch vol.State {
+		case cachev1.VolumeResizing, cachev1.VolumeFileSystemResizePending, cachev1.VolumeExpansionUnsupported:
+			resizing = append(resizing, fmt.Sprintf("%s (%s)", vol.Name, vol.State))
+		}
+	}
+	return resizing
+}
@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// specError reports an Openedx spec that cannot be reconciled until the user
+// fixes it. Requeueing does not help, so it is surfaced in the status instead.
+type specError struct {
+	errs field.ErrorList
+}
+
+func (e *specError) Error() string {
+	return e.errs.ToAggregate().Error()
+}
+
+// isSpecError reports whether err was caused by an invalid spec, or is an
+// aggregate holding such an error. The other errors of the aggregate are then
+// not retried either, until the spec or the objects it references change.
+func isSpecError(err error) bool {
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		for _, e := range agg.Errors() {
+			if isSpecError(e) {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := err.(*specError)
+	return ok
+}
+
+// validateDNSSubdomain checks that value is usable as a DNS host name.
+func validateDNSSubdomain(value string, path *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, msg := range validation.IsDNS1123Subdomain(value) {
+		allErrs = append(allErrs, field.Invalid(path, value, msg))
+	}
+	return allErrs
+}
+
+// validateComponents checks the replica counts of the components. Datastores
+// run a single pod on a ReadWriteOnce volume, so a second replica would either
+// never start or corrupt the data.
+func validateComponents(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if cr.Spec.Size < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "size"), cr.Spec.Size, "must be greater than or equal to 0"))
+	}
+	if cr.Spec.Components == nil {
+		return allErrs
+	}
+	path := field.NewPath("spec", "components")
+	c := cr.Spec.Components
+
+	components := []struct {
+		name string
+		spec *cachev1.ComponentSpec
+	}{
+		{"lms", c.Lms},
+		{"cms", c.Cms},
+		{"lmsWorker", c.LmsWorker},
+		{"cmsWorker", c.CmsWorker},
+		{"forum", c.Forum},
+		{"nginx", c.Nginx},
+		{"caddy", c.Caddy},
+	}
+	for _, component := range components {
+		if component.spec != nil && component.spec.Replicas != nil && *component.spec.Replicas < 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child(component.name, "replicas"), *component.spec.Replicas,
+				"must be greater than or equal to 0"))
+		}
+	}
+
+	datastores := []struct {
+		name string
+		spec *cachev1.DatastoreSpec
+	}{
+		{"mysql", c.MySQL},
+		{"mongodb", c.MongoDB},
+		{"elasticsearch", c.Elasticsearch},
+		{"redis", c.Redis},
+		{"rabbitmq", c.RabbitMQ},
+	}
+	for _, datastore := range datastores {
+		if datastore.spec != nil && datastore.spec.Replicas != nil &&
+			(*datastore.spec.Replicas < 0 || *datastore.spec.Replicas > 1) {
+			allErrs = append(allErrs, field.Invalid(path.Child(datastore.name, "replicas"), *datastore.spec.Replicas,
+				"must be 0 or 1: the datastore runs a single pod on a ReadWriteOnce volume and cannot be scaled out"))
+		}
+	}
+	return allErrs
+}
+
+// validateAutoscaling checks the limits of the autoscalers, and that the
+// autoscaled containers request the resources their utilization is relative to.
+func validateAutoscaling(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if cr.Spec.Autoscaling == nil {
+		return allErrs
+	}
+	paths := map[string]*field.Path{
+		lmsDeploymentName(cr):       field.NewPath("spec", "autoscaling", "lms"),
+		cmsDeploymentName(cr):       field.NewPath("spec", "autoscaling", "cms"),
+		lmsworkerDeploymentName(cr): field.NewPath("spec", "autoscaling", "lmsWorker"),
+		cmsworkerDeploymentName(cr): field.NewPath("spec", "autoscaling", "cmsWorker"),
+	}
+
+	for _, d := range getOpenedxAutoscaledDeployments(cr) {
+		spec := d.autoscaler
+		if spec == nil {
+			continue
+		}
+		path := paths[d.name]
+
+		if spec.MaxReplicas < 1 {
+			allErrs = append(allErrs, field.Invalid(path.Child("maxReplicas"), spec.MaxReplicas, "must be greater than or equal to 1"))
+		}
+		if spec.MinReplicas != nil && (*spec.MinReplicas < 1 || *spec.MinReplicas > spec.MaxReplicas) {
+			allErrs = append(allErrs, field.Invalid(path.Child("minReplicas"), *spec.MinReplicas, "must be between 1 and maxReplicas"))
+		}
+
+		requests := getOpenedxResources(d.component).Requests
+		for _, metric := range autoscalerMetrics(spec) {
+			if _, ok := requests[metric.Resource.Name]; !ok {
+				allErrs = append(allErrs, field.Required(path,
+					"autoscaling on "+string(metric.Resource.Name)+" utilization requires a "+
+						string(metric.Resource.Name)+" request in the resources of the component"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateExternalMongoDB checks the members of an external MongoDB.
+func validateExternalMongoDB(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	db := getOpenedxExternalMongoDB(cr)
+	if db == nil {
+		return allErrs
+	}
+	path := field.NewPath("spec", "mongodb", "external", "hosts")
+
+	if len(db.Hosts) == 0 {
+		allErrs = append(allErrs, field.Required(path, "at least one host is required"))
+	}
+	for i, host := range db.Hosts {
+		if !strings.Contains(host, ":") {
+			continue
+		}
+		if _, port, err := net.SplitHostPort(host); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Index(i), host, err.Error()))
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			allErrs = append(allErrs, field.Invalid(path.Index(i), host, "port must be between 1 and 65535"))
+		}
+	}
+	return allErrs
+}
+
+// validateSearch checks the endpoint and credentials of an external search cluster.
+func validateSearch(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	search := getOpenedxExternalSearch(cr)
+	if search == nil {
+		return allErrs
+	}
+	path := field.NewPath("spec", "search")
+
+	if cr.Spec.Search.InCluster != nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("inCluster"), "may not be set together with external"))
+	}
+	if _, _, _, _, err := parseSearchURL(search.URL); err != nil {
+		allErrs = append(allErrs, field.Invalid(path.Child("external", "url"), search.URL, err.Error()))
+	}
+	if len(search.BasicAuthSecret) > 0 && len(search.APIKeySecret) > 0 {
+		allErrs = append(allErrs, field.Forbidden(path.Child("external", "apiKeySecret"), "may not be set together with basicAuthSecret"))
+	}
+	return allErrs
+}
+
+// validateBroker checks that an external broker is configured when it is selected.
+func validateBroker(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if cr.Spec.Broker == nil {
+		return allErrs
+	}
+	path := field.NewPath("spec", "broker", "external")
+
+	if getOpenedxBrokerType(cr) == cachev1.BrokerExternal {
+		if cr.Spec.Broker.External == nil {
+			allErrs = append(allErrs, field.Required(path, "required when type is external"))
+		} else if len(cr.Spec.Broker.External.URLSecret) == 0 {
+			allErrs = append(allErrs, field.Required(path.Child("urlSecret"), ""))
+		}
+	} else if cr.Spec.Broker.External != nil {
+		allErrs = append(allErrs, field.Forbidden(path, "may only be set when type is external"))
+	}
+	return allErrs
+}
+
+// validateStorage checks the persistent volumes.
+func validateStorage(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if cr.Spec.Storage == nil {
+		return allErrs
+	}
+	path := field.NewPath("spec", "storage")
+
+	for _, name := range []string{"mysql", "mongodb", "elasticsearch", "redis", "rabbitmq", "caddy", "demo"} {
+		allErrs = append(allErrs, validateVolume(getOpenedxVolume(cr, name), path.Child(name))...)
+	}
+
+	// The size of the search volume is set in one place only
+	search := getOpenedxVolume(cr, "elasticsearch")
+	if getOpenedxInClusterSearch(cr).Storage != nil && (search.Size != nil || len(search.ExistingClaim) > 0) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "search", "inCluster", "storage"),
+			"may not be set together with spec.storage.elasticsearch.size or existingClaim"))
+	}
+	return allErrs
+}
+
+// validateVolume checks the settings of a volume. An existing claim is used
+// as is, so the settings of a claim created by the operator do not apply to it.
+func validateVolume(spec *cachev1.VolumeSpec, path *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if spec.Size != nil && spec.Size.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("size"), spec.Size.String(), "must be greater than 0"))
+	}
+	for i, mode := range spec.AccessModes {
+		switch mode {
+		case corev1.ReadWriteOnce, corev1.ReadOnlyMany, corev1.ReadWriteMany:
+		default:
+			allErrs = append(allErrs, field.NotSupported(path.Child("accessModes").Index(i), mode,
+				[]string{string(corev1.ReadWriteOnce), string(corev1.ReadOnlyMany), string(corev1.ReadWriteMany)}))
+		}
+	}
+
+	if len(spec.ExistingClaim) == 0 {
+		return allErrs
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(spec.ExistingClaim) {
+		allErrs = append(allErrs, field.Invalid(path.Child("existingClaim"), spec.ExistingClaim, msg))
+	}
+	if spec.Size != nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("size"), "may not be set together with existingClaim"))
+	}
+	if spec.StorageClassName != nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("storageClassName"), "may not be set together with existingClaim"))
+	}
+	if len(spec.AccessModes) > 0 {
+		allErrs = append(allErrs, field.Forbidden(path.Child("accessModes"), "may not be set together with existingClaim"))
+	}
+	if spec.RetainOnDelete {
+		allErrs = append(allErrs, field.Forbidden(path.Child("retainOnDelete"), "an existing claim is always retained"))
+	}
+	return allErrs
+}
+
+// validateBackup checks the schedule and the destination of the backups.
+// The schedule is only checked for its shape, the CronJob controller parses it.
+func validateBackup(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	backup := getOpenedxBackup(cr)
+	if backup == nil {
+		return allErrs
+	}
+	path := field.NewPath("spec", "backup")
+
+	schedule := strings.TrimSpace(backup.Schedule)
+	if !strings.HasPrefix(schedule, "@") && len(strings.Fields(schedule)) != 5 {
+		allErrs = append(allErrs, field.Invalid(path.Child("schedule"), backup.Schedule,
+			"must have 5 fields: minute, hour, day of month, month and day of week"))
+	}
+
+	if backup.S3 != nil {
+		if backup.Volume != nil {
+			allErrs = append(allErrs, field.Forbidden(path.Child("volume"), "may not be set together with s3"))
+		}
+		if len(backup.S3.CredentialsSecret) == 0 {
+			allErrs = append(allErrs, field.Required(path.Child("s3", "credentialsSecret"), ""))
+		}
+	} else if backup.Volume != nil {
+		allErrs = append(allErrs, validateVolume(backup.Volume, path.Child("volume"))...)
+	}
+	return allErrs
+}
+
+// validateVersion checks that the version is in the release catalog and is
+// not older than the release deployed, as migrations cannot be undone. An
+// upgrade may still be cancelled while the previous release runs.
+func validateVersion(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	path := field.NewPath("spec", "version")
+
+	version := getOpenedxVersion(cr)
+	if releaseIndex(version) < 0 {
+		names := make([]string, 0, len(releases))
+		for _, rel := range releases {
+			names = append(names, rel.name)
+		}
+		return append(allErrs, field.NotSupported(path, version, names))
+	}
+	if deployed := getOpenedxRelease(cr).name; releaseIndex(version) < releaseIndex(deployed) {
+		allErrs = append(allErrs, field.Forbidden(path, "may not go back from "+deployed+", downgrades are not supported"))
+	}
+
+	if cr.Spec.Upgrade != nil && cr.Spec.Upgrade.Backup && getOpenedxBackup(cr) == nil {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "upgrade", "backup"),
+			"requires spec.backup to be set"))
+	}
+	return allErrs
+}
+
+// validateMaintenance checks the address ranges written in the nginx configuration.
+func validateMaintenance(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	maintenance := getOpenedxMaintenance(cr)
+	path := field.NewPath("spec", "maintenance")
+
+	for i, cidr := range maintenance.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("allowedCIDRs").Index(i), cidr, err.Error()))
+		}
+	}
+	for i, cidr := range maintenance.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("trustedProxies").Index(i), cidr, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// validateDeletionPolicy checks that a snapshot class is only set when the
+// volumes are snapshotted.
+func validateDeletionPolicy(cr *cachev1.Openedx) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if cr.Spec.VolumeSnapshotClassName != nil && getOpenedxDeletionPolicy(cr) != cachev1.DeletionPolicySnapshot {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "volumeSnapshotClassName"),
+			"may only be set when deletionPolicy is Snapshot"))
+	}
+	return allErrs
+}
+
+// validateOpenedx checks the parts of the spec the CRD schema cannot express,
+// such as host names derived from several fields.
+func validateOpenedx(cr *cachev1.Openedx) error {
+	allErrs := field.ErrorList{}
+	spec := field.NewPath("spec")
+
+	if len(cr.Spec.BaseDomain) > 0 {
+		allErrs = append(allErrs, validateDNSSubdomain(cr.Spec.BaseDomain, spec.Child("baseDomain"))...)
+	}
+
+	// Default host names are built from the site names and the base domain,
+	// which are only valid together.
+	allErrs = append(allErrs, validateDNSSubdomain(getOpenedxLmsHost(cr), spec.Child("lmsHost"))...)
+	allErrs = append(allErrs, validateDNSSubdomain(getOpenedxCmsHost(cr), spec.Child("studioHost"))...)
+	allErrs = append(allErrs, validateDNSSubdomain(getOpenedxPreviewHost(cr), spec.Child("previewHost"))...)
+
+	allErrs = append(allErrs, validateComponents(cr)...)
+	allErrs = append(allErrs, validateAutoscaling(cr)...)
+	allErrs = append(allErrs, validateExternalMongoDB(cr)...)
+	allErrs = append(allErrs, validateSearch(cr)...)
+	allErrs = append(allErrs, validateBroker(cr)...)
+	allErrs = append(allErrs, validateStorage(cr)...)
+	allErrs = append(allErrs, validateBackup(cr)...)
+	allErrs = append(allErrs, validateVersion(cr)...)
+	allErrs = append(allErrs, validateMaintenance(cr)...)
+	allErrs = append(allErrs, validateDeletionPolicy(cr)...)
+	allErrs = append(allErrs, validateSettings(cr)...)
+
+	if len(allErrs) > 0 {
+		return &specError{errs: allErrs}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	cachev1 "github.com/rocrisp/openedx-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestValidateStorage(t *testing.T) {
+	size := func(s string) *resource.Quantity {
+		q := resource.MustParse(s)
+		return &q
+	}
+	storage := func(search *cachev1.VolumeSpec, inCluster *resource.Quantity) *cachev1.Openedx {
+		cr := &cachev1.Openedx{Spec: cachev1.OpenedxSpec{Storage: &cachev1.StorageSpec{Elasticsearch: search}}}
+		if inCluster != nil {
+			cr.Spec.Search = &cachev1.SearchSpec{InCluster: &cachev1.InClusterSearchSpec{Storage: inCluster}}
+		}
+		return cr
+	}
+
+	tests := []struct {
+		name string
+		cr   *cachev1.Openedx
+		err  string
+	}{
+		{"no storage", &cachev1.Openedx{}, ""},
+		{"volume size", storage(&cachev1.VolumeSpec{Size: size("10Gi")}, nil), ""},
+		{"search storage", storage(nil, size("10Gi")), ""},
+		{"search storage and volume access modes", storage(&cachev1.VolumeSpec{AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}}, size("10Gi")), ""},
+		{"search storage and volume size", storage(&cachev1.VolumeSpec{Size: size("10Gi")}, size("20Gi")),
+			"spec.search.inCluster.storage: Forbidden"},
+		{"search storage and existing claim", storage(&cachev1.VolumeSpec{ExistingClaim: "search"}, size("20Gi")),
+			"spec.search.inCluster.storage: Forbidden"},
+		{"empty volume", storage(&cachev1.VolumeSpec{Size: size("0")}, nil), "spec.storage.elasticsearch.size: Invalid value"},
+		{"unknown access mode", storage(&cachev1.VolumeSpec{AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteSometimes"}}, nil),
+			"spec.storage.elasticsearch.accessModes[0]: Unsupported value"},
+		{"size of an existing claim", storage(&cachev1.VolumeSpec{ExistingClaim: "search", Size: size("10Gi")}, nil),
+			"spec.storage.elasticsearch.size: Forbidden"},
+		{"invalid existing claim", storage(&cachev1.VolumeSpec{ExistingClaim: "Search"}, nil),
+			"spec.storage.elasticsearch.existingClaim: Invalid value"},
+	}
+
+	for _, tt := range tests {
+		errs := validateStorage(tt.cr)
+		if tt.err == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: unexpected errors %v", tt.name, errs)
+			}
+			continue
+		}
+		if len(errs) == 0 || !strings.Contains(errs.ToAggregate().Error(), tt.err) {
+			t.Errorf("%s: got %v, want an error about %q", tt.name, errs, tt.err)
+		}
+	}
+}
@@ -9,6 +9,7 @@ require (
 	github.com/openshift/api v3.9.0+incompatible
 	github.com/prometheus/common v0.4.1
 	k8s.io/api v0.18.6
+	k8s.io/apiextensions-apiserver v0.18.6
 	k8s.io/apimachinery v0.18.6
 	k8s.io/client-go v0.18.6
 	sigs.k8s.io/controller-runtime v0.6.2
@@ -78,11 +78,20 @@ func main() {
 	}
 
 	if err = (&controllers.OpenedxReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("Openedx"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("openedx-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Openedx")
+		os.Exit(1)
+	}
+	if err = (&controllers.OpenedxRestoreReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Openedx"),
+		Log:    ctrl.Log.WithName("controllers").WithName("OpenedxRestore"),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Openedx")
+		setupLog.Error(err, "unable to create controller", "controller", "OpenedxRestore")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
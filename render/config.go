@@ -0,0 +1,166 @@
+// Copyright 2021 Openedx Operator Developers
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package render renders the configuration files of an Open edX platform
+// (env.json, Django settings, nginx, Caddy and Redis configuration) from a
+// typed model, so the files can be reviewed and diffed as templates.
+package render
+
+import "fmt"
+
+// Config is the model every rendered file is derived from.
+type Config struct {
+	// PlatformName is the title displayed by the LMS and Studio.
+	PlatformName string
+
+	// Release is the Open edX release the settings are rendered for. A
+	// template named "<release>/<file>" replaces the one of the file.
+	Release string
+
+	// Public host names of the platform.
+	LmsHost     string
+	CmsHost     string
+	PreviewHost string
+
+	MySQL         MySQL
+	MongoDB       MongoDB
+	Redis         Redis
+	Elasticsearch Elasticsearch
+	SMTP          SMTP
+
+	// ForumURL is the internal URL of the discussion forum.
+	ForumURL string
+
+	// Broker is the Celery broker shared by the LMS, the CMS and their
+	// workers, which send tasks to each other's queues.
+	Broker Broker
+
+	// User settings layered over the rendered settings of each service.
+	Lms Customization
+	Cms Customization
+
+	// Maintenance, when set, has nginx answer with a maintenance page
+	// instead of proxying to the LMS and CMS.
+	Maintenance *Maintenance
+}
+
+// Maintenance is a static page served with HTTP 503 while the platform is
+// unavailable.
+type Maintenance struct {
+	// Page is the HTML of the page. A page naming the platform is rendered when empty.
+	Page string
+
+	// RetryAfter is the number of seconds clients are told to wait before retrying.
+	RetryAfter int32
+
+	// AllowedCIDRs are the client addresses still proxied to the LMS and CMS.
+	// The client address is read from X-Forwarded-For, as set by the proxies
+	// in front of nginx, which are trusted in TrustedProxies.
+	AllowedCIDRs   []string
+	TrustedProxies []string
+}
+
+// PublicHosts returns every host name the platform is served on.
+func (c *Config) PublicHosts() []string {
+	return []string{c.LmsHost, c.PreviewHost, c.CmsHost}
+}
+
+// Customization is user supplied settings, applied in order after the
+// settings rendered by the operator.
+type Customization struct {
+	// Env overrides merged into env.json.
+	Env []map[string]interface{}
+	// Python snippets appended to production.py, followed by the settings
+	// managed by the operator so that they cannot override them.
+	Python []string
+}
+
+// MySQL is the relational database of the LMS and CMS.
+type MySQL struct {
+	Host     string
+	Port     int32
+	Database string
+	Username string
+}
+
+// MongoDB is the course content store.
+type MongoDB struct {
+	// Host is a host name, or the comma separated host:port members of a replica set.
+	Host     string
+	Port     int32
+	Database string
+
+	ReplicaSet string
+	TLS        bool
+
+	// Authenticated reads the credentials from the OPENEDX_MONGODB_USERNAME
+	// and OPENEDX_MONGODB_PASSWORD environment variables.
+	Authenticated bool
+	AuthSource    string
+}
+
+// Redis is the cache, and the Celery broker of the CMS.
+type Redis struct {
+	Host string
+	Port int32
+}
+
+// Address returns host:port.
+func (r Redis) Address() string {
+	return fmt.Sprintf("%s:%d", r.Host, r.Port)
+}
+
+// CacheLocation returns the django-redis location of the caches.
+func (r Redis) CacheLocation() string {
+	return fmt.Sprintf("redis://@%s/1", r.Address())
+}
+
+// Elasticsearch is the search backend of courseware and course discovery.
+// It may be Elasticsearch or OpenSearch.
+type Elasticsearch struct {
+	Host      string
+	Port      int32
+	TLS       bool
+	URLPrefix string
+
+	// BasicAuth reads the credentials from the OPENEDX_ELASTICSEARCH_USERNAME
+	// and OPENEDX_ELASTICSEARCH_PASSWORD environment variables, APIKey from
+	// OPENEDX_ELASTICSEARCH_API_KEY.
+	BasicAuth bool
+	APIKey    bool
+
+	// CACerts is the path of the CA bundle the certificate of the cluster is
+	// verified with. The system CAs are used when empty.
+	CACerts string
+}
+
+// SMTP is the outgoing mail relay.
+type SMTP struct {
+	Host string
+	Port int32
+}
+
+// Broker is a Celery broker.
+type Broker struct {
+	Transport string
+	Hostname  string
+
+	// Authenticated reads the credentials from the OPENEDX_CELERY_BROKER_USER
+	// and OPENEDX_CELERY_BROKER_PASSWORD environment variables.
+	Authenticated bool
+
+	// External reads the whole broker URL from the OPENEDX_CELERY_BROKER_URL
+	// environment variable; Transport and Hostname are ignored.
+	External bool
+}
@@ -0,0 +1,293 @@
+// Copyright 2021 Openedx Operator Developers
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Env is the content of lms.env.json and cms.env.json, which edx-platform
+// loads as ENV_TOKENS. Credentials are left empty here and read from the
+// environment by the Django settings instead.
+type Env struct {
+	SiteName        string                 `json:"SITE_NAME"`
+	BookURL         string                 `json:"BOOK_URL"`
+	LogDir          string                 `json:"LOG_DIR"`
+	LoggingEnv      string                 `json:"LOGGING_ENV"`
+	OAuthOIDCIssuer string                 `json:"OAUTH_OIDC_ISSUER"`
+	PlatformName    string                 `json:"PLATFORM_NAME"`
+	Features        map[string]interface{} `json:"FEATURES"`
+	LmsRootURL      string                 `json:"LMS_ROOT_URL"`
+	CmsRootURL      string                 `json:"CMS_ROOT_URL"`
+	CmsBase         string                 `json:"CMS_BASE"`
+	LmsBase         string                 `json:"LMS_BASE"`
+	ContactEmail    string                 `json:"CONTACT_EMAIL"`
+
+	CeleryBrokerTransport string `json:"CELERY_BROKER_TRANSPORT"`
+	CeleryBrokerHostname  string `json:"CELERY_BROKER_HOSTNAME"`
+	CeleryBrokerUser      string `json:"CELERY_BROKER_USER"`
+	CeleryBrokerPassword  string `json:"CELERY_BROKER_PASSWORD"`
+	AlternateWorkerQueues string `json:"ALTERNATE_WORKER_QUEUES"`
+
+	CommentsServiceURL string `json:"COMMENTS_SERVICE_URL,omitempty"`
+
+	EnableComprehensiveTheming bool     `json:"ENABLE_COMPREHENSIVE_THEMING"`
+	ComprehensiveThemeDirs     []string `json:"COMPREHENSIVE_THEME_DIRS"`
+	StaticRootBase             string   `json:"STATIC_ROOT_BASE"`
+
+	ElasticSearchConfig []ElasticSearchHost `json:"ELASTIC_SEARCH_CONFIG"`
+
+	EmailBackend  string `json:"EMAIL_BACKEND"`
+	EmailHost     string `json:"EMAIL_HOST"`
+	EmailPort     int32  `json:"EMAIL_PORT"`
+	EmailUseTLS   bool   `json:"EMAIL_USE_TLS"`
+	EmailHostUser string `json:"EMAIL_HOST_USER"`
+	EmailPassword string `json:"EMAIL_HOST_PASSWORD"`
+
+	HTTPS               string `json:"HTTPS"`
+	LanguageCode        string `json:"LANGUAGE_CODE"`
+	SessionCookieDomain string `json:"SESSION_COOKIE_DOMAIN"`
+
+	Caches map[string]Cache `json:"CACHES"`
+
+	SecretKey          string `json:"SECRET_KEY"`
+	AWSAccessKeyID     string `json:"AWS_ACCESS_KEY_ID"`
+	AWSSecretAccessKey string `json:"AWS_SECRET_ACCESS_KEY"`
+
+	// The content store and doc store are configured by the Django settings.
+	ContentStore   interface{} `json:"CONTENTSTORE"`
+	DocStoreConfig interface{} `json:"DOC_STORE_CONFIG"`
+
+	XQueueInterface XQueueInterface     `json:"XQUEUE_INTERFACE"`
+	Databases       map[string]Database `json:"DATABASES"`
+}
+
+// ElasticSearchHost is an entry of ELASTIC_SEARCH_CONFIG.
+type ElasticSearchHost struct {
+	Host      string `json:"host"`
+	Port      int32  `json:"port"`
+	UseSSL    bool   `json:"use_ssl,omitempty"`
+	URLPrefix string `json:"url_prefix,omitempty"`
+}
+
+// Cache is an entry of CACHES.
+type Cache struct {
+	KeyPrefix string `json:"KEY_PREFIX"`
+	Version   string `json:"VERSION,omitempty"`
+	Timeout   int    `json:"TIMEOUT,omitempty"`
+	Backend   string `json:"BACKEND"`
+	Location  string `json:"LOCATION"`
+}
+
+// XQueueInterface is the external grader configuration, unused here.
+type XQueueInterface struct {
+	DjangoAuth interface{} `json:"django_auth"`
+	URL        interface{} `json:"url"`
+}
+
+// Database is an entry of DATABASES.
+type Database struct {
+	Engine         string            `json:"ENGINE"`
+	Host           string            `json:"HOST"`
+	Port           int32             `json:"PORT"`
+	Name           string            `json:"NAME"`
+	User           string            `json:"USER"`
+	Password       string            `json:"PASSWORD"`
+	AtomicRequests bool              `json:"ATOMIC_REQUESTS"`
+	Options        map[string]string `json:"OPTIONS"`
+}
+
+const redisCacheBackend = "django_redis.cache.RedisCache"
+
+// baseEnv returns the settings shared by the LMS and CMS.
+func baseEnv(cfg *Config) *Env {
+	location := cfg.Redis.CacheLocation()
+	redisCache := func(prefix string, timeout int) Cache {
+		return Cache{KeyPrefix: prefix, Timeout: timeout, Backend: redisCacheBackend, Location: location}
+	}
+
+	return &Env{
+		LogDir:          "/openedx/data/logs",
+		LoggingEnv:      "sandbox",
+		OAuthOIDCIssuer: "http://" + cfg.LmsHost + "/oauth2",
+		PlatformName:    cfg.PlatformName,
+		LmsRootURL:      "http://" + cfg.LmsHost,
+		CmsRootURL:      "http://" + cfg.CmsHost,
+		CmsBase:         cfg.CmsHost,
+		LmsBase:         cfg.LmsHost,
+		ContactEmail:    "contact@" + cfg.LmsHost,
+
+		CeleryBrokerTransport: cfg.Broker.Transport,
+		CeleryBrokerHostname:  cfg.Broker.Hostname,
+
+		EnableComprehensiveTheming: true,
+		ComprehensiveThemeDirs:     []string{"/openedx/themes"},
+		StaticRootBase:             "/openedx/staticfiles",
+
+		ElasticSearchConfig: []ElasticSearchHost{{
+			Host:      cfg.Elasticsearch.Host,
+			Port:      cfg.Elasticsearch.Port,
+			UseSSL:    cfg.Elasticsearch.TLS,
+			URLPrefix: cfg.Elasticsearch.URLPrefix,
+		}},
+
+		EmailBackend: "django.core.mail.backends.smtp.EmailBackend",
+		EmailHost:    cfg.SMTP.Host,
+		EmailPort:    cfg.SMTP.Port,
+
+		HTTPS:               "off",
+		LanguageCode:        "en",
+		SessionCookieDomain: "." + cfg.LmsHost,
+
+		Caches: map[string]Cache{
+			"default": {
+				KeyPrefix: "default",
+				Version:   "1",
+				Backend:   redisCacheBackend,
+				Location:  location,
+			},
+			"general":                    redisCache("general", 0),
+			"mongo_metadata_inheritance": redisCache("mongo_metadata_inheritance", 300),
+			"configuration":              redisCache("configuration", 0),
+			"celery":                     redisCache("celery", 7200),
+			"course_structure_cache":     redisCache("course_structure", 7200),
+		},
+
+		Databases: map[string]Database{
+			"default": {
+				Engine:         "django.db.backends.mysql",
+				Host:           cfg.MySQL.Host,
+				Port:           cfg.MySQL.Port,
+				Name:           cfg.MySQL.Database,
+				User:           cfg.MySQL.Username,
+				AtomicRequests: true,
+				Options: map[string]string{
+					"init_command": "SET sql_mode='STRICT_TRANS_TABLES'",
+				},
+			},
+		},
+	}
+}
+
+// LmsEnv returns the content of lms.env.json.
+func LmsEnv(cfg *Config) *Env {
+	env := baseEnv(cfg)
+	env.SiteName = cfg.LmsHost
+	env.Features = map[string]interface{}{
+		"CERTIFICATES_HTML_VIEW":             true,
+		"PREVIEW_LMS_BASE":                   cfg.PreviewHost,
+		"ENABLE_CORS_HEADERS":                true,
+		"ENABLE_COURSE_DISCOVERY":            true,
+		"ENABLE_COURSEWARE_SEARCH":           true,
+		"ENABLE_CSMH_EXTENDED":               false,
+		"ENABLE_DASHBOARD_SEARCH":            true,
+		"ENABLE_COMBINED_LOGIN_REGISTRATION": true,
+		"ENABLE_GRADE_DOWNLOADS":             true,
+		"ENABLE_LEARNER_RECORDS":             false,
+		"ENABLE_MOBILE_REST_API":             true,
+		"ENABLE_OAUTH2_PROVIDER":             true,
+		"ENABLE_THIRD_PARTY_AUTH":            true,
+	}
+	env.AlternateWorkerQueues = "cms"
+	env.CommentsServiceURL = cfg.ForumURL
+	env.Caches["staticfiles"] = Cache{
+		KeyPrefix: "staticfiles_lms",
+		Backend:   redisCacheBackend,
+		Location:  cfg.Redis.CacheLocation(),
+	}
+	env.Caches["ora2-storage"] = Cache{
+		KeyPrefix: "ora2-storage",
+		Backend:   redisCacheBackend,
+		Location:  cfg.Redis.CacheLocation(),
+	}
+	return env
+}
+
+// CmsEnv returns the content of cms.env.json.
+func CmsEnv(cfg *Config) *Env {
+	env := baseEnv(cfg)
+	env.SiteName = cfg.CmsHost
+	env.Features = map[string]interface{}{
+		"CERTIFICATES_HTML_VIEW":  true,
+		"PREVIEW_LMS_BASE":        cfg.PreviewHost,
+		"ENABLE_COURSEWARE_INDEX": true,
+		"ENABLE_CSMH_EXTENDED":    false,
+		"ENABLE_LEARNER_RECORDS":  false,
+		"ENABLE_LIBRARY_INDEX":    true,
+	}
+	env.AlternateWorkerQueues = "lms"
+	env.Caches["staticfiles"] = Cache{
+		KeyPrefix: "staticfiles_cms",
+		Backend:   "django.core.cache.backends.locmem.LocMemCache",
+		Location:  "staticfiles_cms",
+	}
+	return env
+}
+
+// values returns env as generic JSON values, which overrides are merged into.
+func (e *Env) values() (map[string]interface{}, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	values := map[string]interface{}{}
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// renderEnv renders env as indented JSON, with the user overrides applied in order.
+func renderEnv(env *Env, custom Customization) (string, error) {
+	values, err := env.values()
+	if err != nil {
+		return "", err
+	}
+	for _, overrides := range custom.Env {
+		if err := mergeEnv(values, overrides, ""); err != nil {
+			return "", err
+		}
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(values); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// OpenedxConfig renders lms.env.json and cms.env.json.
+func OpenedxConfig(cfg *Config) (map[string]string, error) {
+	lms, err := renderEnv(LmsEnv(cfg), cfg.Lms)
+	if err != nil {
+		return nil, fmt.Errorf("lms.env.json: %v", err)
+	}
+	cms, err := renderEnv(CmsEnv(cfg), cfg.Cms)
+	if err != nil {
+		return nil, fmt.Errorf("cms.env.json: %v", err)
+	}
+	return map[string]string{
+		"lms.env.json": lms,
+		"cms.env.json": cms,
+	}, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 Openedx Operator Developers
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// protectedEnvKeys are the env.json settings managed by the operator, as
+// dotted paths. They are derived from the spec or wire the platform to its
+// other components, so overriding them would break the deployment.
+var protectedEnvKeys = map[string]bool{
+	"SITE_NAME":                 true,
+	"LMS_BASE":                  true,
+	"CMS_BASE":                  true,
+	"LMS_ROOT_URL":              true,
+	"CMS_ROOT_URL":              true,
+	"FEATURES.PREVIEW_LMS_BASE": true,
+	"OAUTH_OIDC_ISSUER":         true,
+	"SESSION_COOKIE_DOMAIN":     true,
+	"CACHES":                    true,
+	"DATABASES":                 true,
+	"CONTENTSTORE":              true,
+	"DOC_STORE_CONFIG":          true,
+	"ELASTIC_SEARCH_CONFIG":     true,
+	"CELERY_BROKER_TRANSPORT":   true,
+	"CELERY_BROKER_HOSTNAME":    true,
+	"CELERY_BROKER_USER":        true,
+	"CELERY_BROKER_PASSWORD":    true,
+	"COMMENTS_SERVICE_URL":      true,
+	"SECRET_KEY":                true,
+}
+
+// protectedPythonSettings are the Django settings managed by the operator
+// besides the protected env.json settings: those the settings templates set
+// from the Secrets and the coordinates of the datastores.
+var protectedPythonSettings = []string{
+	"BROKER_URL",
+	"COMMENTS_SERVICE_KEY",
+	"MODULESTORE",
+}
+
+// protectedSettings returns the dotted paths of the Django settings managed by
+// the operator, which are set again after the Python settings of the user.
+func protectedSettings() []string {
+	settings := append([]string{}, protectedPythonSettings...)
+	for key := range protectedEnvKeys {
+		settings = append(settings, key)
+	}
+	sort.Strings(settings)
+	return settings
+}
+
+// ProtectedKeyError reports an override of a setting managed by the operator.
+type ProtectedKeyError struct {
+	Key string
+}
+
+func (e *ProtectedKeyError) Error() string {
+	return fmt.Sprintf("%s is managed by the operator and cannot be overridden", e.Key)
+}
+
+// isProtected reports whether overriding the setting at path would clobber a
+// protected setting, either the setting itself or one nested in it.
+func isProtected(path string) bool {
+	if protectedEnvKeys[path] {
+		return true
+	}
+	for key := range protectedEnvKeys {
+		if strings.HasPrefix(key, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckEnvOverrides returns an error when overrides would clobber a protected setting.
+func CheckEnvOverrides(overrides map[string]interface{}) error {
+	return mergeEnv(map[string]interface{}{}, overrides, "")
+}
+
+// mergeEnv merges overrides into env. Objects present in both are merged key
+// by key, any other value replaces the current one. Keys are visited in order
+// so that the first protected key is reported deterministically.
+func mergeEnv(env, overrides map[string]interface{}, prefix string) error {
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if src, ok := overrides[key].(map[string]interface{}); ok && !protectedEnvKeys[path] {
+			dst, ok := env[key].(map[string]interface{})
+			if !ok {
+				if _, exists := env[key]; exists && isProtected(path) {
+					return &ProtectedKeyError{Key: path}
+				}
+				dst = map[string]interface{}{}
+				env[key] = dst
+			}
+			if err := mergeEnv(dst, src, path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isProtected(path) {
+			return &ProtectedKeyError{Key: path}
+		}
+		env[key] = overrides[key]
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 Openedx Operator Developers
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// Reverse proxy configuration: nginx routes requests to the LMS and CMS and
+// Caddy fronts nginx for each public host name.
+const nginxTemplates = `
+{{- define "_tutor.conf" -}}
+# Allow long domain names
+server_names_hash_bucket_size 128;
+
+# Set a short ttl for proxies to allow restarts
+resolver 127.0.0.11 [::1]:5353 valid=10s;
+
+# Configure logging to include scheme and server name
+log_format tutor '$remote_addr - $remote_user [$time_local] $scheme://$host "$request" '
+                 '$status $body_bytes_sent "$http_referer" '
+                 '"$http_user_agent" "$http_x_forwarded_for"';
+{{- with .Maintenance }}
+{{- if .AllowedCIDRs }}
+
+# Maintenance mode: the client address is the last one of X-Forwarded-For
+# that was not added by a trusted proxy
+{{- range .TrustedProxies }}
+set_real_ip_from {{ . }};
+{{- end }}
+real_ip_header X-Forwarded-For;
+real_ip_recursive on;
+
+# Clients still proxied to the LMS and CMS during maintenance
+geo $maintenance_blocked {
+  default 1;
+{{- range .AllowedCIDRs }}
+  {{ . }} 0;
+{{- end }}
+}
+{{- end }}
+{{- end }}
+{{ end }}
+
+{{- define "maintenance-server.conf" -}}
+{{- with .Maintenance }}
+
+  # Maintenance mode: answer 503 with the maintenance page. The page is only
+  # reached through error_page, which serves it with the 503 status.
+  set $maintenance {{ if .AllowedCIDRs }}$maintenance_blocked{{ else }}1{{ end }};
+  if ($uri = /maintenance.html) {
+    set $maintenance 0;
+  }
+  if ($maintenance) {
+    return 503;
+  }
+  error_page 503 /maintenance.html;
+  location = /maintenance.html {
+    internal;
+    root /etc/nginx/conf.d;
+    add_header Retry-After {{ .RetryAfter }} always;
+    add_header Cache-Control "no-store" always;
+  }
+{{- end }}
+{{- end }}
+
+{{- define "maintenance.html" -}}
+{{- if .Maintenance.Page }}
+{{- .Maintenance.Page }}
+{{- else -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{ html .PlatformName }} - Maintenance</title>
+</head>
+<body>
+  <h1>{{ html .PlatformName }} is down for maintenance</h1>
+  <p>We will be back shortly, thank you for your patience.</p>
+</body>
+</html>
+{{ end }}
+{{- end }}
+
+{{- define "lms.conf" -}}
+upstream lms-backend {
+    server lms:8000 fail_timeout=0;
+}
+
+server {
+  listen 80;
+  server_name {{ .LmsHost }} {{ .PreviewHost }};
+
+  access_log /var/log/nginx/access.log tutor;
+  client_max_body_size 4M;
+  server_tokens off;
+{{- template "maintenance-server.conf" . }}
+
+  rewrite ^(.*)/favicon.ico$ /static/images/favicon.ico last;
+
+  location @proxy_to_lms_app {
+    proxy_redirect off;
+    proxy_set_header Host $http_host;
+    proxy_pass http://lms-backend;
+  }
+
+  location / {
+    try_files $uri @proxy_to_lms_app;
+  }
+
+  # /login?next=<any image> can be used by 3rd party sites in <img> tags to
+  # determine whether a user on their site is logged into edX.
+  # The most common image to use is favicon.ico.
+  location /login {
+    if ( $arg_next ~* "favicon.ico" ) {
+      return 403;
+    }
+    try_files $uri @proxy_to_lms_app;
+  }
+
+  # Need a separate location for the image uploads endpoint to limit upload sizes
+  location ~ ^/api/profile_images/[^/]*/[^/]*/upload$ {
+    try_files $uri @proxy_to_lms_app;
+    client_max_body_size 1049576;
+  }
+}
+{{ end }}
+
+{{- define "cms.conf" -}}
+upstream cms-backend {
+    server cms:8000 fail_timeout=0;
+}
+
+server {
+  listen 80;
+  server_name {{ .CmsHost }};
+
+  access_log /var/log/nginx/access.log tutor;
+  client_max_body_size 250M;
+  server_tokens off;
+{{- template "maintenance-server.conf" . }}
+
+  rewrite ^(.*)/favicon.ico$ /static/images/favicon.ico last;
+
+  location @proxy_to_cms_app {
+    proxy_redirect off;
+    proxy_set_header Host $http_host;
+    proxy_pass http://cms-backend;
+  }
+
+  location / {
+    try_files $uri @proxy_to_cms_app;
+  }
+}
+{{ end }}
+`
+
+const caddyTemplates = `
+{{- define "Caddyfile" -}}
+{{ range .PublicHosts -}}
+{{ . }}:80 {
+    reverse_proxy nginx:80
+}
+{{ end }}
+{{- end }}
+`
+
+const redisTemplates = `
+{{- define "redis.conf" -}}
+# https://raw.githubusercontent.com/redis/redis/6.0/redis.conf
+port {{ .Redis.Port }}
+tcp-backlog 511
+timeout 0
+tcp-keepalive 300
+daemonize no
+supervised no
+pidfile /var/run/redis_{{ .Redis.Port }}.pid
+loglevel notice
+logfile ""
+databases 16
+################################ SNAPSHOTTING  ################################
+#
+# Save the DB on disk:
+#
+#   save <seconds> <changes>
+save 900 1
+save 300 10
+save 60 10000
+stop-writes-on-bgsave-error yes
+rdbcompression yes
+rdbchecksum yes
+dir /openedx/redis/data/
+dbfilename dump.rdb
+rdb-del-sync-files no
+############################## APPEND ONLY MODE ###############################
+# http://redis.io/topics/persistence
+appendonly yes
+appendfilename "appendonly.aof"
+appendfsync everysec
+no-appendfsync-on-rewrite no
+auto-aof-rewrite-percentage 100
+auto-aof-rewrite-min-size 64mb
+aof-load-truncated yes
+aof-use-rdb-preamble yes
+{{ end }}
+`
@@ -0,0 +1,117 @@
+// Copyright 2021 Openedx Operator Developers
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// templates holds every template of the package. Each file is a named
+// template, defined in the *_templates.go files.
+var templates = template.Must(parse(
+	settingsTemplates,
+	nginxTemplates,
+	caddyTemplates,
+	redisTemplates,
+))
+
+var funcs = template.FuncMap{
+	// quote renders a string as a double quoted literal, valid in both JSON and Python.
+	"quote": func(s string) (string, error) {
+		b, err := json.Marshal(s)
+		return string(b), err
+	},
+	// chomp strips trailing newlines, so snippets are separated by exactly one.
+	"chomp": func(s string) string {
+		return strings.TrimRight(s, "\n")
+	},
+	// protectedSettings lists the Django settings managed by the operator.
+	"protectedSettings": protectedSettings,
+}
+
+func parse(texts ...string) (*template.Template, error) {
+	t := template.New("render").Funcs(funcs)
+	for _, text := range texts {
+		if _, err := t.Parse(text); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// execute renders the named templates with data. Files are keyed by the base
+// name of their template, so "lms/production.py" is returned as "production.py".
+func execute(data interface{}, names ...string) (map[string]string, error) {
+	files := make(map[string]string, len(names))
+	for _, name := range names {
+		var b bytes.Buffer
+		if err := templates.ExecuteTemplate(&b, name, data); err != nil {
+			return nil, err
+		}
+		files[path.Base(name)] = b.String()
+	}
+	return files, nil
+}
+
+// LmsSettings renders the Django settings package of the LMS.
+func LmsSettings(cfg *Config) (map[string]string, error) {
+	return djangoSettings(cfg, "lms")
+}
+
+// CmsSettings renders the Django settings package of the CMS.
+func CmsSettings(cfg *Config) (map[string]string, error) {
+	return djangoSettings(cfg, "cms")
+}
+
+func djangoSettings(cfg *Config, variant string) (map[string]string, error) {
+	return execute(cfg,
+		cfg.releaseTemplate("__init__.py"),
+		cfg.releaseTemplate(variant+"/production.py"),
+		cfg.releaseTemplate(variant+"/development.py"),
+	)
+}
+
+// releaseTemplate returns the name of the template of the release replacing
+// the named one, "<release>/<name>", or name when the release keeps it.
+func (c *Config) releaseTemplate(name string) string {
+	if len(c.Release) > 0 && templates.Lookup(c.Release+"/"+name) != nil {
+		return c.Release + "/" + name
+	}
+	return name
+}
+
+// NginxConfig renders the nginx server blocks of the LMS and CMS, and the
+// maintenance page when the platform is in maintenance.
+func NginxConfig(cfg *Config) (map[string]string, error) {
+	names := []string{"_tutor.conf", "lms.conf", "cms.conf"}
+	if cfg.Maintenance != nil {
+		names = append(names, "maintenance.html")
+	}
+	return execute(cfg, names...)
+}
+
+// CaddyConfig renders the Caddyfile.
+func CaddyConfig(cfg *Config) (map[string]string, error) {
+	return execute(cfg, "Caddyfile")
+}
+
+// RedisConfig renders redis.conf.
+func RedisConfig(cfg *Config) (map[string]string, error) {
+	return execute(cfg, "redis.conf")
+}
@@ -0,0 +1,408 @@
+// Copyright 2021 Openedx Operator Developers
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the rendered output")
+
+func testConfig() *Config {
+	return &Config{
+		PlatformName:  "Best Operator",
+		LmsHost:       "www.reallycool-openedx.apps.example.com",
+		CmsHost:       "mystudio.www.reallycool-openedx.apps.example.com",
+		PreviewHost:   "preview.www.reallycool-openedx.apps.example.com",
+		MySQL:         MySQL{Host: "mysql", Port: 3306, Database: "openedx", Username: "openedx"},
+		MongoDB:       MongoDB{Host: "mongodb", Port: 27017, Database: "openedx"},
+		Redis:         Redis{Host: "redis", Port: 6379},
+		Elasticsearch: Elasticsearch{Host: "elasticsearch", Port: 9200},
+		SMTP:          SMTP{Host: "smtp", Port: 25},
+		ForumURL:      "http://forum:4567",
+		Broker:        Broker{Transport: "redis", Hostname: "redis:6379"},
+		Lms: Customization{
+			Env: []map[string]interface{}{
+				{"LANGUAGE_CODE": "fr", "FEATURES": map[string]interface{}{"ENABLE_COURSE_DISCOVERY": false}},
+				{"LANGUAGE_CODE": "de", "TIME_ZONE": "Europe/Berlin"},
+			},
+			Python: []string{"ENABLE_FEATURE_X = True\n", "SOCIAL_AUTH_REDIRECT_IS_HTTPS = False"},
+		},
+	}
+}
+
+// TestGolden compares every rendered file with testdata/<configmap>/<file>.golden.
+// Run "go test ./render -update" to accept intended changes, and review the
+// diff of the golden files like any other change.
+func TestGolden(t *testing.T) {
+	cfg := testConfig()
+
+	renderers := map[string]func(*Config) (map[string]string, error){
+		"openedx-config":       OpenedxConfig,
+		"openedx-settings-lms": LmsSettings,
+		"openedx-settings-cms": CmsSettings,
+		"nginx-config":         NginxConfig,
+		"caddy-config":         CaddyConfig,
+		"redis-config":         RedisConfig,
+	}
+
+	for dir, render := range renderers {
+		checkGolden(t, cfg, dir, render)
+	}
+}
+
+// TestGoldenReleases compares the settings rendered for each release with
+// testdata/<release>/<configmap>/<file>.golden.
+func TestGoldenReleases(t *testing.T) {
+	renderers := map[string]func(*Config) (map[string]string, error){
+		"openedx-settings-lms": LmsSettings,
+		"openedx-settings-cms": CmsSettings,
+	}
+
+	for _, release := range []string{"koa", "lilac", "maple"} {
+		cfg := testConfig()
+		cfg.Release = release
+		for dir, render := range renderers {
+			checkGolden(t, cfg, filepath.Join(release, dir), render)
+		}
+	}
+}
+
+// checkGolden compares the files rendered from cfg with testdata/<dir>/<file>.golden,
+// or rewrites the golden files with -update.
+func checkGolden(t *testing.T, cfg *Config, dir string, render func(*Config) (map[string]string, error)) {
+	files, err := render(cfg)
+	if err != nil {
+		t.Fatalf("rendering %s: %v", dir, err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		golden := filepath.Join("testdata", dir, name+".golden")
+		got := files[name]
+
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Errorf("%s: %v", golden, err)
+			continue
+		}
+		if got != string(want) {
+			t.Errorf("%s does not match %s, run \"go test ./render -update\" to accept the change", name, golden)
+		}
+	}
+}
+
+func TestProtectedEnvKeys(t *testing.T) {
+	tests := []struct {
+		overrides map[string]interface{}
+		protected string
+	}{
+		{map[string]interface{}{"TIME_ZONE": "UTC"}, ""},
+		{map[string]interface{}{"FEATURES": map[string]interface{}{"ENABLE_THIRD_PARTY_AUTH": false}}, ""},
+		{map[string]interface{}{"LMS_BASE": "example.com"}, "LMS_BASE"},
+		{map[string]interface{}{"CACHES": map[string]interface{}{"default": nil}}, "CACHES"},
+		{map[string]interface{}{"FEATURES": map[string]interface{}{"PREVIEW_LMS_BASE": "example.com"}}, "FEATURES.PREVIEW_LMS_BASE"},
+		{map[string]interface{}{"FEATURES": nil}, "FEATURES"},
+	}
+
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.Cms.Env = []map[string]interface{}{tt.overrides}
+
+		_, err := OpenedxConfig(cfg)
+		if check := CheckEnvOverrides(tt.overrides); (check == nil) != (err == nil) {
+			t.Errorf("%v: CheckEnvOverrides returned %v but rendering returned %v", tt.overrides, check, err)
+		}
+
+		if tt.protected == "" {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", tt.overrides, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v: expected %s to be protected", tt.overrides, tt.protected)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.protected+" is managed by the operator") {
+			t.Errorf("%v: expected an error about %s, got %v", tt.overrides, tt.protected, err)
+		}
+	}
+}
+
+func TestProtectedPythonSettings(t *testing.T) {
+	cfg := testConfig()
+	cfg.Cms.Python = []string{"SECRET_KEY = \"x\"\nDATABASES[\"default\"][\"HOST\"] = \"x\"\nCACHES = {}"}
+
+	files, err := CmsSettings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := files["production.py"]
+
+	user := strings.Index(settings, `CACHES = {}`)
+	if user < 0 {
+		t.Fatalf("user settings not rendered:\n%s", settings)
+	}
+
+	// The settings managed by the operator are saved before the user settings
+	saved := strings.Index(settings, "operator_settings = {}")
+	if saved < 0 || saved > user {
+		t.Errorf("settings not saved before the user settings")
+	}
+	for _, key := range []string{"CACHES", "DATABASES", "BROKER_URL", "DOC_STORE_CONFIG", "ELASTIC_SEARCH_CONFIG", "FEATURES.PREVIEW_LMS_BASE"} {
+		if i := strings.Index(settings, `"`+key+`",`); i < saved || i > user {
+			t.Errorf("%s not saved before the user settings", key)
+		}
+	}
+
+	// and set again after them, along with the credentials
+	for _, line := range []string{
+		`for path, value in operator_settings.items():`,
+		`SECRET_KEY = os.environ["OPENEDX_SECRET_KEY"]`,
+		`DATABASES["default"]["PASSWORD"] = os.environ["OPENEDX_MYSQL_PASSWORD"]`,
+		`JWT_AUTH["JWT_SECRET_KEY"] = SECRET_KEY`,
+	} {
+		if strings.LastIndex(settings, line) < user {
+			t.Errorf("user settings override %q", line)
+		}
+	}
+
+	// Without user settings there is nothing to protect
+	cfg.Cms.Python = nil
+	if files, err = CmsSettings(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(files["production.py"], "operator_settings") {
+		t.Errorf("settings saved without user settings")
+	}
+}
+
+func TestExternalMongoDB(t *testing.T) {
+	cfg := testConfig()
+	cfg.MongoDB = MongoDB{
+		Host:          "mongo-0.example.com:27017,mongo-1.example.com:27017",
+		Port:          27017,
+		Database:      "modulestore",
+		ReplicaSet:    "rs0",
+		TLS:           true,
+		Authenticated: true,
+		AuthSource:    "admin",
+	}
+
+	files, err := LmsSettings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"host": "mongo-0.example.com:27017,mongo-1.example.com:27017",`,
+		`"db": "modulestore",`,
+		`mongodb_parameters["user"] = os.environ["OPENEDX_MONGODB_USERNAME"]`,
+		`mongodb_parameters["password"] = os.environ["OPENEDX_MONGODB_PASSWORD"]`,
+		`mongodb_parameters["authsource"] = "admin"`,
+		`mongodb_parameters["replicaSet"] = "rs0"`,
+		`mongodb_parameters["ssl"] = True`,
+	} {
+		if !strings.Contains(files["production.py"], want) {
+			t.Errorf("production.py does not contain %s", want)
+		}
+	}
+}
+
+func TestExternalSearch(t *testing.T) {
+	cfg := testConfig()
+	cfg.Elasticsearch = Elasticsearch{
+		Host:      "search.example.com",
+		Port:      443,
+		TLS:       true,
+		URLPrefix: "/es",
+		BasicAuth: true,
+		CACerts:   "/openedx/search-ca/ca.crt",
+	}
+
+	config, err := OpenedxConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"host": "search.example.com",`,
+		`"port": 443,`,
+		`"use_ssl": true`,
+		`"url_prefix": "/es",`,
+	} {
+		if !strings.Contains(config["lms.env.json"], want) {
+			t.Errorf("lms.env.json does not contain %s", want)
+		}
+	}
+
+	files, err := CmsSettings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`search_host["http_auth"] = (os.environ["OPENEDX_ELASTICSEARCH_USERNAME"], os.environ["OPENEDX_ELASTICSEARCH_PASSWORD"])`,
+		`search_host["verify_certs"] = True`,
+		`search_host["ca_certs"] = "/openedx/search-ca/ca.crt"`,
+	} {
+		if !strings.Contains(files["production.py"], want) {
+			t.Errorf("production.py does not contain %s", want)
+		}
+	}
+	if strings.Contains(files["production.py"], "OPENEDX_ELASTICSEARCH_API_KEY") {
+		t.Error("production.py reads an API key that is not configured")
+	}
+}
+
+func TestBroker(t *testing.T) {
+	cfg := testConfig()
+	cfg.Broker = Broker{Transport: "amqp", Hostname: "rabbitmq:5672", Authenticated: true}
+
+	config, err := OpenedxConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"lms.env.json", "cms.env.json"} {
+		for _, want := range []string{
+			`"CELERY_BROKER_HOSTNAME": "rabbitmq:5672",`,
+			`"CELERY_BROKER_TRANSPORT": "amqp",`,
+		} {
+			if !strings.Contains(config[name], want) {
+				t.Errorf("%s does not contain %s", name, want)
+			}
+		}
+	}
+
+	files, err := LmsSettings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`CELERY_BROKER_USER = os.environ["OPENEDX_CELERY_BROKER_USER"]`,
+		`CELERY_BROKER_PASSWORD = os.environ["OPENEDX_CELERY_BROKER_PASSWORD"]`,
+		`BROKER_URL = "{}://{}:{}@{}/{}".format(`,
+	} {
+		if !strings.Contains(files["production.py"], want) {
+			t.Errorf("production.py does not contain %s", want)
+		}
+	}
+
+	cfg.Broker = Broker{External: true}
+	files, err = CmsSettings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `BROKER_URL = os.environ["OPENEDX_CELERY_BROKER_URL"]`; !strings.Contains(files["production.py"], want) {
+		t.Errorf("production.py does not contain %s", want)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	cfg := testConfig()
+
+	for _, release := range []string{"", "koa", "lilac"} {
+		cfg.Release = release
+		files, err := LmsSettings(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "RemovedInDjango30Warning"; !strings.Contains(files["__init__.py"], want) {
+			t.Errorf("%q: __init__.py does not contain %s", release, want)
+		}
+		// Django REST framework 3.12 of lilac dropped the warnings of 3.10 and 3.11
+		if got := strings.Contains(files["__init__.py"], "RemovedInDRF310Warning"); got != (release != "lilac") {
+			t.Errorf("%q: __init__.py imports RemovedInDRF310Warning %v", release, got)
+		}
+	}
+
+	cfg.Release = "maple"
+	files, err := CmsSettings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "RemovedInDjango40Warning"; !strings.Contains(files["__init__.py"], want) {
+		t.Errorf("__init__.py does not contain %s", want)
+	}
+	if strings.Contains(files["__init__.py"], "RemovedInDjango30Warning") {
+		t.Error("__init__.py imports a warning Django 3.2 removed")
+	}
+	if _, ok := files["production.py"]; !ok {
+		t.Error("production.py is not rendered")
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	cfg := testConfig()
+	cfg.Maintenance = &Maintenance{
+		RetryAfter:     300,
+		TrustedProxies: []string{"10.0.0.0/8"},
+	}
+
+	files, err := NginxConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"lms.conf", "cms.conf"} {
+		for _, want := range []string{"set $maintenance 1;", "return 503;", "add_header Retry-After 300 always;"} {
+			if !strings.Contains(files[name], want) {
+				t.Errorf("%s does not contain %q", name, want)
+			}
+		}
+	}
+	if strings.Contains(files["_tutor.conf"], "geo") {
+		t.Error("_tutor.conf defines the allow list without allowed addresses")
+	}
+	if want := "is down for maintenance"; !strings.Contains(files["maintenance.html"], want) {
+		t.Errorf("maintenance.html does not contain %q", want)
+	}
+
+	cfg.Maintenance.AllowedCIDRs = []string{"203.0.113.0/24"}
+	cfg.Maintenance.Page = "<p>Back at noon</p>"
+	files, err = NginxConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"set_real_ip_from 10.0.0.0/8;", "203.0.113.0/24 0;"} {
+		if !strings.Contains(files["_tutor.conf"], want) {
+			t.Errorf("_tutor.conf does not contain %q", want)
+		}
+	}
+	if want := "set $maintenance $maintenance_blocked;"; !strings.Contains(files["lms.conf"], want) {
+		t.Errorf("lms.conf does not contain %q", want)
+	}
+	if files["maintenance.html"] != cfg.Maintenance.Page {
+		t.Errorf("maintenance.html is %q, want the page of the spec", files["maintenance.html"])
+	}
+}
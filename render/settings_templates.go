@@ -0,0 +1,403 @@
+// Copyright 2021 Openedx Operator Developers
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// Django settings of the LMS and CMS, mounted as the lms/envs/tutor and
+// cms/envs/tutor settings packages of edx-platform.
+const settingsTemplates = `
+{{- define "__init__.py" -}}
+# Silence overly verbose warnings
+import logging
+import warnings
+from django.utils.deprecation import RemovedInDjango30Warning, RemovedInDjango31Warning
+from rest_framework import RemovedInDRF310Warning, RemovedInDRF311Warning
+warnings.simplefilter('ignore', RemovedInDjango30Warning)
+warnings.simplefilter('ignore', RemovedInDjango31Warning)
+warnings.simplefilter('ignore', RemovedInDRF310Warning)
+warnings.simplefilter('ignore', RemovedInDRF311Warning)
+warnings.simplefilter('ignore', DeprecationWarning)
+{{ end }}
+
+{{- define "lilac/__init__.py" -}}
+# Silence overly verbose warnings
+import logging
+import warnings
+from django.utils.deprecation import RemovedInDjango30Warning, RemovedInDjango31Warning
+from rest_framework import RemovedInDRF313Warning
+warnings.simplefilter('ignore', RemovedInDjango30Warning)
+warnings.simplefilter('ignore', RemovedInDjango31Warning)
+warnings.simplefilter('ignore', RemovedInDRF313Warning)
+warnings.simplefilter('ignore', DeprecationWarning)
+{{ end }}
+
+{{- define "maple/__init__.py" -}}
+# Silence overly verbose warnings
+import logging
+import warnings
+from django.utils.deprecation import RemovedInDjango40Warning, RemovedInDjango41Warning
+warnings.simplefilter('ignore', RemovedInDjango40Warning)
+warnings.simplefilter('ignore', RemovedInDjango41Warning)
+warnings.simplefilter('ignore', DeprecationWarning)
+{{ end }}
+
+{{- define "common.py" -}}
+####### Settings common to LMS and CMS
+import json
+import os
+
+from xmodule.modulestore.modulestore_settings import update_module_store_settings
+
+# Mongodb connection parameters: simply modify 'mongodb_parameters' to affect all connections to MongoDb.
+mongodb_parameters = {
+    "host": {{ quote .MongoDB.Host }},
+    "port": {{ .MongoDB.Port }},
+    "user": None,
+    "password": None,
+    "db": {{ quote .MongoDB.Database }},
+}
+{{- with .MongoDB }}
+{{- if .Authenticated }}
+mongodb_parameters["user"] = os.environ["OPENEDX_MONGODB_USERNAME"]
+mongodb_parameters["password"] = os.environ["OPENEDX_MONGODB_PASSWORD"]
+mongodb_parameters["authsource"] = {{ quote .AuthSource }}
+{{- end }}
+{{- if .ReplicaSet }}
+mongodb_parameters["replicaSet"] = {{ quote .ReplicaSet }}
+{{- end }}
+{{- if .TLS }}
+mongodb_parameters["ssl"] = True
+{{- end }}
+{{- end }}
+DOC_STORE_CONFIG = mongodb_parameters
+CONTENTSTORE = {
+    "ENGINE": "xmodule.contentstore.mongo.MongoContentStore",
+    "ADDITIONAL_OPTIONS": {},
+    "DOC_STORE_CONFIG": DOC_STORE_CONFIG
+}
+# Load module store settings from config files
+update_module_store_settings(MODULESTORE, doc_store_settings=DOC_STORE_CONFIG)
+DATA_DIR = "/openedx/data/"
+for store in MODULESTORE["default"]["OPTIONS"]["stores"]:
+    store["OPTIONS"]["fs_root"] = DATA_DIR
+
+{{- with .Broker }}
+{{- if .External }}
+
+# Celery broker
+BROKER_URL = os.environ["OPENEDX_CELERY_BROKER_URL"]
+{{- else if .Authenticated }}
+
+# Celery broker
+from urllib.parse import quote
+CELERY_BROKER_USER = os.environ["OPENEDX_CELERY_BROKER_USER"]
+CELERY_BROKER_PASSWORD = os.environ["OPENEDX_CELERY_BROKER_PASSWORD"]
+BROKER_URL = "{}://{}:{}@{}/{}".format(
+    CELERY_BROKER_TRANSPORT,
+    quote(CELERY_BROKER_USER, safe=""),
+    quote(CELERY_BROKER_PASSWORD, safe=""),
+    CELERY_BROKER_HOSTNAME,
+    CELERY_BROKER_VHOST,
+)
+{{- end }}
+{{- end }}
+{{- with .Elasticsearch }}
+{{- if or .BasicAuth .APIKey .CACerts }}
+
+# Credentials and CA bundle of the search cluster
+for search_host in ELASTIC_SEARCH_CONFIG:
+{{- if .BasicAuth }}
+    search_host["http_auth"] = (os.environ["OPENEDX_ELASTICSEARCH_USERNAME"], os.environ["OPENEDX_ELASTICSEARCH_PASSWORD"])
+{{- end }}
+{{- if .APIKey }}
+    search_host["headers"] = {"Authorization": "ApiKey " + os.environ["OPENEDX_ELASTICSEARCH_API_KEY"]}
+{{- end }}
+{{- if .CACerts }}
+    search_host["verify_certs"] = True
+    search_host["ca_certs"] = {{ quote .CACerts }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+# Behave like memcache when it comes to connection errors
+DJANGO_REDIS_IGNORE_EXCEPTIONS = True
+
+DEFAULT_FROM_EMAIL = ENV_TOKENS.get("DEFAULT_FROM_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+DEFAULT_FEEDBACK_EMAIL = ENV_TOKENS.get("DEFAULT_FEEDBACK_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+SERVER_EMAIL = ENV_TOKENS.get("SERVER_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+TECH_SUPPORT_EMAIL = ENV_TOKENS.get("TECH_SUPPORT_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+CONTACT_EMAIL = ENV_TOKENS.get("CONTACT_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+BUGS_EMAIL = ENV_TOKENS.get("BUGS_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+UNIVERSITY_EMAIL = ENV_TOKENS.get("UNIVERSITY_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+PRESS_EMAIL = ENV_TOKENS.get("PRESS_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+PAYMENT_SUPPORT_EMAIL = ENV_TOKENS.get("PAYMENT_SUPPORT_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+BULK_EMAIL_DEFAULT_FROM_EMAIL = ENV_TOKENS.get("BULK_EMAIL_DEFAULT_FROM_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+API_ACCESS_MANAGER_EMAIL = ENV_TOKENS.get("API_ACCESS_MANAGER_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+API_ACCESS_FROM_EMAIL = ENV_TOKENS.get("API_ACCESS_FROM_EMAIL", ENV_TOKENS["CONTACT_EMAIL"])
+
+# Get rid completely of lms.djangoapps.coursewarehistoryextended, as we do not use the CSMH database
+INSTALLED_APPS.remove("lms.djangoapps.coursewarehistoryextended")
+DATABASE_ROUTERS.remove(
+    "openedx.core.lib.django_courseware_routers.StudentModuleHistoryExtendedRouter"
+)
+
+# Set uploaded media file path
+MEDIA_ROOT = "/openedx/media/"
+
+# Add your MFE and third-party app domains here
+CORS_ORIGIN_WHITELIST = []
+
+# Video settings
+VIDEO_IMAGE_SETTINGS["STORAGE_KWARGS"]["location"] = MEDIA_ROOT
+VIDEO_TRANSCRIPTS_SETTINGS["STORAGE_KWARGS"]["location"] = MEDIA_ROOT
+
+GRADES_DOWNLOAD = {
+    "STORAGE_TYPE": "",
+    "STORAGE_KWARGS": {
+        "base_url": "/media/grades/",
+        "location": "/openedx/media/grades",
+    },
+}
+
+ORA2_FILEUPLOAD_BACKEND = "filesystem"
+ORA2_FILEUPLOAD_ROOT = "/openedx/data/ora2"
+ORA2_FILEUPLOAD_CACHE_NAME = "ora2-storage"
+
+# Change syslog-based loggers which don't work inside docker containers
+LOGGING["handlers"]["local"] = {
+    "class": "logging.handlers.WatchedFileHandler",
+    "filename": os.path.join(LOG_DIR, "all.log"),
+    "formatter": "standard",
+}
+LOGGING["handlers"]["tracking"] = {
+    "level": "DEBUG",
+    "class": "logging.handlers.WatchedFileHandler",
+    "filename": os.path.join(LOG_DIR, "tracking.log"),
+    "formatter": "standard",
+}
+LOGGING["loggers"]["tracking"]["handlers"] = ["console", "local", "tracking"]
+# Email
+EMAIL_USE_SSL = False
+# Forward all emails from edX's Automated Communication Engine (ACE) to django.
+ACE_ENABLED_CHANNELS = ["django_email"]
+ACE_CHANNEL_DEFAULT_EMAIL = "django_email"
+ACE_CHANNEL_TRANSACTIONAL_EMAIL = "django_email"
+EMAIL_FILE_PATH = "/tmp/openedx/emails"
+
+LOCALE_PATHS.append("/openedx/locale/contrib/locale")
+LOCALE_PATHS.append("/openedx/locale/user/locale")
+
+# Allow the platform to include itself in an iframe
+X_FRAME_OPTIONS = "SAMEORIGIN"
+
+JWT_AUTH["JWT_ISSUER"] = "http://{{ .LmsHost }}/oauth2"
+JWT_AUTH["JWT_AUDIENCE"] = "openedx"
+{{ template "credentials.py" }}
+
+######## End of settings common to LMS and CMS
+{{ end }}
+
+{{- define "lms-common.py" -}}
+######## Common LMS settings
+LOGIN_REDIRECT_WHITELIST = [{{ quote .CmsHost }}]
+
+# Better layout of honor code/tos links during registration
+REGISTRATION_EXTRA_FIELDS["terms_of_service"] = "required"
+REGISTRATION_EXTRA_FIELDS["honor_code"] = "hidden"
+
+# This url must not be None and should not be used anywhere
+LEARNING_MICROFRONTEND_URL = "http://learn.openedx.org"
+
+# Fix media files paths
+PROFILE_IMAGE_BACKEND["options"]["location"] = os.path.join(
+    MEDIA_ROOT, "profile-images/"
+)
+
+COURSE_CATALOG_VISIBILITY_PERMISSION = "see_in_catalog"
+COURSE_ABOUT_VISIBILITY_PERMISSION = "see_about_page"
+
+# Allow insecure oauth2 for local interaction with local containers
+OAUTH_ENFORCE_SECURE = False
+
+# Create folders if necessary
+for folder in [DATA_DIR, LOG_DIR, MEDIA_ROOT, STATIC_ROOT_BASE, ORA2_FILEUPLOAD_ROOT]:
+    if not os.path.exists(folder):
+        os.makedirs(folder)
+
+######## End of common LMS settings
+{{ end }}
+
+{{- define "cms-common.py" -}}
+######## Common CMS settings
+STUDIO_NAME = {{ quote (printf "%s - Studio" .PlatformName) }}
+MAX_ASSET_UPLOAD_FILE_SIZE_IN_MB = 100
+
+FRONTEND_LOGIN_URL = LMS_ROOT_URL + '/login'
+FRONTEND_LOGOUT_URL = LMS_ROOT_URL + '/logout'
+FRONTEND_REGISTER_URL = LMS_ROOT_URL + '/register'
+
+# Create folders if necessary
+for folder in [LOG_DIR, MEDIA_ROOT, STATIC_ROOT_BASE]:
+    if not os.path.exists(folder):
+        os.makedirs(folder)
+
+######## End of common CMS settings
+{{ end }}
+
+{{- define "credentials.py" -}}
+# Credentials are injected from Kubernetes Secrets, never from ConfigMaps
+SECRET_KEY = os.environ["OPENEDX_SECRET_KEY"]
+DATABASES["default"]["USER"] = os.environ["OPENEDX_MYSQL_USERNAME"]
+DATABASES["default"]["PASSWORD"] = os.environ["OPENEDX_MYSQL_PASSWORD"]
+COMMENTS_SERVICE_KEY = os.environ["OPENEDX_FORUM_API_KEY"]
+JWT_AUTH["JWT_SECRET_KEY"] = SECRET_KEY
+JWT_AUTH["JWT_PRIVATE_SIGNING_JWK"] = os.environ["OPENEDX_JWT_PRIVATE_JWK"]
+JWT_AUTH["JWT_PUBLIC_SIGNING_JWK_SET"] = os.environ["OPENEDX_JWT_PUBLIC_JWKS"]
+JWT_AUTH["JWT_ISSUERS"] = [
+    {
+        "ISSUER": JWT_AUTH["JWT_ISSUER"],
+        "AUDIENCE": "openedx",
+        "SECRET_KEY": SECRET_KEY
+    }
+]
+{{- end }}
+
+{{- define "user-settings.py" -}}
+{{ range .Python }}
+######## User settings
+{{ chomp . }}
+{{ end }}
+{{- end }}
+
+{{- define "save-settings.py" -}}
+######## Settings managed by the operator, saved before the user settings
+import copy
+operator_settings = {}
+for path in [
+{{- range protectedSettings }}
+    {{ quote . }},
+{{- end }}
+]:
+    parent, keys = globals(), path.split(".")
+    for key in keys[:-1]:
+        parent = parent.get(key, {})
+    if keys[-1] in parent:
+        operator_settings[path] = copy.deepcopy(parent[keys[-1]])
+{{- end }}
+
+{{- define "restore-settings.py" -}}
+######## Settings managed by the operator, which the user settings cannot override
+for path, value in operator_settings.items():
+    parent, keys = globals(), path.split(".")
+    for key in keys[:-1]:
+        parent = parent.setdefault(key, {})
+    parent[keys[-1]] = value
+{{ template "credentials.py" }}
+{{ end }}
+
+{{- define "lms/production.py" -}}
+# -*- coding: utf-8 -*-
+import os
+from lms.envs.production import *
+
+{{ template "common.py" . }}
+{{ template "lms-common.py" . }}
+ALLOWED_HOSTS = [
+    ENV_TOKENS.get("LMS_BASE"),
+    FEATURES["PREVIEW_LMS_BASE"],
+    "lms",
+]
+
+# When we cannot provide secure session/csrf cookies, we must disable samesite=none
+SESSION_COOKIE_SECURE = False
+CSRF_COOKIE_SECURE = False
+DCS_SESSION_COOKIE_SAMESITE = "Lax"
+
+# Required to display all courses on start page
+SEARCH_SKIP_ENROLLMENT_START_DATE_FILTERING = True
+{{- if .Lms.Python }}
+
+{{ template "save-settings.py" }}
+{{- end }}
+{{ template "user-settings.py" .Lms }}
+{{- if .Lms.Python }}
+{{ template "restore-settings.py" }}
+{{- end }}
+{{- end }}
+
+{{- define "lms/development.py" -}}
+# -*- coding: utf-8 -*-
+import os
+from lms.envs.devstack import *
+
+{{ template "common.py" . }}
+{{ template "lms-common.py" . }}
+# Setup correct webpack configuration file for development
+WEBPACK_CONFIG_PATH = "webpack.dev.config.js"
+
+SESSION_COOKIE_DOMAIN = ".{{ .LmsHost }}"
+
+LMS_BASE = "{{ .LmsHost }}:8000"
+LMS_ROOT_URL = "http://{}".format(LMS_BASE)
+LMS_INTERNAL_ROOT_URL = LMS_ROOT_URL
+SITE_NAME = LMS_BASE
+CMS_BASE = "{{ .CmsHost }}:8001"
+CMS_ROOT_URL = "http://{}".format(CMS_BASE)
+LOGIN_REDIRECT_WHITELIST.append(CMS_BASE)
+
+FEATURES['ENABLE_COURSEWARE_MICROFRONTEND'] = False
+COMMENTS_SERVICE_URL = {{ quote .ForumURL }}
+
+LOGGING["loggers"]["oauth2_provider"] = {
+    "handlers": ["console"],
+    "level": "DEBUG"
+}
+{{ end }}
+
+{{- define "cms/production.py" -}}
+# -*- coding: utf-8 -*-
+import os
+from cms.envs.production import *
+
+{{ template "common.py" . }}
+{{ template "cms-common.py" . }}
+ALLOWED_HOSTS = [
+    ENV_TOKENS.get("CMS_BASE"),
+    "cms",
+]
+{{- if .Cms.Python }}
+
+{{ template "save-settings.py" }}
+{{- end }}
+{{ template "user-settings.py" .Cms }}
+{{- if .Cms.Python }}
+{{ template "restore-settings.py" }}
+{{- end }}
+{{- end }}
+
+{{- define "cms/development.py" -}}
+# -*- coding: utf-8 -*-
+import os
+from cms.envs.devstack import *
+
+LMS_BASE = "{{ .LmsHost }}:8000"
+LMS_ROOT_URL = "http://" + LMS_BASE
+FEATURES["PREVIEW_LMS_BASE"] = "preview." + LMS_BASE
+
+{{ template "common.py" . }}
+{{ template "cms-common.py" . }}
+# Setup correct webpack configuration file for development
+WEBPACK_CONFIG_PATH = "webpack.dev.config.js"
+{{ end }}
+`